@@ -0,0 +1,317 @@
+// Command hubbench measures how many direct messages per second the hub stores and delivers
+// when every database query takes a fixed time, and how that changes with the number of shards.
+//
+// Half of the simulated users send messages to their peer over websocket connections,
+// each keeping -inflight messages unacknowledged, the other half count what they receive.
+// Another -idle connections stay open the whole time, like the users that are online but quiet.
+// Connections run over in-memory pipes, so the only limit on their number is memory.
+//
+//	go run ./cmd/hubbench -pairs 200 -messages 50 -latency 2ms -workers 16
+//	go run ./cmd/hubbench -pairs 1000 -idle 20000 -latency 0 -shards 1,2,4,8
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"tarun-kavipurapu/test-go-chat/internal"
+	"tarun-kavipurapu/test-go-chat/internal/handlers"
+	"tarun-kavipurapu/test-go-chat/types"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type benchConfig struct {
+	pairs    int
+	messages int
+	inflight int
+	latency  time.Duration
+	workers  int
+	shards   int
+	idle     int
+	queue    int
+	policy   internal.OverflowPolicy
+	timeout  time.Duration
+}
+
+type benchResult struct {
+	connected   time.Duration
+	delivered   int64
+	errors      int64
+	disconnects int64
+	queries     int64
+	elapsed     time.Duration
+	latencies   []time.Duration
+}
+
+func main() {
+	var cfg benchConfig
+	flag.IntVar(&cfg.pairs, "pairs", 200, "sender and receiver pairs, each pair has its own conversation")
+	flag.IntVar(&cfg.messages, "messages", 50, "messages sent by every sender")
+	flag.IntVar(&cfg.inflight, "inflight", 1, "unacknowledged messages a sender may have")
+	flag.DurationVar(&cfg.latency, "latency", 2*time.Millisecond, "simulated duration of every database query")
+	flag.IntVar(&cfg.workers, "workers", 16, "pipeline workers of the hub")
+	flag.IntVar(&cfg.idle, "idle", 0, "connections that stay open without sending")
+	shards := flag.String("shards", "0", "comma separated shard counts to run the benchmark with, 0 is one per CPU")
+	flag.IntVar(&cfg.queue, "queue", 0, "send queue size of every connection, 0 is the hub's default")
+	policy := flag.String("policy", "", "send queue overflow policy: disconnect, drop_oldest or spill")
+	flag.DurationVar(&cfg.timeout, "timeout", 2*time.Minute, "give up after this long")
+	verbose := flag.Bool("v", false, "keep the hub's logs")
+	flag.Parse()
+
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+	var err error
+	if cfg.policy, err = internal.ParseOverflowPolicy(*policy); err != nil {
+		fmt.Fprintln(os.Stderr, "hubbench:", err)
+		os.Exit(2)
+	}
+
+	for _, field := range strings.Split(*shards, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "hubbench: invalid shard count:", field)
+			os.Exit(2)
+		}
+		cfg.shards = n
+
+		result, err := run(cfg)
+		if result != nil {
+			report(cfg, result)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "hubbench:", err)
+			os.Exit(1)
+		}
+	}
+}
+
+func run(cfg benchConfig) (*benchResult, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := newBenchStore(cfg.latency)
+	hub := internal.NewHub(handlers.NewChatHandler(store), store, internal.NewPresence(),
+		internal.NewMemoryBroker(), internal.NewMemoryRegistry(), internal.HubOptions{
+			NodeId:         "hubbench",
+			Workers:        cfg.workers,
+			Shards:         cfg.shards,
+			SendQueueSize:  cfg.queue,
+			OverflowPolicy: cfg.policy,
+		})
+	go hub.Run(ctx)
+
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  512,
+		WriteBufferSize: 512,
+		CheckOrigin:     func(r *http.Request) bool { return true },
+	}
+	listener := newPipeListener()
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId, err := strconv.ParseInt(r.URL.Query().Get("user"), 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		internal.CreateNewSocketUser(hub, conn, userId, nil)
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+	dialer := &websocket.Dialer{
+		NetDialContext:  listener.DialContext,
+		ReadBufferSize:  512,
+		WriteBufferSize: 512,
+	}
+
+	result := &benchResult{}
+	var mu sync.Mutex
+	var latencies []time.Duration
+	expected := int64(cfg.pairs * cfg.messages)
+	done := make(chan struct{})
+	var closeDone sync.Once
+
+	var conns []*websocket.Conn
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+
+	connectStart := time.Now()
+	for i := 1; i <= cfg.idle; i++ {
+		conn, err := dial(dialer, int64(2*cfg.pairs+i))
+		if err != nil {
+			return nil, err
+		}
+		conns = append(conns, conn)
+		go readEvents(conn, func(*types.SocketEventRequest) {}, &result.disconnects, done)
+	}
+	connected := time.Since(connectStart)
+
+	// receivers connect before the senders so every message is delivered live
+	for pair := 1; pair <= cfg.pairs; pair++ {
+		conn, err := dial(dialer, int64(2*pair))
+		if err != nil {
+			return nil, err
+		}
+		conns = append(conns, conn)
+		go readEvents(conn, func(event *types.SocketEventRequest) {
+			if event.EventName != internal.EventMessageNew {
+				return
+			}
+			var message internal.Message
+			if json.Unmarshal(event.EventPayload, &message) != nil {
+				return
+			}
+			sentAt, _ := strconv.ParseInt(message.Content, 10, 64)
+			mu.Lock()
+			defer mu.Unlock()
+			latencies = append(latencies, time.Since(time.Unix(0, sentAt)))
+			if atomic.AddInt64(&result.delivered, 1) == expected {
+				closeDone.Do(func() { close(done) })
+			}
+		}, &result.disconnects, done)
+	}
+
+	senders := make([]*websocket.Conn, cfg.pairs)
+	for pair := 1; pair <= cfg.pairs; pair++ {
+		conn, err := dial(dialer, int64(2*pair-1))
+		if err != nil {
+			return nil, err
+		}
+		conns = append(conns, conn)
+		senders[pair-1] = conn
+	}
+
+	start := time.Now()
+	for pair := 1; pair <= cfg.pairs; pair++ {
+		go send(senders[pair-1], int64(2*pair-1), int64(2*pair), cfg, &result.errors, &result.disconnects, done)
+	}
+
+	var err error
+	select {
+	case <-done:
+	case <-time.After(cfg.timeout):
+		closeDone.Do(func() { close(done) })
+		err = fmt.Errorf("timed out with %d of %d messages delivered", atomic.LoadInt64(&result.delivered), expected)
+	}
+
+	// late deliveries after a timeout must not race with the report
+	mu.Lock()
+	defer mu.Unlock()
+	return &benchResult{
+		connected:   connected,
+		delivered:   atomic.LoadInt64(&result.delivered),
+		errors:      atomic.LoadInt64(&result.errors),
+		disconnects: atomic.LoadInt64(&result.disconnects),
+		queries:     store.Conn.Count(),
+		elapsed:     time.Since(start),
+		latencies:   append([]time.Duration(nil), latencies...),
+	}, err
+}
+
+func dial(dialer *websocket.Dialer, userId int64) (*websocket.Conn, error) {
+	conn, _, err := dialer.Dial(fmt.Sprintf("ws://hubbench/?user=%d", userId), nil)
+	if err != nil {
+		return nil, fmt.Errorf("user %d unable to connect: %w", userId, err)
+	}
+	return conn, nil
+}
+
+// send posts the sender's messages, waiting for an ack whenever cfg.inflight messages are unacknowledged.
+func send(conn *websocket.Conn, from int64, to int64, cfg benchConfig, errors *int64, disconnects *int64, done chan struct{}) {
+	acks := make(chan struct{}, cfg.messages)
+	go readEvents(conn, func(event *types.SocketEventRequest) {
+		switch event.EventName {
+		case internal.EventMessageAck:
+			acks <- struct{}{}
+		case internal.EventError:
+			atomic.AddInt64(errors, 1)
+			acks <- struct{}{}
+		}
+	}, disconnects, done)
+
+	for i := 0; i < cfg.messages; i++ {
+		if i >= cfg.inflight {
+			select {
+			case <-acks:
+			case <-done:
+				return
+			}
+		}
+		err := conn.WriteJSON(&types.SocketEventStruct{
+			EventName: internal.EventMessageSend,
+			EventId:   strconv.Itoa(i),
+			EventPayload: &internal.Message{
+				ClientId: fmt.Sprintf("%d-%d", from, i),
+				From:     from,
+				To:       to,
+				Content:  strconv.FormatInt(time.Now().UnixNano(), 10),
+			},
+		})
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readEvents decodes every event of the connection, the hub may batch several events in one frame.
+func readEvents(conn *websocket.Conn, handle func(*types.SocketEventRequest), disconnects *int64, done chan struct{}) {
+	for {
+		_, reader, err := conn.NextReader()
+		if err != nil {
+			select {
+			case <-done:
+			default:
+				atomic.AddInt64(disconnects, 1)
+			}
+			return
+		}
+		decoder := json.NewDecoder(reader)
+		for {
+			var event types.SocketEventRequest
+			if err := decoder.Decode(&event); err != nil {
+				break
+			}
+			handle(&event)
+		}
+	}
+}
+
+func report(cfg benchConfig, result *benchResult) {
+	sort.Slice(result.latencies, func(i, j int) bool { return result.latencies[i] < result.latencies[j] })
+	percentile := func(p float64) time.Duration {
+		if len(result.latencies) == 0 {
+			return 0
+		}
+		return result.latencies[int(p*float64(len(result.latencies)-1))]
+	}
+
+	fmt.Println()
+	fmt.Printf("pairs=%d messages=%d inflight=%d latency=%s workers=%d shards=%d idle=%d\n", cfg.pairs, cfg.messages, cfg.inflight, cfg.latency, cfg.workers, cfg.shards, cfg.idle)
+	if cfg.idle > 0 {
+		fmt.Printf("connected %d idle clients in %s: %.0f conn/s\n", cfg.idle, result.connected.Round(time.Millisecond), float64(cfg.idle)/result.connected.Seconds())
+	}
+	fmt.Printf("delivered %d messages in %s: %.0f msg/s\n", result.delivered, result.elapsed.Round(time.Millisecond), float64(result.delivered)/result.elapsed.Seconds())
+	fmt.Printf("latency p50=%s p99=%s max=%s\n", percentile(0.5).Round(time.Microsecond), percentile(0.99).Round(time.Microsecond), percentile(1).Round(time.Microsecond))
+	fmt.Printf("queries=%d errors=%d disconnects=%d\n", result.queries, result.errors, result.disconnects)
+	// the hub's expvars add up over every run of the process
+	fmt.Printf("send queue peak=%s drops=%s disconnects=%s\n", expvar.Get("send_queue_peak"), expvar.Get("send_queue_drops"), expvar.Get("send_queue_disconnects"))
+}
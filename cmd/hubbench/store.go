@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"tarun-kavipurapu/test-go-chat/db/dbtest"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// newBenchStore stands in for Postgres: it answers the queries the hub runs with canned rows after a fixed delay.
+// Users 2k-1 and 2k share the direct conversation k.
+func newBenchStore(latency time.Duration) dbtest.Store {
+	conn := dbtest.NewConn()
+	conn.Latency = latency
+	var messageId, seq atomic.Int64
+
+	conn.OnQuery("GetUserById", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.User{ID: args[0].(int64)}), nil
+	})
+	conn.OnQuery("GetDirectConversation", func(args []interface{}) ([][]interface{}, error) {
+		key := args[0].(pgtype.Text)
+		var userA, userB int64
+		fmt.Sscanf(key.String, "%d:%d", &userA, &userB)
+		return dbtest.Rows(db.Conversation{ID: (userA + 1) / 2, DirectKey: key}), nil
+	})
+	conn.OnQuery("ListConversationMemberIds", func(args []interface{}) ([][]interface{}, error) {
+		conversationId := args[0].(int64)
+		return [][]interface{}{{2*conversationId - 1}, {2 * conversationId}}, nil
+	})
+	conn.OnQuery("NextConversationSeq", func(args []interface{}) ([][]interface{}, error) {
+		// the simulated clients never resume, a number increasing across conversations is enough
+		return [][]interface{}{{seq.Add(1)}}, nil
+	})
+	conn.OnQuery("InsertMessage", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.Message{
+			ID:             messageId.Add(1),
+			FromUserID:     args[0].(int64),
+			ToUserID:       args[1].(pgtype.Int8),
+			ConversationID: args[2].(int64),
+			IsSent:         args[3].(bool),
+			Content:        args[4].(string),
+			ClientID:       args[5].(pgtype.Text),
+			Seq:            args[6].(int64),
+			CreatedAt:      pgtype.Timestamptz{Time: time.Now(), Valid: true},
+		}), nil
+	})
+	conn.OnExec("InsertMessageRecipients", func(args []interface{}) (int64, error) { return 1, nil })
+	conn.OnQuery("MarkMessagesDelivered", func(args []interface{}) ([][]interface{}, error) {
+		var delivered [][]interface{}
+		for _, messageId := range args[0].([]int64) {
+			delivered = append(delivered, []interface{}{messageId})
+		}
+		return delivered, nil
+	})
+	return dbtest.NewStore(conn)
+}
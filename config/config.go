@@ -14,6 +14,31 @@ type Config struct {
 	AWS_ACCESS_TOKEN     string `mapstructure:"AWS_ACCESS_TOKEN"`
 	AWS_SECRET_TOKEN_KEY string `mapstructure:"AWS_SECRET_TOKEN_KEY"`
 	AWS_BUCKET_NAME      string `mapstructure:"AWS_BUCKET_NAME"`
+
+	// Broker selects how nodes exchange socket events: memory for a single node or redis
+	Broker        string `mapstructure:"BROKER"`
+	RedisAddr     string `mapstructure:"REDIS_ADDR"`
+	RedisPassword string `mapstructure:"REDIS_PASSWORD"`
+	// NodeId names this instance in the cluster, a random one is used when it is empty
+	NodeId string `mapstructure:"NODE_ID"`
+	// PipelineWorkers is how many goroutines run the hub's database work
+	PipelineWorkers int `mapstructure:"PIPELINE_WORKERS"`
+	// HubShards is how many goroutines own the connections, one per CPU when it is zero
+	HubShards int `mapstructure:"HUB_SHARDS"`
+	// SendQueueSize bounds the events waiting for a slow connection, SendQueuePolicy picks what happens past it
+	SendQueueSize   int    `mapstructure:"SEND_QUEUE_SIZE"`
+	SendQueuePolicy string `mapstructure:"SEND_QUEUE_POLICY"`
+	// MetricsAddr is the internal address serving the expvar metrics at /debug/vars, none are served when it is empty
+	MetricsAddr string `mapstructure:"METRICS_ADDR"`
+
+	// BlobStore selects where attachments are kept: local below BlobDir, or s3 in AWS_BUCKET_NAME.
+	// S3Endpoint points at an S3 compatible server such as MinIO, AWS is used when it is empty.
+	BlobStore  string `mapstructure:"BLOB_STORE"`
+	BlobDir    string `mapstructure:"BLOB_DIR"`
+	S3Endpoint string `mapstructure:"S3_ENDPOINT"`
+	S3Insecure bool   `mapstructure:"S3_INSECURE"`
+	// MediaWorkers is how many images are thumbnailed at once, half the CPUs when it is zero
+	MediaWorkers int `mapstructure:"MEDIA_WORKERS"`
 }
 
 var EnvVars Config
@@ -48,6 +73,20 @@ func LoadConfig(path string) (config Config, err error) {
 	EnvVars.AWS_ACCESS_TOKEN = viper.GetString("AWS_ACCESS_TOKEN")
 	EnvVars.AWS_SECRET_TOKEN_KEY = viper.GetString("AWS_SECRET_TOKEN_KEY")
 	EnvVars.AWS_BUCKET_NAME = viper.GetString("AWS_BUCKET_NAME")
+	EnvVars.Broker = viper.GetString("BROKER")
+	EnvVars.RedisAddr = viper.GetString("REDIS_ADDR")
+	EnvVars.RedisPassword = viper.GetString("REDIS_PASSWORD")
+	EnvVars.NodeId = viper.GetString("NODE_ID")
+	EnvVars.PipelineWorkers = viper.GetInt("PIPELINE_WORKERS")
+	EnvVars.HubShards = viper.GetInt("HUB_SHARDS")
+	EnvVars.SendQueueSize = viper.GetInt("SEND_QUEUE_SIZE")
+	EnvVars.SendQueuePolicy = viper.GetString("SEND_QUEUE_POLICY")
+	EnvVars.MetricsAddr = viper.GetString("METRICS_ADDR")
+	EnvVars.BlobStore = viper.GetString("BLOB_STORE")
+	EnvVars.BlobDir = viper.GetString("BLOB_DIR")
+	EnvVars.S3Endpoint = viper.GetString("S3_ENDPOINT")
+	EnvVars.S3Insecure = viper.GetBool("S3_INSECURE")
+	EnvVars.MediaWorkers = viper.GetInt("MEDIA_WORKERS")
 
 	return EnvVars, nil
 }
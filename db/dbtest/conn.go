@@ -0,0 +1,238 @@
+// Package dbtest stands in for Postgres in tests and benchmarks. A Conn answers the queries sqlc generates
+// by their name with the rows the test hands it, and remembers the arguments of every query it ran.
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// QueryFunc answers a query with its rows, QueryRow fails with pgx.ErrNoRows when there are none.
+type QueryFunc func(args []interface{}) ([][]interface{}, error)
+
+// ExecFunc answers a statement with the number of rows it touched.
+type ExecFunc func(args []interface{}) (int64, error)
+
+// Conn implements db.DBTX. Queries without an answer return no rows and statements touch no rows.
+type Conn struct {
+	// Latency is waited before every query, like a round trip to the database.
+	Latency time.Duration
+
+	mu      sync.Mutex
+	queries map[string]QueryFunc
+	execs   map[string]ExecFunc
+	calls   map[string][][]interface{}
+	count   atomic.Int64
+}
+
+var _ db.DBTX = (*Conn)(nil)
+
+func NewConn() *Conn {
+	return &Conn{
+		queries: make(map[string]QueryFunc),
+		execs:   make(map[string]ExecFunc),
+		calls:   make(map[string][][]interface{}),
+	}
+}
+
+// OnQuery answers the query called name, for Query and QueryRow alike.
+func (c *Conn) OnQuery(name string, fn QueryFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queries[name] = fn
+}
+
+// OnExec answers the statement called name.
+func (c *Conn) OnExec(name string, fn ExecFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.execs[name] = fn
+}
+
+// Calls returns the arguments of every run of the query called name, oldest first.
+func (c *Conn) Calls(name string) [][]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([][]interface{}(nil), c.calls[name]...)
+}
+
+// Count returns how many round trips were made, commits included.
+func (c *Conn) Count() int64 {
+	return c.count.Load()
+}
+
+func (c *Conn) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	if err := c.wait(ctx); err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	c.mu.Lock()
+	fn := c.execs[c.record(sql, args)]
+	c.mu.Unlock()
+	var affected int64
+	if fn != nil {
+		var err error
+		if affected, err = fn(args); err != nil {
+			return pgconn.CommandTag{}, err
+		}
+	}
+	return pgconn.NewCommandTag(fmt.Sprintf("UPDATE %d", affected)), nil
+}
+
+func (c *Conn) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	values, err := c.answer(ctx, sql, args)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{values: values}, nil
+}
+
+func (c *Conn) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	values, err := c.answer(ctx, sql, args)
+	if err != nil {
+		return &row{err: err}
+	}
+	if len(values) == 0 {
+		return &row{err: pgx.ErrNoRows}
+	}
+	return &row{values: values[0]}
+}
+
+func (c *Conn) answer(ctx context.Context, sql string, args []interface{}) ([][]interface{}, error) {
+	if err := c.wait(ctx); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	fn := c.queries[c.record(sql, args)]
+	c.mu.Unlock()
+	if fn == nil {
+		return nil, nil
+	}
+	return fn(args)
+}
+
+// record remembers the arguments of a query and returns its name, c.mu must be held.
+func (c *Conn) record(sql string, args []interface{}) string {
+	name := queryName(sql)
+	c.calls[name] = append(c.calls[name], args)
+	return name
+}
+
+func (c *Conn) wait(ctx context.Context) error {
+	c.count.Add(1)
+	if c.Latency == 0 {
+		return ctx.Err()
+	}
+	select {
+	case <-time.After(c.Latency):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// queryName reads the name sqlc puts on the first line of every query.
+func queryName(sql string) string {
+	line, _, _ := strings.Cut(sql, "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return ""
+	}
+	return fields[2]
+}
+
+// Fields returns the fields of a row struct in order, which is the order sqlc scans the columns of its query in.
+func Fields(record interface{}) []interface{} {
+	value := reflect.ValueOf(record)
+	fields := make([]interface{}, value.NumField())
+	for i := range fields {
+		fields[i] = value.Field(i).Interface()
+	}
+	return fields
+}
+
+// Rows answers a query with the fields of every record, see Fields.
+func Rows[T any](records ...T) [][]interface{} {
+	values := make([][]interface{}, len(records))
+	for i, record := range records {
+		values[i] = Fields(record)
+	}
+	return values
+}
+
+// Store runs transactions on the same connection, committing costs one more round trip.
+// Nothing is rolled back when fn fails.
+type Store struct {
+	*db.Queries
+	Conn *Conn
+}
+
+var _ db.Store = Store{}
+
+func NewStore(conn *Conn) Store {
+	return Store{Queries: db.New(conn), Conn: conn}
+}
+
+func (s Store) ExecTx(ctx context.Context, fn func(*db.Queries) error) error {
+	if err := fn(s.Queries); err != nil {
+		return err
+	}
+	return s.Conn.wait(ctx)
+}
+
+// row scans its values into the leading destinations and leaves the others zero.
+type row struct {
+	values []interface{}
+	err    error
+}
+
+func (r *row) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.values) > len(dest) {
+		return fmt.Errorf("dbtest: %d values for %d destinations", len(r.values), len(dest))
+	}
+	for i, value := range r.values {
+		if value == nil {
+			continue
+		}
+		target := reflect.ValueOf(dest[i]).Elem()
+		source := reflect.ValueOf(value)
+		if !source.Type().ConvertibleTo(target.Type()) {
+			return fmt.Errorf("dbtest: cannot scan %T into %s", value, target.Type())
+		}
+		target.Set(source.Convert(target.Type()))
+	}
+	return nil
+}
+
+type rows struct {
+	values [][]interface{}
+	row    int
+}
+
+func (r *rows) Close()                                       {}
+func (r *rows) Err() error                                   { return nil }
+func (r *rows) CommandTag() pgconn.CommandTag                { return pgconn.NewCommandTag("SELECT") }
+func (r *rows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *rows) Values() ([]interface{}, error)               { return r.values[r.row-1], nil }
+func (r *rows) RawValues() [][]byte                          { return nil }
+func (r *rows) Conn() *pgx.Conn                              { return nil }
+
+func (r *rows) Next() bool {
+	r.row++
+	return r.row <= len(r.values)
+}
+
+func (r *rows) Scan(dest ...interface{}) error {
+	return (&row{values: r.values[r.row-1]}).Scan(dest...)
+}
@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS idx_message_conversation;
+
+DELETE FROM message WHERE to_user_id IS NULL;
+
+ALTER TABLE "message"
+ALTER COLUMN "to_user_id"
+SET NOT NULL;
+
+ALTER TABLE "message"
+DROP COLUMN IF EXISTS "conversation_id";
+
+DROP TABLE IF EXISTS conversation_member cascade;
+
+DROP TABLE IF EXISTS conversation cascade;
@@ -0,0 +1,78 @@
+-- conversation table, direct messages and groups share it
+CREATE TABLE
+    IF NOT EXISTS "conversation" (
+        "id" BIGSERIAL PRIMARY KEY,
+        "name" VARCHAR(255),
+        "is_group" BOOLEAN NOT NULL DEFAULT FALSE,
+        -- "<low user id>:<high user id>" for direct conversations, NULL for groups
+        "direct_key" VARCHAR(64) UNIQUE,
+        "created_by" BIGINT REFERENCES "users" ("id") ON DELETE SET NULL,
+        "created_at" TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            "updated_at" TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+    );
+
+CREATE TABLE
+    IF NOT EXISTS "conversation_member" (
+        "conversation_id" BIGINT NOT NULL REFERENCES "conversation" ("id") ON DELETE CASCADE,
+        "user_id" BIGINT NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+        "role" VARCHAR(16) NOT NULL DEFAULT 'member',
+        "joined_at" TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY ("conversation_id", "user_id")
+    );
+
+CREATE INDEX idx_conversation_member_user ON conversation_member (user_id);
+
+ALTER TABLE "message"
+ADD COLUMN "conversation_id" BIGINT REFERENCES "conversation" ("id") ON DELETE CASCADE;
+
+-- move the existing one-to-one messages into direct conversations
+INSERT INTO
+    conversation (is_group, direct_key)
+SELECT DISTINCT
+    FALSE,
+    LEAST (from_user_id, to_user_id) || ':' || GREATEST (from_user_id, to_user_id)
+FROM
+    message ON CONFLICT (direct_key) DO NOTHING;
+
+INSERT INTO
+    conversation_member (conversation_id, user_id)
+SELECT
+    id,
+    split_part (direct_key, ':', 1)::BIGINT
+FROM
+    conversation
+WHERE
+    direct_key IS NOT NULL
+UNION
+SELECT
+    id,
+    split_part (direct_key, ':', 2)::BIGINT
+FROM
+    conversation
+WHERE
+    direct_key IS NOT NULL ON CONFLICT DO NOTHING;
+
+UPDATE message m
+SET
+    conversation_id = c.id
+FROM
+    conversation c
+WHERE
+    c.direct_key = LEAST (m.from_user_id, m.to_user_id) || ':' || GREATEST (m.from_user_id, m.to_user_id);
+
+ALTER TABLE "message"
+ALTER COLUMN "conversation_id"
+SET NOT NULL;
+
+-- group messages have no single recipient
+ALTER TABLE "message"
+ALTER COLUMN "to_user_id"
+DROP NOT NULL;
+
+CREATE INDEX idx_message_conversation ON message (conversation_id, created_at);
@@ -0,0 +1,14 @@
+-- per recipient delivery state, a row stays pending until the message is written to one of the recipient's sockets
+CREATE TABLE
+    IF NOT EXISTS "message_recipient" (
+        "message_id" BIGINT NOT NULL REFERENCES "message" ("id") ON DELETE CASCADE,
+        "user_id" BIGINT NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+        "delivered_at" TIMESTAMP
+        WITH
+            TIME ZONE,
+            PRIMARY KEY ("message_id", "user_id")
+    );
+
+CREATE INDEX idx_message_recipient_pending ON message_recipient (user_id, message_id)
+WHERE
+    delivered_at IS NULL;
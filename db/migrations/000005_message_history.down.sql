@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_message_conversation;
+
+CREATE INDEX idx_message_conversation ON message (conversation_id, created_at);
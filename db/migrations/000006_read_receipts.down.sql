@@ -0,0 +1,2 @@
+ALTER TABLE "message_recipient"
+DROP COLUMN IF EXISTS "read_at";
@@ -0,0 +1,4 @@
+ALTER TABLE "message_recipient"
+ADD COLUMN "read_at" TIMESTAMP
+WITH
+    TIME ZONE;
@@ -0,0 +1,5 @@
+ALTER TABLE "message"
+DROP CONSTRAINT IF EXISTS "message_sender_client_id_key";
+
+ALTER TABLE "message"
+DROP COLUMN IF EXISTS "client_id";
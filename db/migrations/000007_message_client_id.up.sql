@@ -0,0 +1,6 @@
+-- idempotency key chosen by the sending client, retries with the same key return the stored message
+ALTER TABLE "message"
+ADD COLUMN "client_id" VARCHAR(64);
+
+ALTER TABLE "message"
+ADD CONSTRAINT "message_sender_client_id_key" UNIQUE ("from_user_id", "client_id");
@@ -0,0 +1,4 @@
+ALTER TABLE "users"
+ADD COLUMN "last_seen_at" TIMESTAMP
+WITH
+    TIME ZONE;
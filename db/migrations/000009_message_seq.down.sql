@@ -0,0 +1,8 @@
+ALTER TABLE "message"
+DROP CONSTRAINT IF EXISTS "message_conversation_seq_key";
+
+ALTER TABLE "message"
+DROP COLUMN IF EXISTS "seq";
+
+ALTER TABLE "conversation"
+DROP COLUMN IF EXISTS "last_seq";
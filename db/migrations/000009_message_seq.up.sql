@@ -0,0 +1,49 @@
+-- every conversation numbers its messages 1, 2, 3... so a reconnecting client can ask for what it missed
+ALTER TABLE "conversation"
+ADD COLUMN "last_seq" BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE "message"
+ADD COLUMN "seq" BIGINT;
+
+UPDATE message m
+SET
+    seq = numbered.seq
+FROM
+    (
+        SELECT
+            id,
+            ROW_NUMBER() OVER (
+                PARTITION BY
+                    conversation_id
+                ORDER BY
+                    created_at,
+                    id
+            ) AS seq
+        FROM
+            message
+    ) numbered
+WHERE
+    numbered.id = m.id;
+
+UPDATE conversation c
+SET
+    last_seq = numbered.last_seq
+FROM
+    (
+        SELECT
+            conversation_id,
+            MAX(seq) AS last_seq
+        FROM
+            message
+        GROUP BY
+            conversation_id
+    ) numbered
+WHERE
+    numbered.conversation_id = c.id;
+
+ALTER TABLE "message"
+ALTER COLUMN "seq"
+SET NOT NULL;
+
+ALTER TABLE "message"
+ADD CONSTRAINT "message_conversation_seq_key" UNIQUE ("conversation_id", "seq");
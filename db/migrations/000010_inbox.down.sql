@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_conversation_member_inbox;
+
+ALTER TABLE "conversation_member"
+DROP COLUMN IF EXISTS "unread_count";
+
+ALTER TABLE "conversation_member"
+DROP COLUMN IF EXISTS "last_activity_at";
+
+ALTER TABLE "conversation"
+DROP COLUMN IF EXISTS "last_message_id";
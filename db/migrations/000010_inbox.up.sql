@@ -0,0 +1,62 @@
+-- the inbox of a user is read from conversation_member alone, every message updates the rows of its conversation
+ALTER TABLE "conversation"
+ADD COLUMN "last_message_id" BIGINT REFERENCES "message" ("id") ON DELETE SET NULL;
+
+ALTER TABLE "conversation_member"
+ADD COLUMN "last_activity_at" TIMESTAMP
+WITH
+    TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+-- messages of the conversation the member has not read yet
+ALTER TABLE "conversation_member"
+ADD COLUMN "unread_count" INTEGER NOT NULL DEFAULT 0;
+
+UPDATE conversation c
+SET
+    last_message_id = latest.id
+FROM
+    (
+        SELECT DISTINCT
+            ON (conversation_id) conversation_id,
+            id
+        FROM
+            message
+        ORDER BY
+            conversation_id,
+            seq DESC
+    ) latest
+WHERE
+    latest.conversation_id = c.id;
+
+UPDATE conversation_member cm
+SET
+    last_activity_at = GREATEST (cm.joined_at, m.created_at)
+FROM
+    conversation c
+    JOIN message m ON m.id = c.last_message_id
+WHERE
+    c.id = cm.conversation_id;
+
+UPDATE conversation_member cm
+SET
+    unread_count = unread.count
+FROM
+    (
+        SELECT
+            m.conversation_id,
+            r.user_id,
+            COUNT(*) AS count
+        FROM
+            message_recipient r
+            JOIN message m ON m.id = r.message_id
+        WHERE
+            r.read_at IS NULL
+        GROUP BY
+            m.conversation_id,
+            r.user_id
+    ) unread
+WHERE
+    unread.conversation_id = cm.conversation_id
+    AND unread.user_id = cm.user_id;
+
+CREATE INDEX idx_conversation_member_inbox ON conversation_member (user_id, last_activity_at DESC, conversation_id DESC);
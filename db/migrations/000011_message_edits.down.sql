@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS "message_edit";
+
+ALTER TABLE "message"
+DROP COLUMN IF EXISTS "deleted_at";
+
+ALTER TABLE "message"
+DROP COLUMN IF EXISTS "edited_at";
@@ -0,0 +1,23 @@
+ALTER TABLE "message"
+ADD COLUMN "edited_at" TIMESTAMP
+WITH
+    TIME ZONE;
+
+-- deleted messages stay in the history as tombstones, their content is cleared
+ALTER TABLE "message"
+ADD COLUMN "deleted_at" TIMESTAMP
+WITH
+    TIME ZONE;
+
+-- earlier versions of edited messages, a row holds the content an edit replaced
+CREATE TABLE
+    IF NOT EXISTS "message_edit" (
+        "id" BIGSERIAL PRIMARY KEY,
+        "message_id" BIGINT NOT NULL REFERENCES "message" ("id") ON DELETE CASCADE,
+        "content" TEXT NOT NULL,
+        "replaced_at" TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+    );
+
+CREATE INDEX idx_message_edit_message ON message_edit (message_id, id);
@@ -0,0 +1,13 @@
+-- a user reacts at most once with each emoji to a message
+CREATE TABLE
+    IF NOT EXISTS "message_reaction" (
+        "message_id" BIGINT NOT NULL REFERENCES "message" ("id") ON DELETE CASCADE,
+        "user_id" BIGINT NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+        "emoji" VARCHAR(32) NOT NULL,
+        "created_at" TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY ("message_id", "user_id", "emoji")
+    );
+
+CREATE INDEX idx_message_reaction_emoji ON message_reaction (message_id, emoji);
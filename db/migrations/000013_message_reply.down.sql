@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_message_reply_to;
+
+ALTER TABLE "message"
+DROP COLUMN IF EXISTS "last_reply_at";
+
+ALTER TABLE "message"
+DROP COLUMN IF EXISTS "reply_count";
+
+ALTER TABLE "message"
+DROP COLUMN IF EXISTS "reply_to";
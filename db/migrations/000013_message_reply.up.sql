@@ -0,0 +1,15 @@
+-- a reply quotes an earlier message of the same conversation, the replies to a message form its thread
+ALTER TABLE "message"
+ADD COLUMN "reply_to" BIGINT REFERENCES "message" ("id") ON DELETE SET NULL;
+
+ALTER TABLE "message"
+ADD COLUMN "reply_count" INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE "message"
+ADD COLUMN "last_reply_at" TIMESTAMP
+WITH
+    TIME ZONE;
+
+CREATE INDEX idx_message_reply_to ON message (reply_to, created_at, id)
+WHERE
+    reply_to IS NOT NULL;
@@ -0,0 +1,21 @@
+-- files uploaded to the blob store, message_id stays NULL until a message.send references the upload
+CREATE TABLE
+    IF NOT EXISTS "attachment" (
+        "id" BIGSERIAL PRIMARY KEY,
+        "uploader_id" BIGINT NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+        "message_id" BIGINT REFERENCES "message" ("id") ON DELETE CASCADE,
+        "storage_key" TEXT NOT NULL UNIQUE,
+        "filename" VARCHAR(255) NOT NULL,
+        -- sniffed from the content, not taken from the client
+        "mime_type" VARCHAR(255) NOT NULL,
+        "size_bytes" BIGINT NOT NULL,
+        -- hex encoded SHA-256 of the content
+        "checksum" CHAR(64) NOT NULL,
+        "created_at" TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+    );
+
+CREATE INDEX idx_attachment_message ON attachment (message_id)
+WHERE
+    message_id IS NOT NULL;
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS "attachment_thumbnail";
+
+DROP INDEX IF EXISTS idx_attachment_unprocessed;
+
+ALTER TABLE "attachment"
+DROP COLUMN IF EXISTS "processed_at",
+DROP COLUMN IF EXISTS "height",
+DROP COLUMN IF EXISTS "width";
@@ -0,0 +1,24 @@
+-- filled in by the media processor once an image upload is checked, stripped of its location and thumbnailed
+ALTER TABLE "attachment"
+ADD COLUMN "width" INT,
+ADD COLUMN "height" INT,
+ADD COLUMN "processed_at" TIMESTAMP
+WITH
+    TIME ZONE;
+
+-- images still waiting for the processor, picked up again on start
+CREATE INDEX idx_attachment_unprocessed ON attachment (id)
+WHERE
+    processed_at IS NULL
+    AND mime_type LIKE 'image/%';
+
+CREATE TABLE
+    IF NOT EXISTS "attachment_thumbnail" (
+        "attachment_id" BIGINT NOT NULL REFERENCES "attachment" ("id") ON DELETE CASCADE,
+        -- small or large, see media.ThumbnailSizes
+        "size" VARCHAR(16) NOT NULL,
+        "storage_key" TEXT NOT NULL UNIQUE,
+        "width" INT NOT NULL,
+        "height" INT NOT NULL,
+        PRIMARY KEY ("attachment_id", "size")
+    );
@@ -0,0 +1,5 @@
+-- profile fields users change through PATCH /users/me, empty when unset
+ALTER TABLE "users"
+ADD COLUMN "display_name" VARCHAR(64) NOT NULL DEFAULT '',
+ADD COLUMN "status_text" VARCHAR(140) NOT NULL DEFAULT '',
+ADD COLUMN "bio" VARCHAR(500) NOT NULL DEFAULT '';
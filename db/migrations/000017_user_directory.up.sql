@@ -0,0 +1,20 @@
+-- trigram indexes behind GET /users/search, they serve both the prefix and the fuzzy matches
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX idx_users_username_trgm ON users USING GIN (lower(username) gin_trgm_ops);
+
+CREATE INDEX idx_users_display_name_trgm ON users USING GIN (lower(display_name) gin_trgm_ops);
+
+CREATE TABLE
+    IF NOT EXISTS "user_block" (
+        "blocker_id" BIGINT NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+        "blocked_id" BIGINT NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+        "created_at" TIMESTAMP
+        WITH
+            TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY ("blocker_id", "blocked_id"),
+            CHECK ("blocker_id" <> "blocked_id")
+    );
+
+-- the search looks up who blocked the caller
+CREATE INDEX idx_user_block_blocked ON user_block (blocked_id);
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS message_search_index ON message;
+
+DROP FUNCTION IF EXISTS index_message_content;
+
+DROP TABLE IF EXISTS "message_search";
@@ -0,0 +1,38 @@
+-- the words of every message that is not deleted, kept next to the message so reading messages
+-- does not carry the vector. The trigger keeps them current whatever writes the message.
+-- simple keeps words as they are written, messages come in any language.
+CREATE TABLE
+    IF NOT EXISTS "message_search" (
+        "message_id" BIGINT PRIMARY KEY REFERENCES "message" ("id") ON DELETE CASCADE,
+        "search_vector" TSVECTOR NOT NULL
+    );
+
+CREATE INDEX idx_message_search_vector ON message_search USING GIN (search_vector);
+
+CREATE FUNCTION index_message_content () RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.deleted_at IS NOT NULL THEN
+        DELETE FROM message_search WHERE message_id = NEW.id;
+    ELSE
+        INSERT INTO message_search (message_id, search_vector)
+        VALUES (NEW.id, to_tsvector('simple', NEW.content))
+        ON CONFLICT (message_id) DO UPDATE
+        SET search_vector = EXCLUDED.search_vector;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER message_search_index
+AFTER INSERT OR UPDATE OF content, deleted_at ON message
+FOR EACH ROW EXECUTE FUNCTION index_message_content ();
+
+INSERT INTO
+    message_search (message_id, search_vector)
+SELECT
+    id,
+    to_tsvector('simple', content)
+FROM
+    message
+WHERE
+    deleted_at IS NULL;
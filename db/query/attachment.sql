@@ -0,0 +1,63 @@
+-- name: CreateAttachment :one
+INSERT INTO attachment (uploader_id, storage_key, filename, mime_type, size_bytes, checksum)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: GetAttachmentById :one
+SELECT * FROM attachment WHERE id = $1;
+
+-- name: AttachToMessage :many
+-- only the uploader can attach an upload, and only to one message
+UPDATE attachment
+SET message_id = sqlc.arg(message_id)::BIGINT
+WHERE id = ANY(sqlc.arg(ids)::BIGINT[])
+AND uploader_id = sqlc.arg(uploader_id)::BIGINT
+AND message_id IS NULL
+RETURNING *;
+
+-- name: ListAttachmentsByMessageIds :many
+SELECT * FROM attachment
+WHERE message_id = ANY(sqlc.arg(message_ids)::BIGINT[])
+ORDER BY message_id, id;
+
+-- name: ListUnprocessedImages :many
+SELECT id FROM attachment
+WHERE processed_at IS NULL
+AND mime_type LIKE 'image/%'
+ORDER BY id;
+
+-- name: MarkAttachmentProcessed :one
+-- the content may have been rewritten without its location, so size and checksum are replaced too
+UPDATE attachment
+SET width = sqlc.narg(width),
+    height = sqlc.narg(height),
+    size_bytes = sqlc.arg(size_bytes),
+    checksum = sqlc.arg(checksum),
+    processed_at = CURRENT_TIMESTAMP
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: MarkAttachmentNotImage :one
+-- the content did not decode as the image type it was sniffed as
+UPDATE attachment
+SET mime_type = 'application/octet-stream',
+    processed_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING *;
+
+-- name: UpsertAttachmentThumbnail :exec
+INSERT INTO attachment_thumbnail (attachment_id, size, storage_key, width, height)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (attachment_id, size) DO UPDATE
+SET storage_key = EXCLUDED.storage_key,
+    width = EXCLUDED.width,
+    height = EXCLUDED.height;
+
+-- name: GetAttachmentThumbnail :one
+SELECT * FROM attachment_thumbnail
+WHERE attachment_id = $1 AND size = $2;
+
+-- name: ListThumbnailsByAttachmentIds :many
+SELECT * FROM attachment_thumbnail
+WHERE attachment_id = ANY(sqlc.arg(attachment_ids)::BIGINT[])
+ORDER BY attachment_id, width;
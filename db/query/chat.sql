@@ -1,11 +1,212 @@
 -- name: InsertMessage :one
-INSERT INTO message (from_user_id, to_user_id, is_sent, content)
-VALUES ($1, $2, $3, $4)
+INSERT INTO message (from_user_id, to_user_id, conversation_id, is_sent, content, client_id, seq, reply_to)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (from_user_id, client_id) DO NOTHING
 RETURNING *;
 
+-- name: GetMessageByClientId :one
+SELECT * FROM message
+WHERE from_user_id = $1 AND client_id = $2;
+
+-- name: ListLatestConversationMessages :many
+SELECT * FROM message
+WHERE conversation_id = $1
+ORDER BY created_at DESC, id DESC
+LIMIT $2;
+
+-- name: ListConversationMessagesBefore :many
+SELECT * FROM message
+WHERE conversation_id = $1
+AND (created_at, id) < (sqlc.arg(cursor_created_at)::timestamptz, sqlc.arg(cursor_id)::BIGINT)
+ORDER BY created_at DESC, id DESC
+LIMIT $2;
+
+-- name: ListConversationMessagesAfter :many
+SELECT * FROM message
+WHERE conversation_id = $1
+AND (created_at, id) > (sqlc.arg(cursor_created_at)::timestamptz, sqlc.arg(cursor_id)::BIGINT)
+ORDER BY created_at ASC, id ASC
+LIMIT $2;
+
+-- name: ListConversationMessagesAfterSeq :many
+SELECT * FROM message
+WHERE conversation_id = $1
+AND seq > sqlc.arg(after_seq)::BIGINT
+ORDER BY seq
+LIMIT $2;
+
+-- name: InsertMessageRecipients :execrows
+INSERT INTO message_recipient (message_id, user_id)
+SELECT sqlc.arg(message_id)::BIGINT, cm.user_id
+FROM conversation_member cm
+WHERE cm.conversation_id = sqlc.arg(conversation_id)
+AND cm.user_id <> sqlc.arg(sender_id)::BIGINT;
+
+-- name: ListPendingMessages :many
+-- messages of conversations the user has left since are dropped
+SELECT m.* FROM message m
+JOIN message_recipient r ON r.message_id = m.id
+JOIN conversation_member cm ON cm.conversation_id = m.conversation_id AND cm.user_id = r.user_id
+WHERE r.user_id = $1
+AND r.delivered_at IS NULL
+AND m.id > sqlc.arg(after_id)::BIGINT
+ORDER BY m.id
+LIMIT $2;
+
+-- name: MarkMessagesDelivered :many
+-- returns the messages whose delivery to the user was not recorded yet
+UPDATE message_recipient
+SET delivered_at = CURRENT_TIMESTAMP
+WHERE message_id = ANY(sqlc.arg(message_ids)::BIGINT[])
+AND user_id = sqlc.arg(user_id)
+AND delivered_at IS NULL
+RETURNING message_id;
+
+-- name: MarkMessageSent :exec
+UPDATE message
+SET is_sent = TRUE
+WHERE id = $1
+AND NOT EXISTS (
+    SELECT 1 FROM message_recipient
+    WHERE message_id = $1 AND delivered_at IS NULL
+);
+
+-- name: MarkMessagesSent :exec
+UPDATE message m
+SET is_sent = TRUE
+WHERE m.id = ANY(sqlc.arg(message_ids)::BIGINT[])
+AND NOT EXISTS (
+    SELECT 1 FROM message_recipient r
+    WHERE r.message_id = m.id AND r.delivered_at IS NULL
+);
+
+-- name: MarkConversationRead :many
+UPDATE message_recipient r
+SET read_at = CURRENT_TIMESTAMP,
+    delivered_at = COALESCE(r.delivered_at, CURRENT_TIMESTAMP)
+FROM message m
+WHERE m.id = r.message_id
+AND r.user_id = $1
+AND m.conversation_id = $2
+AND m.id <= sqlc.arg(up_to_message_id)
+AND r.read_at IS NULL
+RETURNING r.message_id, m.from_user_id;
+
+-- name: ListMessageReceipts :many
+SELECT * FROM message_recipient
+WHERE message_id = ANY(sqlc.arg(message_ids)::BIGINT[])
+ORDER BY message_id, user_id;
+
+-- name: GetMessageById :one
+SELECT * FROM message WHERE id = $1;
+
+-- name: GetMessageForUpdate :one
+SELECT * FROM message WHERE id = $1
+FOR UPDATE;
 
+-- name: InsertMessageEdit :exec
+INSERT INTO message_edit (message_id, content)
+VALUES ($1, $2);
 
--- name: GetMessages :many
+-- name: UpdateMessageContent :one
+UPDATE message
+SET content = $2, edited_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING *;
+
+-- name: SoftDeleteMessage :one
+UPDATE message
+SET content = '', deleted_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteMessageEdits :exec
+DELETE FROM message_edit
+WHERE message_id = $1;
+
+-- name: ListMessageEdits :many
+SELECT * FROM message_edit
+WHERE message_id = $1
+ORDER BY id;
+
+-- name: AddMessageReaction :execrows
+INSERT INTO message_reaction (message_id, user_id, emoji)
+VALUES ($1, $2, $3)
+ON CONFLICT (message_id, user_id, emoji) DO NOTHING;
+
+-- name: RemoveMessageReaction :execrows
+DELETE FROM message_reaction
+WHERE message_id = $1 AND user_id = $2 AND emoji = $3;
+
+-- name: HasMessageReactionEmoji :one
+SELECT EXISTS (
+    SELECT 1 FROM message_reaction
+    WHERE message_id = $1 AND emoji = $2
+);
+
+-- name: CountMessageReactionEmojis :one
+SELECT COUNT(DISTINCT emoji) FROM message_reaction
+WHERE message_id = $1;
+
+-- name: ListReactionCounts :many
+SELECT message_id, emoji, COUNT(*) AS count, BOOL_OR(user_id = sqlc.arg(user_id)::BIGINT) AS reacted
+FROM message_reaction
+WHERE message_id = ANY(sqlc.arg(message_ids)::BIGINT[])
+GROUP BY message_id, emoji
+ORDER BY message_id, MIN(created_at);
+
+-- name: RecordMessageReply :exec
+UPDATE message
+SET reply_count = reply_count + 1, last_reply_at = sqlc.arg(replied_at)::timestamptz
+WHERE id = $1;
+
+-- name: RecountMessageReplies :exec
+-- runs after a reply of the message was deleted, deleted replies do not count
+UPDATE message p
+SET reply_count = (
+        SELECT COUNT(*) FROM message r
+        WHERE r.reply_to = p.id AND r.deleted_at IS NULL
+    ),
+    last_reply_at = (
+        SELECT MAX(r.created_at) FROM message r
+        WHERE r.reply_to = p.id AND r.deleted_at IS NULL
+    )
+WHERE p.id = $1;
+
+-- name: ListMessagesByIds :many
 SELECT * FROM message
-WHERE from_user_id = $1
-AND to_user_id = $2;
+WHERE id = ANY(sqlc.arg(ids)::BIGINT[]);
+
+-- name: ListThreadReplies :many
+SELECT * FROM message
+WHERE reply_to = $1
+ORDER BY created_at ASC, id ASC
+LIMIT $2;
+
+-- name: ListThreadRepliesAfter :many
+SELECT * FROM message
+WHERE reply_to = $1
+AND (created_at, id) > (sqlc.arg(cursor_created_at)::timestamptz, sqlc.arg(cursor_id)::BIGINT)
+ORDER BY created_at ASC, id ASC
+LIMIT $2;
+
+-- name: SearchMessages :many
+-- newest matches first in the conversations the user is a member of. The query takes the web search syntax:
+-- "quoted phrases", or, and -excluded words. The snippet marks the matches with U+E000 and U+E001,
+-- which the handler turns into <mark> tags once the content is HTML escaped.
+SELECT m.id, m.from_user_id, m.conversation_id, m.seq, m.created_at,
+       ts_headline('simple', m.content, websearch_to_tsquery('simple', sqlc.arg(query)::TEXT),
+                   'StartSel=, StopSel=, MaxWords=25, MinWords=8, MaxFragments=2')::TEXT AS snippet
+FROM message_search s
+JOIN message m ON m.id = s.message_id
+JOIN conversation_member cm ON cm.conversation_id = m.conversation_id AND cm.user_id = sqlc.arg(user_id)::BIGINT
+WHERE s.search_vector @@ websearch_to_tsquery('simple', sqlc.arg(query)::TEXT)
+AND m.deleted_at IS NULL
+AND (sqlc.narg(from_user_id)::BIGINT IS NULL OR m.from_user_id = sqlc.narg(from_user_id)::BIGINT)
+AND (sqlc.narg(conversation_id)::BIGINT IS NULL OR m.conversation_id = sqlc.narg(conversation_id)::BIGINT)
+AND (sqlc.narg(since)::timestamptz IS NULL OR m.created_at >= sqlc.narg(since)::timestamptz)
+AND (sqlc.narg(until)::timestamptz IS NULL OR m.created_at < sqlc.narg(until)::timestamptz)
+AND (sqlc.narg(cursor_created_at)::timestamptz IS NULL
+     OR (m.created_at, m.id) < (sqlc.narg(cursor_created_at)::timestamptz, sqlc.narg(cursor_id)::BIGINT))
+ORDER BY m.created_at DESC, m.id DESC
+LIMIT sqlc.arg(page_limit)::INT;
@@ -0,0 +1,127 @@
+-- name: CreateConversation :one
+INSERT INTO conversation (name, is_group, created_by)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: CreateDirectConversation :one
+-- returns no row when another transaction created the conversation first
+INSERT INTO conversation (is_group, direct_key)
+VALUES (FALSE, $1)
+ON CONFLICT (direct_key) DO NOTHING
+RETURNING *;
+
+-- name: GetDirectConversation :one
+SELECT * FROM conversation WHERE direct_key = $1;
+
+-- name: GetConversationById :one
+SELECT * FROM conversation WHERE id = $1;
+
+-- name: NextConversationSeq :one
+-- the row lock taken here serializes the inserts of a conversation until their transaction ends
+UPDATE conversation
+SET last_seq = last_seq + 1
+WHERE id = $1
+RETURNING last_seq;
+
+-- name: RenameConversation :one
+UPDATE conversation
+SET name = $2, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING *;
+
+-- name: AddConversationMember :exec
+INSERT INTO conversation_member (conversation_id, user_id, role)
+VALUES ($1, $2, $3)
+ON CONFLICT (conversation_id, user_id) DO NOTHING;
+
+-- name: RemoveConversationMember :execrows
+DELETE FROM conversation_member
+WHERE conversation_id = $1 AND user_id = $2;
+
+-- name: GetConversationMember :one
+SELECT * FROM conversation_member
+WHERE conversation_id = $1 AND user_id = $2;
+
+-- name: ListConversationMembers :many
+SELECT * FROM conversation_member
+WHERE conversation_id = $1
+ORDER BY joined_at;
+
+-- name: ListConversationMemberIds :many
+SELECT user_id FROM conversation_member
+WHERE conversation_id = $1;
+
+-- name: PromoteOldestMember :exec
+UPDATE conversation_member
+SET role = 'admin'
+WHERE conversation_member.conversation_id = $1
+AND conversation_member.user_id = (
+    SELECT cm.user_id FROM conversation_member cm
+    WHERE cm.conversation_id = $1
+    ORDER BY cm.joined_at
+    LIMIT 1
+)
+AND NOT EXISTS (
+    SELECT 1 FROM conversation_member a
+    WHERE a.conversation_id = $1 AND a.role = 'admin'
+);
+
+-- name: ListPeerIds :many
+SELECT DISTINCT other.user_id
+FROM conversation_member mine
+JOIN conversation_member other ON other.conversation_id = mine.conversation_id
+WHERE mine.user_id = $1
+AND other.user_id <> $1;
+
+-- name: RecordConversationMessage :exec
+-- moves the conversation to the top of every member's inbox, the sender has nothing new to read
+UPDATE conversation_member
+SET last_activity_at = sqlc.arg(created_at)::timestamptz,
+    unread_count = unread_count + CASE WHEN user_id = sqlc.arg(sender_id)::BIGINT THEN 0 ELSE 1 END
+WHERE conversation_id = $1;
+
+-- name: SetConversationLastMessage :exec
+UPDATE conversation
+SET last_message_id = $2
+WHERE id = $1;
+
+-- name: DecrementUnreadCount :exec
+UPDATE conversation_member
+SET unread_count = GREATEST(unread_count - sqlc.arg(read)::INTEGER, 0)
+WHERE conversation_id = $1 AND user_id = $2;
+
+-- name: ListInbox :many
+SELECT c.id, c.name, c.is_group, c.last_seq, cm.unread_count, cm.last_activity_at,
+       m.id AS last_message_id, m.from_user_id AS last_message_from, m.content AS last_message_content,
+       m.created_at AS last_message_at, m.deleted_at AS last_message_deleted_at
+FROM conversation_member cm
+JOIN conversation c ON c.id = cm.conversation_id
+LEFT JOIN message m ON m.id = c.last_message_id
+WHERE cm.user_id = $1
+ORDER BY cm.last_activity_at DESC, cm.conversation_id DESC
+LIMIT $2;
+
+-- name: ListInboxBefore :many
+SELECT c.id, c.name, c.is_group, c.last_seq, cm.unread_count, cm.last_activity_at,
+       m.id AS last_message_id, m.from_user_id AS last_message_from, m.content AS last_message_content,
+       m.created_at AS last_message_at, m.deleted_at AS last_message_deleted_at
+FROM conversation_member cm
+JOIN conversation c ON c.id = cm.conversation_id
+LEFT JOIN message m ON m.id = c.last_message_id
+WHERE cm.user_id = $1
+AND (cm.last_activity_at, cm.conversation_id) < (sqlc.arg(cursor_activity_at)::timestamptz, sqlc.arg(cursor_id)::BIGINT)
+ORDER BY cm.last_activity_at DESC, cm.conversation_id DESC
+LIMIT $2;
+
+-- name: ListConversationPeers :many
+SELECT cm.conversation_id, u.id, u.username, u.display_name, u.users_photo_link, u.last_seen_at
+FROM conversation_member cm
+JOIN users u ON u.id = cm.user_id
+WHERE cm.conversation_id = ANY(sqlc.arg(conversation_ids)::BIGINT[])
+AND cm.user_id <> sqlc.arg(user_id)::BIGINT;
+
+-- name: CountConversationMembers :many
+SELECT conversation_id, COUNT(*) AS member_count
+FROM conversation_member
+WHERE conversation_id = ANY(sqlc.arg(conversation_ids)::BIGINT[])
+GROUP BY conversation_id;
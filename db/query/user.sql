@@ -10,4 +10,66 @@ SELECT * FROM users where id = $1;
 
 -- name: GetUserByEmail :one
 
-SELECT * FROM users where email = $1;
\ No newline at end of file
+SELECT * FROM users where email = $1;
+
+-- name: UpdateUserLastSeen :exec
+UPDATE users SET last_seen_at = $2 WHERE id = $1;
+
+-- name: ListUsersLastSeen :many
+SELECT id, last_seen_at FROM users
+WHERE id = ANY(sqlc.arg(user_ids)::BIGINT[]);
+
+-- name: UpdateUserProfile :one
+UPDATE users
+SET username = $2, display_name = $3, status_text = $4, bio = $5, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING *;
+
+-- name: UpdateUserPhoto :one
+UPDATE users
+SET users_photo_link = $2, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING *;
+
+-- name: SearchUsers :many
+-- prefix matches come first, then the closest fuzzy matches; the caller and the users blocking them are left out
+SELECT u.id, u.username, u.display_name, u.status_text, u.bio, u.users_photo_link
+FROM users u
+WHERE u.id <> sqlc.arg(user_id)::BIGINT
+AND (
+    lower(u.username) LIKE sqlc.arg(prefix)::TEXT
+    OR lower(u.display_name) LIKE sqlc.arg(prefix)::TEXT
+    OR sqlc.arg(query)::TEXT <% lower(u.username)
+    OR sqlc.arg(query)::TEXT <% lower(u.display_name)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_block b
+    WHERE b.blocker_id = u.id AND b.blocked_id = sqlc.arg(user_id)::BIGINT
+)
+ORDER BY
+    (lower(u.username) LIKE sqlc.arg(prefix)::TEXT OR lower(u.display_name) LIKE sqlc.arg(prefix)::TEXT) DESC,
+    GREATEST(word_similarity(sqlc.arg(query)::TEXT, lower(u.username)), word_similarity(sqlc.arg(query)::TEXT, lower(u.display_name))) DESC,
+    u.id
+LIMIT sqlc.arg(page_limit)::INT OFFSET sqlc.arg(page_offset)::INT;
+
+-- name: BlockUser :exec
+INSERT INTO user_block (blocker_id, blocked_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING;
+
+-- name: UnblockUser :exec
+DELETE FROM user_block
+WHERE blocker_id = $1 AND blocked_id = $2;
+
+-- name: ListBlockRelatedIds :many
+-- the users the given user blocked and the users who blocked them
+SELECT CASE WHEN blocker_id = sqlc.arg(user_id)::BIGINT THEN blocked_id ELSE blocker_id END::BIGINT AS user_id
+FROM user_block
+WHERE blocker_id = sqlc.arg(user_id)::BIGINT OR blocked_id = sqlc.arg(user_id)::BIGINT;
+
+-- name: ListBlockedUsers :many
+SELECT u.id, u.username, u.display_name, u.status_text, u.bio, u.users_photo_link
+FROM user_block b
+JOIN users u ON u.id = b.blocked_id
+WHERE b.blocker_id = $1
+ORDER BY b.created_at DESC;
@@ -0,0 +1,351 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.26.0
+// source: attachment.sql
+
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const attachToMessage = `-- name: AttachToMessage :many
+UPDATE attachment
+SET message_id = $1::BIGINT
+WHERE id = ANY($2::BIGINT[])
+AND uploader_id = $3::BIGINT
+AND message_id IS NULL
+RETURNING id, uploader_id, message_id, storage_key, filename, mime_type, size_bytes, checksum, created_at, width, height, processed_at
+`
+
+type AttachToMessageParams struct {
+	MessageID  int64   `json:"message_id"`
+	Ids        []int64 `json:"ids"`
+	UploaderID int64   `json:"uploader_id"`
+}
+
+// only the uploader can attach an upload, and only to one message
+func (q *Queries) AttachToMessage(ctx context.Context, arg AttachToMessageParams) ([]Attachment, error) {
+	rows, err := q.db.Query(ctx, attachToMessage, arg.MessageID, arg.Ids, arg.UploaderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Attachment{}
+	for rows.Next() {
+		var i Attachment
+		if err := rows.Scan(
+			&i.ID,
+			&i.UploaderID,
+			&i.MessageID,
+			&i.StorageKey,
+			&i.Filename,
+			&i.MimeType,
+			&i.SizeBytes,
+			&i.Checksum,
+			&i.CreatedAt,
+			&i.Width,
+			&i.Height,
+			&i.ProcessedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createAttachment = `-- name: CreateAttachment :one
+INSERT INTO attachment (uploader_id, storage_key, filename, mime_type, size_bytes, checksum)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, uploader_id, message_id, storage_key, filename, mime_type, size_bytes, checksum, created_at, width, height, processed_at
+`
+
+type CreateAttachmentParams struct {
+	UploaderID int64  `json:"uploader_id"`
+	StorageKey string `json:"storage_key"`
+	Filename   string `json:"filename"`
+	MimeType   string `json:"mime_type"`
+	SizeBytes  int64  `json:"size_bytes"`
+	Checksum   string `json:"checksum"`
+}
+
+func (q *Queries) CreateAttachment(ctx context.Context, arg CreateAttachmentParams) (Attachment, error) {
+	row := q.db.QueryRow(ctx, createAttachment,
+		arg.UploaderID,
+		arg.StorageKey,
+		arg.Filename,
+		arg.MimeType,
+		arg.SizeBytes,
+		arg.Checksum,
+	)
+	var i Attachment
+	err := row.Scan(
+		&i.ID,
+		&i.UploaderID,
+		&i.MessageID,
+		&i.StorageKey,
+		&i.Filename,
+		&i.MimeType,
+		&i.SizeBytes,
+		&i.Checksum,
+		&i.CreatedAt,
+		&i.Width,
+		&i.Height,
+		&i.ProcessedAt,
+	)
+	return i, err
+}
+
+const getAttachmentById = `-- name: GetAttachmentById :one
+SELECT id, uploader_id, message_id, storage_key, filename, mime_type, size_bytes, checksum, created_at, width, height, processed_at FROM attachment WHERE id = $1
+`
+
+func (q *Queries) GetAttachmentById(ctx context.Context, id int64) (Attachment, error) {
+	row := q.db.QueryRow(ctx, getAttachmentById, id)
+	var i Attachment
+	err := row.Scan(
+		&i.ID,
+		&i.UploaderID,
+		&i.MessageID,
+		&i.StorageKey,
+		&i.Filename,
+		&i.MimeType,
+		&i.SizeBytes,
+		&i.Checksum,
+		&i.CreatedAt,
+		&i.Width,
+		&i.Height,
+		&i.ProcessedAt,
+	)
+	return i, err
+}
+
+const getAttachmentThumbnail = `-- name: GetAttachmentThumbnail :one
+SELECT attachment_id, size, storage_key, width, height FROM attachment_thumbnail
+WHERE attachment_id = $1 AND size = $2
+`
+
+type GetAttachmentThumbnailParams struct {
+	AttachmentID int64  `json:"attachment_id"`
+	Size         string `json:"size"`
+}
+
+func (q *Queries) GetAttachmentThumbnail(ctx context.Context, arg GetAttachmentThumbnailParams) (AttachmentThumbnail, error) {
+	row := q.db.QueryRow(ctx, getAttachmentThumbnail, arg.AttachmentID, arg.Size)
+	var i AttachmentThumbnail
+	err := row.Scan(
+		&i.AttachmentID,
+		&i.Size,
+		&i.StorageKey,
+		&i.Width,
+		&i.Height,
+	)
+	return i, err
+}
+
+const listAttachmentsByMessageIds = `-- name: ListAttachmentsByMessageIds :many
+SELECT id, uploader_id, message_id, storage_key, filename, mime_type, size_bytes, checksum, created_at, width, height, processed_at FROM attachment
+WHERE message_id = ANY($1::BIGINT[])
+ORDER BY message_id, id
+`
+
+func (q *Queries) ListAttachmentsByMessageIds(ctx context.Context, messageIds []int64) ([]Attachment, error) {
+	rows, err := q.db.Query(ctx, listAttachmentsByMessageIds, messageIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Attachment{}
+	for rows.Next() {
+		var i Attachment
+		if err := rows.Scan(
+			&i.ID,
+			&i.UploaderID,
+			&i.MessageID,
+			&i.StorageKey,
+			&i.Filename,
+			&i.MimeType,
+			&i.SizeBytes,
+			&i.Checksum,
+			&i.CreatedAt,
+			&i.Width,
+			&i.Height,
+			&i.ProcessedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listThumbnailsByAttachmentIds = `-- name: ListThumbnailsByAttachmentIds :many
+SELECT attachment_id, size, storage_key, width, height FROM attachment_thumbnail
+WHERE attachment_id = ANY($1::BIGINT[])
+ORDER BY attachment_id, width
+`
+
+func (q *Queries) ListThumbnailsByAttachmentIds(ctx context.Context, attachmentIds []int64) ([]AttachmentThumbnail, error) {
+	rows, err := q.db.Query(ctx, listThumbnailsByAttachmentIds, attachmentIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []AttachmentThumbnail{}
+	for rows.Next() {
+		var i AttachmentThumbnail
+		if err := rows.Scan(
+			&i.AttachmentID,
+			&i.Size,
+			&i.StorageKey,
+			&i.Width,
+			&i.Height,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUnprocessedImages = `-- name: ListUnprocessedImages :many
+SELECT id FROM attachment
+WHERE processed_at IS NULL
+AND mime_type LIKE 'image/%'
+ORDER BY id
+`
+
+func (q *Queries) ListUnprocessedImages(ctx context.Context) ([]int64, error) {
+	rows, err := q.db.Query(ctx, listUnprocessedImages)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markAttachmentNotImage = `-- name: MarkAttachmentNotImage :one
+UPDATE attachment
+SET mime_type = 'application/octet-stream',
+    processed_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING id, uploader_id, message_id, storage_key, filename, mime_type, size_bytes, checksum, created_at, width, height, processed_at
+`
+
+// the content did not decode as the image type it was sniffed as
+func (q *Queries) MarkAttachmentNotImage(ctx context.Context, id int64) (Attachment, error) {
+	row := q.db.QueryRow(ctx, markAttachmentNotImage, id)
+	var i Attachment
+	err := row.Scan(
+		&i.ID,
+		&i.UploaderID,
+		&i.MessageID,
+		&i.StorageKey,
+		&i.Filename,
+		&i.MimeType,
+		&i.SizeBytes,
+		&i.Checksum,
+		&i.CreatedAt,
+		&i.Width,
+		&i.Height,
+		&i.ProcessedAt,
+	)
+	return i, err
+}
+
+const markAttachmentProcessed = `-- name: MarkAttachmentProcessed :one
+UPDATE attachment
+SET width = $1,
+    height = $2,
+    size_bytes = $3,
+    checksum = $4,
+    processed_at = CURRENT_TIMESTAMP
+WHERE id = $5
+RETURNING id, uploader_id, message_id, storage_key, filename, mime_type, size_bytes, checksum, created_at, width, height, processed_at
+`
+
+type MarkAttachmentProcessedParams struct {
+	Width     pgtype.Int4 `json:"width"`
+	Height    pgtype.Int4 `json:"height"`
+	SizeBytes int64       `json:"size_bytes"`
+	Checksum  string      `json:"checksum"`
+	ID        int64       `json:"id"`
+}
+
+// the content may have been rewritten without its location, so size and checksum are replaced too
+func (q *Queries) MarkAttachmentProcessed(ctx context.Context, arg MarkAttachmentProcessedParams) (Attachment, error) {
+	row := q.db.QueryRow(ctx, markAttachmentProcessed,
+		arg.Width,
+		arg.Height,
+		arg.SizeBytes,
+		arg.Checksum,
+		arg.ID,
+	)
+	var i Attachment
+	err := row.Scan(
+		&i.ID,
+		&i.UploaderID,
+		&i.MessageID,
+		&i.StorageKey,
+		&i.Filename,
+		&i.MimeType,
+		&i.SizeBytes,
+		&i.Checksum,
+		&i.CreatedAt,
+		&i.Width,
+		&i.Height,
+		&i.ProcessedAt,
+	)
+	return i, err
+}
+
+const upsertAttachmentThumbnail = `-- name: UpsertAttachmentThumbnail :exec
+INSERT INTO attachment_thumbnail (attachment_id, size, storage_key, width, height)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (attachment_id, size) DO UPDATE
+SET storage_key = EXCLUDED.storage_key,
+    width = EXCLUDED.width,
+    height = EXCLUDED.height
+`
+
+type UpsertAttachmentThumbnailParams struct {
+	AttachmentID int64  `json:"attachment_id"`
+	Size         string `json:"size"`
+	StorageKey   string `json:"storage_key"`
+	Width        int32  `json:"width"`
+	Height       int32  `json:"height"`
+}
+
+func (q *Queries) UpsertAttachmentThumbnail(ctx context.Context, arg UpsertAttachmentThumbnailParams) error {
+	_, err := q.db.Exec(ctx, upsertAttachmentThumbnail,
+		arg.AttachmentID,
+		arg.Size,
+		arg.StorageKey,
+		arg.Width,
+		arg.Height,
+	)
+	return err
+}
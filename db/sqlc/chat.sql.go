@@ -7,21 +7,265 @@ package db
 
 import (
 	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
-const getMessages = `-- name: GetMessages :many
-SELECT id, from_user_id, to_user_id, is_sent, content, created_at FROM message
-WHERE from_user_id = $1
-AND to_user_id = $2
+const addMessageReaction = `-- name: AddMessageReaction :execrows
+INSERT INTO message_reaction (message_id, user_id, emoji)
+VALUES ($1, $2, $3)
+ON CONFLICT (message_id, user_id, emoji) DO NOTHING
 `
 
-type GetMessagesParams struct {
-	FromUserID int64 `json:"from_user_id"`
-	ToUserID   int64 `json:"to_user_id"`
+type AddMessageReactionParams struct {
+	MessageID int64  `json:"message_id"`
+	UserID    int64  `json:"user_id"`
+	Emoji     string `json:"emoji"`
 }
 
-func (q *Queries) GetMessages(ctx context.Context, arg GetMessagesParams) ([]Message, error) {
-	rows, err := q.db.Query(ctx, getMessages, arg.FromUserID, arg.ToUserID)
+func (q *Queries) AddMessageReaction(ctx context.Context, arg AddMessageReactionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, addMessageReaction, arg.MessageID, arg.UserID, arg.Emoji)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const countMessageReactionEmojis = `-- name: CountMessageReactionEmojis :one
+SELECT COUNT(DISTINCT emoji) FROM message_reaction
+WHERE message_id = $1
+`
+
+func (q *Queries) CountMessageReactionEmojis(ctx context.Context, messageID int64) (int64, error) {
+	row := q.db.QueryRow(ctx, countMessageReactionEmojis, messageID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const deleteMessageEdits = `-- name: DeleteMessageEdits :exec
+DELETE FROM message_edit
+WHERE message_id = $1
+`
+
+func (q *Queries) DeleteMessageEdits(ctx context.Context, messageID int64) error {
+	_, err := q.db.Exec(ctx, deleteMessageEdits, messageID)
+	return err
+}
+
+const getMessageByClientId = `-- name: GetMessageByClientId :one
+SELECT id, from_user_id, to_user_id, is_sent, content, created_at, conversation_id, client_id, seq, edited_at, deleted_at, reply_to, reply_count, last_reply_at FROM message
+WHERE from_user_id = $1 AND client_id = $2
+`
+
+type GetMessageByClientIdParams struct {
+	FromUserID int64       `json:"from_user_id"`
+	ClientID   pgtype.Text `json:"client_id"`
+}
+
+func (q *Queries) GetMessageByClientId(ctx context.Context, arg GetMessageByClientIdParams) (Message, error) {
+	row := q.db.QueryRow(ctx, getMessageByClientId, arg.FromUserID, arg.ClientID)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.FromUserID,
+		&i.ToUserID,
+		&i.IsSent,
+		&i.Content,
+		&i.CreatedAt,
+		&i.ConversationID,
+		&i.ClientID,
+		&i.Seq,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ReplyTo,
+		&i.ReplyCount,
+		&i.LastReplyAt,
+	)
+	return i, err
+}
+
+const getMessageById = `-- name: GetMessageById :one
+SELECT id, from_user_id, to_user_id, is_sent, content, created_at, conversation_id, client_id, seq, edited_at, deleted_at, reply_to, reply_count, last_reply_at FROM message WHERE id = $1
+`
+
+func (q *Queries) GetMessageById(ctx context.Context, id int64) (Message, error) {
+	row := q.db.QueryRow(ctx, getMessageById, id)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.FromUserID,
+		&i.ToUserID,
+		&i.IsSent,
+		&i.Content,
+		&i.CreatedAt,
+		&i.ConversationID,
+		&i.ClientID,
+		&i.Seq,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ReplyTo,
+		&i.ReplyCount,
+		&i.LastReplyAt,
+	)
+	return i, err
+}
+
+const getMessageForUpdate = `-- name: GetMessageForUpdate :one
+SELECT id, from_user_id, to_user_id, is_sent, content, created_at, conversation_id, client_id, seq, edited_at, deleted_at, reply_to, reply_count, last_reply_at FROM message WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetMessageForUpdate(ctx context.Context, id int64) (Message, error) {
+	row := q.db.QueryRow(ctx, getMessageForUpdate, id)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.FromUserID,
+		&i.ToUserID,
+		&i.IsSent,
+		&i.Content,
+		&i.CreatedAt,
+		&i.ConversationID,
+		&i.ClientID,
+		&i.Seq,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ReplyTo,
+		&i.ReplyCount,
+		&i.LastReplyAt,
+	)
+	return i, err
+}
+
+const hasMessageReactionEmoji = `-- name: HasMessageReactionEmoji :one
+SELECT EXISTS (
+    SELECT 1 FROM message_reaction
+    WHERE message_id = $1 AND emoji = $2
+)
+`
+
+type HasMessageReactionEmojiParams struct {
+	MessageID int64  `json:"message_id"`
+	Emoji     string `json:"emoji"`
+}
+
+func (q *Queries) HasMessageReactionEmoji(ctx context.Context, arg HasMessageReactionEmojiParams) (bool, error) {
+	row := q.db.QueryRow(ctx, hasMessageReactionEmoji, arg.MessageID, arg.Emoji)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const insertMessage = `-- name: InsertMessage :one
+INSERT INTO message (from_user_id, to_user_id, conversation_id, is_sent, content, client_id, seq, reply_to)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (from_user_id, client_id) DO NOTHING
+RETURNING id, from_user_id, to_user_id, is_sent, content, created_at, conversation_id, client_id, seq, edited_at, deleted_at, reply_to, reply_count, last_reply_at
+`
+
+type InsertMessageParams struct {
+	FromUserID     int64       `json:"from_user_id"`
+	ToUserID       pgtype.Int8 `json:"to_user_id"`
+	ConversationID int64       `json:"conversation_id"`
+	IsSent         bool        `json:"is_sent"`
+	Content        string      `json:"content"`
+	ClientID       pgtype.Text `json:"client_id"`
+	Seq            int64       `json:"seq"`
+	ReplyTo        pgtype.Int8 `json:"reply_to"`
+}
+
+func (q *Queries) InsertMessage(ctx context.Context, arg InsertMessageParams) (Message, error) {
+	row := q.db.QueryRow(ctx, insertMessage,
+		arg.FromUserID,
+		arg.ToUserID,
+		arg.ConversationID,
+		arg.IsSent,
+		arg.Content,
+		arg.ClientID,
+		arg.Seq,
+		arg.ReplyTo,
+	)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.FromUserID,
+		&i.ToUserID,
+		&i.IsSent,
+		&i.Content,
+		&i.CreatedAt,
+		&i.ConversationID,
+		&i.ClientID,
+		&i.Seq,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ReplyTo,
+		&i.ReplyCount,
+		&i.LastReplyAt,
+	)
+	return i, err
+}
+
+const insertMessageEdit = `-- name: InsertMessageEdit :exec
+INSERT INTO message_edit (message_id, content)
+VALUES ($1, $2)
+`
+
+type InsertMessageEditParams struct {
+	MessageID int64  `json:"message_id"`
+	Content   string `json:"content"`
+}
+
+func (q *Queries) InsertMessageEdit(ctx context.Context, arg InsertMessageEditParams) error {
+	_, err := q.db.Exec(ctx, insertMessageEdit, arg.MessageID, arg.Content)
+	return err
+}
+
+const insertMessageRecipients = `-- name: InsertMessageRecipients :execrows
+INSERT INTO message_recipient (message_id, user_id)
+SELECT $1::BIGINT, cm.user_id
+FROM conversation_member cm
+WHERE cm.conversation_id = $2
+AND cm.user_id <> $3::BIGINT
+`
+
+type InsertMessageRecipientsParams struct {
+	MessageID      int64 `json:"message_id"`
+	ConversationID int64 `json:"conversation_id"`
+	SenderID       int64 `json:"sender_id"`
+}
+
+func (q *Queries) InsertMessageRecipients(ctx context.Context, arg InsertMessageRecipientsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, insertMessageRecipients, arg.MessageID, arg.ConversationID, arg.SenderID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const listConversationMessagesAfter = `-- name: ListConversationMessagesAfter :many
+SELECT id, from_user_id, to_user_id, is_sent, content, created_at, conversation_id, client_id, seq, edited_at, deleted_at, reply_to, reply_count, last_reply_at FROM message
+WHERE conversation_id = $1
+AND (created_at, id) > ($3::timestamptz, $4::BIGINT)
+ORDER BY created_at ASC, id ASC
+LIMIT $2
+`
+
+type ListConversationMessagesAfterParams struct {
+	ConversationID  int64     `json:"conversation_id"`
+	Limit           int32     `json:"limit"`
+	CursorCreatedAt time.Time `json:"cursor_created_at"`
+	CursorID        int64     `json:"cursor_id"`
+}
+
+func (q *Queries) ListConversationMessagesAfter(ctx context.Context, arg ListConversationMessagesAfterParams) ([]Message, error) {
+	rows, err := q.db.Query(ctx, listConversationMessagesAfter,
+		arg.ConversationID,
+		arg.Limit,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -36,6 +280,14 @@ func (q *Queries) GetMessages(ctx context.Context, arg GetMessagesParams) ([]Mes
 			&i.IsSent,
 			&i.Content,
 			&i.CreatedAt,
+			&i.ConversationID,
+			&i.ClientID,
+			&i.Seq,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ReplyTo,
+			&i.ReplyCount,
+			&i.LastReplyAt,
 		); err != nil {
 			return nil, err
 		}
@@ -47,26 +299,745 @@ func (q *Queries) GetMessages(ctx context.Context, arg GetMessagesParams) ([]Mes
 	return items, nil
 }
 
-const insertMessage = `-- name: InsertMessage :one
-INSERT INTO message (from_user_id, to_user_id, is_sent, content)
-VALUES ($1, $2, $3, $4)
-RETURNING id, from_user_id, to_user_id, is_sent, content, created_at
+const listConversationMessagesAfterSeq = `-- name: ListConversationMessagesAfterSeq :many
+SELECT id, from_user_id, to_user_id, is_sent, content, created_at, conversation_id, client_id, seq, edited_at, deleted_at, reply_to, reply_count, last_reply_at FROM message
+WHERE conversation_id = $1
+AND seq > $3::BIGINT
+ORDER BY seq
+LIMIT $2
 `
 
-type InsertMessageParams struct {
-	FromUserID int64  `json:"from_user_id"`
-	ToUserID   int64  `json:"to_user_id"`
-	IsSent     bool   `json:"is_sent"`
-	Content    string `json:"content"`
+type ListConversationMessagesAfterSeqParams struct {
+	ConversationID int64 `json:"conversation_id"`
+	Limit          int32 `json:"limit"`
+	AfterSeq       int64 `json:"after_seq"`
 }
 
-func (q *Queries) InsertMessage(ctx context.Context, arg InsertMessageParams) (Message, error) {
-	row := q.db.QueryRow(ctx, insertMessage,
+func (q *Queries) ListConversationMessagesAfterSeq(ctx context.Context, arg ListConversationMessagesAfterSeqParams) ([]Message, error) {
+	rows, err := q.db.Query(ctx, listConversationMessagesAfterSeq, arg.ConversationID, arg.Limit, arg.AfterSeq)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Message{}
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.FromUserID,
+			&i.ToUserID,
+			&i.IsSent,
+			&i.Content,
+			&i.CreatedAt,
+			&i.ConversationID,
+			&i.ClientID,
+			&i.Seq,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ReplyTo,
+			&i.ReplyCount,
+			&i.LastReplyAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listConversationMessagesBefore = `-- name: ListConversationMessagesBefore :many
+SELECT id, from_user_id, to_user_id, is_sent, content, created_at, conversation_id, client_id, seq, edited_at, deleted_at, reply_to, reply_count, last_reply_at FROM message
+WHERE conversation_id = $1
+AND (created_at, id) < ($3::timestamptz, $4::BIGINT)
+ORDER BY created_at DESC, id DESC
+LIMIT $2
+`
+
+type ListConversationMessagesBeforeParams struct {
+	ConversationID  int64     `json:"conversation_id"`
+	Limit           int32     `json:"limit"`
+	CursorCreatedAt time.Time `json:"cursor_created_at"`
+	CursorID        int64     `json:"cursor_id"`
+}
+
+func (q *Queries) ListConversationMessagesBefore(ctx context.Context, arg ListConversationMessagesBeforeParams) ([]Message, error) {
+	rows, err := q.db.Query(ctx, listConversationMessagesBefore,
+		arg.ConversationID,
+		arg.Limit,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Message{}
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.FromUserID,
+			&i.ToUserID,
+			&i.IsSent,
+			&i.Content,
+			&i.CreatedAt,
+			&i.ConversationID,
+			&i.ClientID,
+			&i.Seq,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ReplyTo,
+			&i.ReplyCount,
+			&i.LastReplyAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listLatestConversationMessages = `-- name: ListLatestConversationMessages :many
+SELECT id, from_user_id, to_user_id, is_sent, content, created_at, conversation_id, client_id, seq, edited_at, deleted_at, reply_to, reply_count, last_reply_at FROM message
+WHERE conversation_id = $1
+ORDER BY created_at DESC, id DESC
+LIMIT $2
+`
+
+type ListLatestConversationMessagesParams struct {
+	ConversationID int64 `json:"conversation_id"`
+	Limit          int32 `json:"limit"`
+}
+
+func (q *Queries) ListLatestConversationMessages(ctx context.Context, arg ListLatestConversationMessagesParams) ([]Message, error) {
+	rows, err := q.db.Query(ctx, listLatestConversationMessages, arg.ConversationID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Message{}
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.FromUserID,
+			&i.ToUserID,
+			&i.IsSent,
+			&i.Content,
+			&i.CreatedAt,
+			&i.ConversationID,
+			&i.ClientID,
+			&i.Seq,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ReplyTo,
+			&i.ReplyCount,
+			&i.LastReplyAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listMessageEdits = `-- name: ListMessageEdits :many
+SELECT id, message_id, content, replaced_at FROM message_edit
+WHERE message_id = $1
+ORDER BY id
+`
+
+func (q *Queries) ListMessageEdits(ctx context.Context, messageID int64) ([]MessageEdit, error) {
+	rows, err := q.db.Query(ctx, listMessageEdits, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []MessageEdit{}
+	for rows.Next() {
+		var i MessageEdit
+		if err := rows.Scan(
+			&i.ID,
+			&i.MessageID,
+			&i.Content,
+			&i.ReplacedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listMessageReceipts = `-- name: ListMessageReceipts :many
+SELECT message_id, user_id, delivered_at, read_at FROM message_recipient
+WHERE message_id = ANY($1::BIGINT[])
+ORDER BY message_id, user_id
+`
+
+func (q *Queries) ListMessageReceipts(ctx context.Context, messageIds []int64) ([]MessageRecipient, error) {
+	rows, err := q.db.Query(ctx, listMessageReceipts, messageIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []MessageRecipient{}
+	for rows.Next() {
+		var i MessageRecipient
+		if err := rows.Scan(
+			&i.MessageID,
+			&i.UserID,
+			&i.DeliveredAt,
+			&i.ReadAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listMessagesByIds = `-- name: ListMessagesByIds :many
+SELECT id, from_user_id, to_user_id, is_sent, content, created_at, conversation_id, client_id, seq, edited_at, deleted_at, reply_to, reply_count, last_reply_at FROM message
+WHERE id = ANY($1::BIGINT[])
+`
+
+func (q *Queries) ListMessagesByIds(ctx context.Context, ids []int64) ([]Message, error) {
+	rows, err := q.db.Query(ctx, listMessagesByIds, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Message{}
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.FromUserID,
+			&i.ToUserID,
+			&i.IsSent,
+			&i.Content,
+			&i.CreatedAt,
+			&i.ConversationID,
+			&i.ClientID,
+			&i.Seq,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ReplyTo,
+			&i.ReplyCount,
+			&i.LastReplyAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPendingMessages = `-- name: ListPendingMessages :many
+SELECT m.id, m.from_user_id, m.to_user_id, m.is_sent, m.content, m.created_at, m.conversation_id, m.client_id, m.seq, m.edited_at, m.deleted_at, m.reply_to, m.reply_count, m.last_reply_at FROM message m
+JOIN message_recipient r ON r.message_id = m.id
+JOIN conversation_member cm ON cm.conversation_id = m.conversation_id AND cm.user_id = r.user_id
+WHERE r.user_id = $1
+AND r.delivered_at IS NULL
+AND m.id > $3::BIGINT
+ORDER BY m.id
+LIMIT $2
+`
+
+type ListPendingMessagesParams struct {
+	UserID  int64 `json:"user_id"`
+	Limit   int32 `json:"limit"`
+	AfterID int64 `json:"after_id"`
+}
+
+// messages of conversations the user has left since are dropped
+func (q *Queries) ListPendingMessages(ctx context.Context, arg ListPendingMessagesParams) ([]Message, error) {
+	rows, err := q.db.Query(ctx, listPendingMessages, arg.UserID, arg.Limit, arg.AfterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Message{}
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.FromUserID,
+			&i.ToUserID,
+			&i.IsSent,
+			&i.Content,
+			&i.CreatedAt,
+			&i.ConversationID,
+			&i.ClientID,
+			&i.Seq,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ReplyTo,
+			&i.ReplyCount,
+			&i.LastReplyAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listReactionCounts = `-- name: ListReactionCounts :many
+SELECT message_id, emoji, COUNT(*) AS count, BOOL_OR(user_id = $1::BIGINT) AS reacted
+FROM message_reaction
+WHERE message_id = ANY($2::BIGINT[])
+GROUP BY message_id, emoji
+ORDER BY message_id, MIN(created_at)
+`
+
+type ListReactionCountsParams struct {
+	UserID     int64   `json:"user_id"`
+	MessageIds []int64 `json:"message_ids"`
+}
+
+type ListReactionCountsRow struct {
+	MessageID int64  `json:"message_id"`
+	Emoji     string `json:"emoji"`
+	Count     int64  `json:"count"`
+	Reacted   bool   `json:"reacted"`
+}
+
+func (q *Queries) ListReactionCounts(ctx context.Context, arg ListReactionCountsParams) ([]ListReactionCountsRow, error) {
+	rows, err := q.db.Query(ctx, listReactionCounts, arg.UserID, arg.MessageIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListReactionCountsRow{}
+	for rows.Next() {
+		var i ListReactionCountsRow
+		if err := rows.Scan(
+			&i.MessageID,
+			&i.Emoji,
+			&i.Count,
+			&i.Reacted,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listThreadReplies = `-- name: ListThreadReplies :many
+SELECT id, from_user_id, to_user_id, is_sent, content, created_at, conversation_id, client_id, seq, edited_at, deleted_at, reply_to, reply_count, last_reply_at FROM message
+WHERE reply_to = $1
+ORDER BY created_at ASC, id ASC
+LIMIT $2
+`
+
+type ListThreadRepliesParams struct {
+	ReplyTo pgtype.Int8 `json:"reply_to"`
+	Limit   int32       `json:"limit"`
+}
+
+func (q *Queries) ListThreadReplies(ctx context.Context, arg ListThreadRepliesParams) ([]Message, error) {
+	rows, err := q.db.Query(ctx, listThreadReplies, arg.ReplyTo, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Message{}
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.FromUserID,
+			&i.ToUserID,
+			&i.IsSent,
+			&i.Content,
+			&i.CreatedAt,
+			&i.ConversationID,
+			&i.ClientID,
+			&i.Seq,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ReplyTo,
+			&i.ReplyCount,
+			&i.LastReplyAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listThreadRepliesAfter = `-- name: ListThreadRepliesAfter :many
+SELECT id, from_user_id, to_user_id, is_sent, content, created_at, conversation_id, client_id, seq, edited_at, deleted_at, reply_to, reply_count, last_reply_at FROM message
+WHERE reply_to = $1
+AND (created_at, id) > ($3::timestamptz, $4::BIGINT)
+ORDER BY created_at ASC, id ASC
+LIMIT $2
+`
+
+type ListThreadRepliesAfterParams struct {
+	ReplyTo         pgtype.Int8 `json:"reply_to"`
+	Limit           int32       `json:"limit"`
+	CursorCreatedAt time.Time   `json:"cursor_created_at"`
+	CursorID        int64       `json:"cursor_id"`
+}
+
+func (q *Queries) ListThreadRepliesAfter(ctx context.Context, arg ListThreadRepliesAfterParams) ([]Message, error) {
+	rows, err := q.db.Query(ctx, listThreadRepliesAfter,
+		arg.ReplyTo,
+		arg.Limit,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Message{}
+	for rows.Next() {
+		var i Message
+		if err := rows.Scan(
+			&i.ID,
+			&i.FromUserID,
+			&i.ToUserID,
+			&i.IsSent,
+			&i.Content,
+			&i.CreatedAt,
+			&i.ConversationID,
+			&i.ClientID,
+			&i.Seq,
+			&i.EditedAt,
+			&i.DeletedAt,
+			&i.ReplyTo,
+			&i.ReplyCount,
+			&i.LastReplyAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markConversationRead = `-- name: MarkConversationRead :many
+UPDATE message_recipient r
+SET read_at = CURRENT_TIMESTAMP,
+    delivered_at = COALESCE(r.delivered_at, CURRENT_TIMESTAMP)
+FROM message m
+WHERE m.id = r.message_id
+AND r.user_id = $1
+AND m.conversation_id = $2
+AND m.id <= $3
+AND r.read_at IS NULL
+RETURNING r.message_id, m.from_user_id
+`
+
+type MarkConversationReadParams struct {
+	UserID         int64 `json:"user_id"`
+	ConversationID int64 `json:"conversation_id"`
+	UpToMessageID  int64 `json:"up_to_message_id"`
+}
+
+type MarkConversationReadRow struct {
+	MessageID  int64 `json:"message_id"`
+	FromUserID int64 `json:"from_user_id"`
+}
+
+func (q *Queries) MarkConversationRead(ctx context.Context, arg MarkConversationReadParams) ([]MarkConversationReadRow, error) {
+	rows, err := q.db.Query(ctx, markConversationRead, arg.UserID, arg.ConversationID, arg.UpToMessageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []MarkConversationReadRow{}
+	for rows.Next() {
+		var i MarkConversationReadRow
+		if err := rows.Scan(&i.MessageID, &i.FromUserID); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markMessageSent = `-- name: MarkMessageSent :exec
+UPDATE message
+SET is_sent = TRUE
+WHERE id = $1
+AND NOT EXISTS (
+    SELECT 1 FROM message_recipient
+    WHERE message_id = $1 AND delivered_at IS NULL
+)
+`
+
+func (q *Queries) MarkMessageSent(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, markMessageSent, id)
+	return err
+}
+
+const markMessagesDelivered = `-- name: MarkMessagesDelivered :many
+UPDATE message_recipient
+SET delivered_at = CURRENT_TIMESTAMP
+WHERE message_id = ANY($1::BIGINT[])
+AND user_id = $2
+AND delivered_at IS NULL
+RETURNING message_id
+`
+
+type MarkMessagesDeliveredParams struct {
+	MessageIds []int64 `json:"message_ids"`
+	UserID     int64   `json:"user_id"`
+}
+
+// returns the messages whose delivery to the user was not recorded yet
+func (q *Queries) MarkMessagesDelivered(ctx context.Context, arg MarkMessagesDeliveredParams) ([]int64, error) {
+	rows, err := q.db.Query(ctx, markMessagesDelivered, arg.MessageIds, arg.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []int64{}
+	for rows.Next() {
+		var message_id int64
+		if err := rows.Scan(&message_id); err != nil {
+			return nil, err
+		}
+		items = append(items, message_id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markMessagesSent = `-- name: MarkMessagesSent :exec
+UPDATE message m
+SET is_sent = TRUE
+WHERE m.id = ANY($1::BIGINT[])
+AND NOT EXISTS (
+    SELECT 1 FROM message_recipient r
+    WHERE r.message_id = m.id AND r.delivered_at IS NULL
+)
+`
+
+func (q *Queries) MarkMessagesSent(ctx context.Context, messageIds []int64) error {
+	_, err := q.db.Exec(ctx, markMessagesSent, messageIds)
+	return err
+}
+
+const recordMessageReply = `-- name: RecordMessageReply :exec
+UPDATE message
+SET reply_count = reply_count + 1, last_reply_at = $2::timestamptz
+WHERE id = $1
+`
+
+type RecordMessageReplyParams struct {
+	ID        int64     `json:"id"`
+	RepliedAt time.Time `json:"replied_at"`
+}
+
+func (q *Queries) RecordMessageReply(ctx context.Context, arg RecordMessageReplyParams) error {
+	_, err := q.db.Exec(ctx, recordMessageReply, arg.ID, arg.RepliedAt)
+	return err
+}
+
+const recountMessageReplies = `-- name: RecountMessageReplies :exec
+UPDATE message p
+SET reply_count = (
+        SELECT COUNT(*) FROM message r
+        WHERE r.reply_to = p.id AND r.deleted_at IS NULL
+    ),
+    last_reply_at = (
+        SELECT MAX(r.created_at) FROM message r
+        WHERE r.reply_to = p.id AND r.deleted_at IS NULL
+    )
+WHERE p.id = $1
+`
+
+// runs after a reply of the message was deleted, deleted replies do not count
+func (q *Queries) RecountMessageReplies(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, recountMessageReplies, id)
+	return err
+}
+
+const removeMessageReaction = `-- name: RemoveMessageReaction :execrows
+DELETE FROM message_reaction
+WHERE message_id = $1 AND user_id = $2 AND emoji = $3
+`
+
+type RemoveMessageReactionParams struct {
+	MessageID int64  `json:"message_id"`
+	UserID    int64  `json:"user_id"`
+	Emoji     string `json:"emoji"`
+}
+
+func (q *Queries) RemoveMessageReaction(ctx context.Context, arg RemoveMessageReactionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, removeMessageReaction, arg.MessageID, arg.UserID, arg.Emoji)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const searchMessages = `-- name: SearchMessages :many
+SELECT m.id, m.from_user_id, m.conversation_id, m.seq, m.created_at,
+       ts_headline('simple', m.content, websearch_to_tsquery('simple', $1::TEXT),
+                   'StartSel=, StopSel=, MaxWords=25, MinWords=8, MaxFragments=2')::TEXT AS snippet
+FROM message_search s
+JOIN message m ON m.id = s.message_id
+JOIN conversation_member cm ON cm.conversation_id = m.conversation_id AND cm.user_id = $2::BIGINT
+WHERE s.search_vector @@ websearch_to_tsquery('simple', $1::TEXT)
+AND m.deleted_at IS NULL
+AND ($3::BIGINT IS NULL OR m.from_user_id = $3::BIGINT)
+AND ($4::BIGINT IS NULL OR m.conversation_id = $4::BIGINT)
+AND ($5::timestamptz IS NULL OR m.created_at >= $5::timestamptz)
+AND ($6::timestamptz IS NULL OR m.created_at < $6::timestamptz)
+AND ($7::timestamptz IS NULL
+     OR (m.created_at, m.id) < ($7::timestamptz, $8::BIGINT))
+ORDER BY m.created_at DESC, m.id DESC
+LIMIT $9::INT
+`
+
+type SearchMessagesParams struct {
+	Query           string             `json:"query"`
+	UserID          int64              `json:"user_id"`
+	FromUserID      pgtype.Int8        `json:"from_user_id"`
+	ConversationID  pgtype.Int8        `json:"conversation_id"`
+	Since           pgtype.Timestamptz `json:"since"`
+	Until           pgtype.Timestamptz `json:"until"`
+	CursorCreatedAt pgtype.Timestamptz `json:"cursor_created_at"`
+	CursorID        pgtype.Int8        `json:"cursor_id"`
+	PageLimit       int32              `json:"page_limit"`
+}
+
+type SearchMessagesRow struct {
+	ID             int64              `json:"id"`
+	FromUserID     int64              `json:"from_user_id"`
+	ConversationID int64              `json:"conversation_id"`
+	Seq            int64              `json:"seq"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	Snippet        string             `json:"snippet"`
+}
+
+// newest matches first in the conversations the user is a member of. The query takes the web search syntax:
+// "quoted phrases", or, and -excluded words. The snippet marks the matches with U+E000 and U+E001,
+// which the handler turns into <mark> tags once the content is HTML escaped.
+func (q *Queries) SearchMessages(ctx context.Context, arg SearchMessagesParams) ([]SearchMessagesRow, error) {
+	rows, err := q.db.Query(ctx, searchMessages,
+		arg.Query,
+		arg.UserID,
 		arg.FromUserID,
-		arg.ToUserID,
-		arg.IsSent,
-		arg.Content,
+		arg.ConversationID,
+		arg.Since,
+		arg.Until,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageLimit,
 	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []SearchMessagesRow{}
+	for rows.Next() {
+		var i SearchMessagesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.FromUserID,
+			&i.ConversationID,
+			&i.Seq,
+			&i.CreatedAt,
+			&i.Snippet,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const softDeleteMessage = `-- name: SoftDeleteMessage :one
+UPDATE message
+SET content = '', deleted_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING id, from_user_id, to_user_id, is_sent, content, created_at, conversation_id, client_id, seq, edited_at, deleted_at, reply_to, reply_count, last_reply_at
+`
+
+func (q *Queries) SoftDeleteMessage(ctx context.Context, id int64) (Message, error) {
+	row := q.db.QueryRow(ctx, softDeleteMessage, id)
+	var i Message
+	err := row.Scan(
+		&i.ID,
+		&i.FromUserID,
+		&i.ToUserID,
+		&i.IsSent,
+		&i.Content,
+		&i.CreatedAt,
+		&i.ConversationID,
+		&i.ClientID,
+		&i.Seq,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ReplyTo,
+		&i.ReplyCount,
+		&i.LastReplyAt,
+	)
+	return i, err
+}
+
+const updateMessageContent = `-- name: UpdateMessageContent :one
+UPDATE message
+SET content = $2, edited_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING id, from_user_id, to_user_id, is_sent, content, created_at, conversation_id, client_id, seq, edited_at, deleted_at, reply_to, reply_count, last_reply_at
+`
+
+type UpdateMessageContentParams struct {
+	ID      int64  `json:"id"`
+	Content string `json:"content"`
+}
+
+func (q *Queries) UpdateMessageContent(ctx context.Context, arg UpdateMessageContentParams) (Message, error) {
+	row := q.db.QueryRow(ctx, updateMessageContent, arg.ID, arg.Content)
 	var i Message
 	err := row.Scan(
 		&i.ID,
@@ -75,6 +1046,14 @@ func (q *Queries) InsertMessage(ctx context.Context, arg InsertMessageParams) (M
 		&i.IsSent,
 		&i.Content,
 		&i.CreatedAt,
+		&i.ConversationID,
+		&i.ClientID,
+		&i.Seq,
+		&i.EditedAt,
+		&i.DeletedAt,
+		&i.ReplyTo,
+		&i.ReplyCount,
+		&i.LastReplyAt,
 	)
 	return i, err
 }
@@ -0,0 +1,586 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.26.0
+// source: conversation.sql
+
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const addConversationMember = `-- name: AddConversationMember :exec
+INSERT INTO conversation_member (conversation_id, user_id, role)
+VALUES ($1, $2, $3)
+ON CONFLICT (conversation_id, user_id) DO NOTHING
+`
+
+type AddConversationMemberParams struct {
+	ConversationID int64  `json:"conversation_id"`
+	UserID         int64  `json:"user_id"`
+	Role           string `json:"role"`
+}
+
+func (q *Queries) AddConversationMember(ctx context.Context, arg AddConversationMemberParams) error {
+	_, err := q.db.Exec(ctx, addConversationMember, arg.ConversationID, arg.UserID, arg.Role)
+	return err
+}
+
+const countConversationMembers = `-- name: CountConversationMembers :many
+SELECT conversation_id, COUNT(*) AS member_count
+FROM conversation_member
+WHERE conversation_id = ANY($1::BIGINT[])
+GROUP BY conversation_id
+`
+
+type CountConversationMembersRow struct {
+	ConversationID int64 `json:"conversation_id"`
+	MemberCount    int64 `json:"member_count"`
+}
+
+func (q *Queries) CountConversationMembers(ctx context.Context, conversationIds []int64) ([]CountConversationMembersRow, error) {
+	rows, err := q.db.Query(ctx, countConversationMembers, conversationIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CountConversationMembersRow{}
+	for rows.Next() {
+		var i CountConversationMembersRow
+		if err := rows.Scan(&i.ConversationID, &i.MemberCount); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createConversation = `-- name: CreateConversation :one
+INSERT INTO conversation (name, is_group, created_by)
+VALUES ($1, $2, $3)
+RETURNING id, name, is_group, direct_key, created_by, created_at, updated_at, last_seq, last_message_id
+`
+
+type CreateConversationParams struct {
+	Name      pgtype.Text `json:"name"`
+	IsGroup   bool        `json:"is_group"`
+	CreatedBy pgtype.Int8 `json:"created_by"`
+}
+
+func (q *Queries) CreateConversation(ctx context.Context, arg CreateConversationParams) (Conversation, error) {
+	row := q.db.QueryRow(ctx, createConversation, arg.Name, arg.IsGroup, arg.CreatedBy)
+	var i Conversation
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.IsGroup,
+		&i.DirectKey,
+		&i.CreatedBy,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.LastSeq,
+		&i.LastMessageID,
+	)
+	return i, err
+}
+
+const createDirectConversation = `-- name: CreateDirectConversation :one
+INSERT INTO conversation (is_group, direct_key)
+VALUES (FALSE, $1)
+ON CONFLICT (direct_key) DO NOTHING
+RETURNING id, name, is_group, direct_key, created_by, created_at, updated_at, last_seq, last_message_id
+`
+
+// returns no row when another transaction created the conversation first
+func (q *Queries) CreateDirectConversation(ctx context.Context, directKey pgtype.Text) (Conversation, error) {
+	row := q.db.QueryRow(ctx, createDirectConversation, directKey)
+	var i Conversation
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.IsGroup,
+		&i.DirectKey,
+		&i.CreatedBy,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.LastSeq,
+		&i.LastMessageID,
+	)
+	return i, err
+}
+
+const decrementUnreadCount = `-- name: DecrementUnreadCount :exec
+UPDATE conversation_member
+SET unread_count = GREATEST(unread_count - $3::INTEGER, 0)
+WHERE conversation_id = $1 AND user_id = $2
+`
+
+type DecrementUnreadCountParams struct {
+	ConversationID int64 `json:"conversation_id"`
+	UserID         int64 `json:"user_id"`
+	Read           int32 `json:"read"`
+}
+
+func (q *Queries) DecrementUnreadCount(ctx context.Context, arg DecrementUnreadCountParams) error {
+	_, err := q.db.Exec(ctx, decrementUnreadCount, arg.ConversationID, arg.UserID, arg.Read)
+	return err
+}
+
+const getConversationById = `-- name: GetConversationById :one
+SELECT id, name, is_group, direct_key, created_by, created_at, updated_at, last_seq, last_message_id FROM conversation WHERE id = $1
+`
+
+func (q *Queries) GetConversationById(ctx context.Context, id int64) (Conversation, error) {
+	row := q.db.QueryRow(ctx, getConversationById, id)
+	var i Conversation
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.IsGroup,
+		&i.DirectKey,
+		&i.CreatedBy,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.LastSeq,
+		&i.LastMessageID,
+	)
+	return i, err
+}
+
+const getConversationMember = `-- name: GetConversationMember :one
+SELECT conversation_id, user_id, role, joined_at, last_activity_at, unread_count FROM conversation_member
+WHERE conversation_id = $1 AND user_id = $2
+`
+
+type GetConversationMemberParams struct {
+	ConversationID int64 `json:"conversation_id"`
+	UserID         int64 `json:"user_id"`
+}
+
+func (q *Queries) GetConversationMember(ctx context.Context, arg GetConversationMemberParams) (ConversationMember, error) {
+	row := q.db.QueryRow(ctx, getConversationMember, arg.ConversationID, arg.UserID)
+	var i ConversationMember
+	err := row.Scan(
+		&i.ConversationID,
+		&i.UserID,
+		&i.Role,
+		&i.JoinedAt,
+		&i.LastActivityAt,
+		&i.UnreadCount,
+	)
+	return i, err
+}
+
+const getDirectConversation = `-- name: GetDirectConversation :one
+SELECT id, name, is_group, direct_key, created_by, created_at, updated_at, last_seq, last_message_id FROM conversation WHERE direct_key = $1
+`
+
+func (q *Queries) GetDirectConversation(ctx context.Context, directKey pgtype.Text) (Conversation, error) {
+	row := q.db.QueryRow(ctx, getDirectConversation, directKey)
+	var i Conversation
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.IsGroup,
+		&i.DirectKey,
+		&i.CreatedBy,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.LastSeq,
+		&i.LastMessageID,
+	)
+	return i, err
+}
+
+const listConversationMemberIds = `-- name: ListConversationMemberIds :many
+SELECT user_id FROM conversation_member
+WHERE conversation_id = $1
+`
+
+func (q *Queries) ListConversationMemberIds(ctx context.Context, conversationID int64) ([]int64, error) {
+	rows, err := q.db.Query(ctx, listConversationMemberIds, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []int64{}
+	for rows.Next() {
+		var user_id int64
+		if err := rows.Scan(&user_id); err != nil {
+			return nil, err
+		}
+		items = append(items, user_id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listConversationMembers = `-- name: ListConversationMembers :many
+SELECT conversation_id, user_id, role, joined_at, last_activity_at, unread_count FROM conversation_member
+WHERE conversation_id = $1
+ORDER BY joined_at
+`
+
+func (q *Queries) ListConversationMembers(ctx context.Context, conversationID int64) ([]ConversationMember, error) {
+	rows, err := q.db.Query(ctx, listConversationMembers, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ConversationMember{}
+	for rows.Next() {
+		var i ConversationMember
+		if err := rows.Scan(
+			&i.ConversationID,
+			&i.UserID,
+			&i.Role,
+			&i.JoinedAt,
+			&i.LastActivityAt,
+			&i.UnreadCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listConversationPeers = `-- name: ListConversationPeers :many
+SELECT cm.conversation_id, u.id, u.username, u.display_name, u.users_photo_link, u.last_seen_at
+FROM conversation_member cm
+JOIN users u ON u.id = cm.user_id
+WHERE cm.conversation_id = ANY($1::BIGINT[])
+AND cm.user_id <> $2::BIGINT
+`
+
+type ListConversationPeersParams struct {
+	ConversationIds []int64 `json:"conversation_ids"`
+	UserID          int64   `json:"user_id"`
+}
+
+type ListConversationPeersRow struct {
+	ConversationID int64              `json:"conversation_id"`
+	ID             int64              `json:"id"`
+	Username       string             `json:"username"`
+	DisplayName    string             `json:"display_name"`
+	UsersPhotoLink pgtype.Text        `json:"users_photo_link"`
+	LastSeenAt     pgtype.Timestamptz `json:"last_seen_at"`
+}
+
+func (q *Queries) ListConversationPeers(ctx context.Context, arg ListConversationPeersParams) ([]ListConversationPeersRow, error) {
+	rows, err := q.db.Query(ctx, listConversationPeers, arg.ConversationIds, arg.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListConversationPeersRow{}
+	for rows.Next() {
+		var i ListConversationPeersRow
+		if err := rows.Scan(
+			&i.ConversationID,
+			&i.ID,
+			&i.Username,
+			&i.DisplayName,
+			&i.UsersPhotoLink,
+			&i.LastSeenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listInbox = `-- name: ListInbox :many
+SELECT c.id, c.name, c.is_group, c.last_seq, cm.unread_count, cm.last_activity_at,
+       m.id AS last_message_id, m.from_user_id AS last_message_from, m.content AS last_message_content,
+       m.created_at AS last_message_at, m.deleted_at AS last_message_deleted_at
+FROM conversation_member cm
+JOIN conversation c ON c.id = cm.conversation_id
+LEFT JOIN message m ON m.id = c.last_message_id
+WHERE cm.user_id = $1
+ORDER BY cm.last_activity_at DESC, cm.conversation_id DESC
+LIMIT $2
+`
+
+type ListInboxParams struct {
+	UserID int64 `json:"user_id"`
+	Limit  int32 `json:"limit"`
+}
+
+type ListInboxRow struct {
+	ID                   int64              `json:"id"`
+	Name                 pgtype.Text        `json:"name"`
+	IsGroup              bool               `json:"is_group"`
+	LastSeq              int64              `json:"last_seq"`
+	UnreadCount          int32              `json:"unread_count"`
+	LastActivityAt       pgtype.Timestamptz `json:"last_activity_at"`
+	LastMessageID        pgtype.Int8        `json:"last_message_id"`
+	LastMessageFrom      pgtype.Int8        `json:"last_message_from"`
+	LastMessageContent   pgtype.Text        `json:"last_message_content"`
+	LastMessageAt        pgtype.Timestamptz `json:"last_message_at"`
+	LastMessageDeletedAt pgtype.Timestamptz `json:"last_message_deleted_at"`
+}
+
+func (q *Queries) ListInbox(ctx context.Context, arg ListInboxParams) ([]ListInboxRow, error) {
+	rows, err := q.db.Query(ctx, listInbox, arg.UserID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListInboxRow{}
+	for rows.Next() {
+		var i ListInboxRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.IsGroup,
+			&i.LastSeq,
+			&i.UnreadCount,
+			&i.LastActivityAt,
+			&i.LastMessageID,
+			&i.LastMessageFrom,
+			&i.LastMessageContent,
+			&i.LastMessageAt,
+			&i.LastMessageDeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listInboxBefore = `-- name: ListInboxBefore :many
+SELECT c.id, c.name, c.is_group, c.last_seq, cm.unread_count, cm.last_activity_at,
+       m.id AS last_message_id, m.from_user_id AS last_message_from, m.content AS last_message_content,
+       m.created_at AS last_message_at, m.deleted_at AS last_message_deleted_at
+FROM conversation_member cm
+JOIN conversation c ON c.id = cm.conversation_id
+LEFT JOIN message m ON m.id = c.last_message_id
+WHERE cm.user_id = $1
+AND (cm.last_activity_at, cm.conversation_id) < ($3::timestamptz, $4::BIGINT)
+ORDER BY cm.last_activity_at DESC, cm.conversation_id DESC
+LIMIT $2
+`
+
+type ListInboxBeforeParams struct {
+	UserID           int64     `json:"user_id"`
+	Limit            int32     `json:"limit"`
+	CursorActivityAt time.Time `json:"cursor_activity_at"`
+	CursorID         int64     `json:"cursor_id"`
+}
+
+type ListInboxBeforeRow struct {
+	ID                   int64              `json:"id"`
+	Name                 pgtype.Text        `json:"name"`
+	IsGroup              bool               `json:"is_group"`
+	LastSeq              int64              `json:"last_seq"`
+	UnreadCount          int32              `json:"unread_count"`
+	LastActivityAt       pgtype.Timestamptz `json:"last_activity_at"`
+	LastMessageID        pgtype.Int8        `json:"last_message_id"`
+	LastMessageFrom      pgtype.Int8        `json:"last_message_from"`
+	LastMessageContent   pgtype.Text        `json:"last_message_content"`
+	LastMessageAt        pgtype.Timestamptz `json:"last_message_at"`
+	LastMessageDeletedAt pgtype.Timestamptz `json:"last_message_deleted_at"`
+}
+
+func (q *Queries) ListInboxBefore(ctx context.Context, arg ListInboxBeforeParams) ([]ListInboxBeforeRow, error) {
+	rows, err := q.db.Query(ctx, listInboxBefore,
+		arg.UserID,
+		arg.Limit,
+		arg.CursorActivityAt,
+		arg.CursorID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListInboxBeforeRow{}
+	for rows.Next() {
+		var i ListInboxBeforeRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.IsGroup,
+			&i.LastSeq,
+			&i.UnreadCount,
+			&i.LastActivityAt,
+			&i.LastMessageID,
+			&i.LastMessageFrom,
+			&i.LastMessageContent,
+			&i.LastMessageAt,
+			&i.LastMessageDeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPeerIds = `-- name: ListPeerIds :many
+SELECT DISTINCT other.user_id
+FROM conversation_member mine
+JOIN conversation_member other ON other.conversation_id = mine.conversation_id
+WHERE mine.user_id = $1
+AND other.user_id <> $1
+`
+
+func (q *Queries) ListPeerIds(ctx context.Context, userID int64) ([]int64, error) {
+	rows, err := q.db.Query(ctx, listPeerIds, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []int64{}
+	for rows.Next() {
+		var user_id int64
+		if err := rows.Scan(&user_id); err != nil {
+			return nil, err
+		}
+		items = append(items, user_id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const nextConversationSeq = `-- name: NextConversationSeq :one
+UPDATE conversation
+SET last_seq = last_seq + 1
+WHERE id = $1
+RETURNING last_seq
+`
+
+// the row lock taken here serializes the inserts of a conversation until their transaction ends
+func (q *Queries) NextConversationSeq(ctx context.Context, id int64) (int64, error) {
+	row := q.db.QueryRow(ctx, nextConversationSeq, id)
+	var last_seq int64
+	err := row.Scan(&last_seq)
+	return last_seq, err
+}
+
+const promoteOldestMember = `-- name: PromoteOldestMember :exec
+UPDATE conversation_member
+SET role = 'admin'
+WHERE conversation_member.conversation_id = $1
+AND conversation_member.user_id = (
+    SELECT cm.user_id FROM conversation_member cm
+    WHERE cm.conversation_id = $1
+    ORDER BY cm.joined_at
+    LIMIT 1
+)
+AND NOT EXISTS (
+    SELECT 1 FROM conversation_member a
+    WHERE a.conversation_id = $1 AND a.role = 'admin'
+)
+`
+
+func (q *Queries) PromoteOldestMember(ctx context.Context, conversationID int64) error {
+	_, err := q.db.Exec(ctx, promoteOldestMember, conversationID)
+	return err
+}
+
+const recordConversationMessage = `-- name: RecordConversationMessage :exec
+UPDATE conversation_member
+SET last_activity_at = $2::timestamptz,
+    unread_count = unread_count + CASE WHEN user_id = $3::BIGINT THEN 0 ELSE 1 END
+WHERE conversation_id = $1
+`
+
+type RecordConversationMessageParams struct {
+	ConversationID int64     `json:"conversation_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	SenderID       int64     `json:"sender_id"`
+}
+
+// moves the conversation to the top of every member's inbox, the sender has nothing new to read
+func (q *Queries) RecordConversationMessage(ctx context.Context, arg RecordConversationMessageParams) error {
+	_, err := q.db.Exec(ctx, recordConversationMessage, arg.ConversationID, arg.CreatedAt, arg.SenderID)
+	return err
+}
+
+const removeConversationMember = `-- name: RemoveConversationMember :execrows
+DELETE FROM conversation_member
+WHERE conversation_id = $1 AND user_id = $2
+`
+
+type RemoveConversationMemberParams struct {
+	ConversationID int64 `json:"conversation_id"`
+	UserID         int64 `json:"user_id"`
+}
+
+func (q *Queries) RemoveConversationMember(ctx context.Context, arg RemoveConversationMemberParams) (int64, error) {
+	result, err := q.db.Exec(ctx, removeConversationMember, arg.ConversationID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const renameConversation = `-- name: RenameConversation :one
+UPDATE conversation
+SET name = $2, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING id, name, is_group, direct_key, created_by, created_at, updated_at, last_seq, last_message_id
+`
+
+type RenameConversationParams struct {
+	ID   int64       `json:"id"`
+	Name pgtype.Text `json:"name"`
+}
+
+func (q *Queries) RenameConversation(ctx context.Context, arg RenameConversationParams) (Conversation, error) {
+	row := q.db.QueryRow(ctx, renameConversation, arg.ID, arg.Name)
+	var i Conversation
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.IsGroup,
+		&i.DirectKey,
+		&i.CreatedBy,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.LastSeq,
+		&i.LastMessageID,
+	)
+	return i, err
+}
+
+const setConversationLastMessage = `-- name: SetConversationLastMessage :exec
+UPDATE conversation
+SET last_message_id = $2
+WHERE id = $1
+`
+
+type SetConversationLastMessageParams struct {
+	ID            int64       `json:"id"`
+	LastMessageID pgtype.Int8 `json:"last_message_id"`
+}
+
+func (q *Queries) SetConversationLastMessage(ctx context.Context, arg SetConversationLastMessageParams) error {
+	_, err := q.db.Exec(ctx, setConversationLastMessage, arg.ID, arg.LastMessageID)
+	return err
+}
@@ -8,21 +8,109 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type Attachment struct {
+	ID          int64              `json:"id"`
+	UploaderID  int64              `json:"uploader_id"`
+	MessageID   pgtype.Int8        `json:"message_id"`
+	StorageKey  string             `json:"storage_key"`
+	Filename    string             `json:"filename"`
+	MimeType    string             `json:"mime_type"`
+	SizeBytes   int64              `json:"size_bytes"`
+	Checksum    string             `json:"checksum"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+	Width       pgtype.Int4        `json:"width"`
+	Height      pgtype.Int4        `json:"height"`
+	ProcessedAt pgtype.Timestamptz `json:"processed_at"`
+}
+
+type AttachmentThumbnail struct {
+	AttachmentID int64  `json:"attachment_id"`
+	Size         string `json:"size"`
+	StorageKey   string `json:"storage_key"`
+	Width        int32  `json:"width"`
+	Height       int32  `json:"height"`
+}
+
+type Conversation struct {
+	ID            int64              `json:"id"`
+	Name          pgtype.Text        `json:"name"`
+	IsGroup       bool               `json:"is_group"`
+	DirectKey     pgtype.Text        `json:"direct_key"`
+	CreatedBy     pgtype.Int8        `json:"created_by"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt     pgtype.Timestamptz `json:"updated_at"`
+	LastSeq       int64              `json:"last_seq"`
+	LastMessageID pgtype.Int8        `json:"last_message_id"`
+}
+
+type ConversationMember struct {
+	ConversationID int64              `json:"conversation_id"`
+	UserID         int64              `json:"user_id"`
+	Role           string             `json:"role"`
+	JoinedAt       pgtype.Timestamptz `json:"joined_at"`
+	LastActivityAt pgtype.Timestamptz `json:"last_activity_at"`
+	UnreadCount    int32              `json:"unread_count"`
+}
+
 type Message struct {
+	ID             int64              `json:"id"`
+	FromUserID     int64              `json:"from_user_id"`
+	ToUserID       pgtype.Int8        `json:"to_user_id"`
+	IsSent         bool               `json:"is_sent"`
+	Content        string             `json:"content"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	ConversationID int64              `json:"conversation_id"`
+	ClientID       pgtype.Text        `json:"client_id"`
+	Seq            int64              `json:"seq"`
+	EditedAt       pgtype.Timestamptz `json:"edited_at"`
+	DeletedAt      pgtype.Timestamptz `json:"deleted_at"`
+	ReplyTo        pgtype.Int8        `json:"reply_to"`
+	ReplyCount     int32              `json:"reply_count"`
+	LastReplyAt    pgtype.Timestamptz `json:"last_reply_at"`
+}
+
+type MessageEdit struct {
 	ID         int64              `json:"id"`
-	FromUserID int64              `json:"from_user_id"`
-	ToUserID   int64              `json:"to_user_id"`
-	IsSent     bool               `json:"is_sent"`
+	MessageID  int64              `json:"message_id"`
 	Content    string             `json:"content"`
-	CreatedAt  pgtype.Timestamptz `json:"created_at"`
+	ReplacedAt pgtype.Timestamptz `json:"replaced_at"`
+}
+
+type MessageReaction struct {
+	MessageID int64              `json:"message_id"`
+	UserID    int64              `json:"user_id"`
+	Emoji     string             `json:"emoji"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type MessageRecipient struct {
+	MessageID   int64              `json:"message_id"`
+	UserID      int64              `json:"user_id"`
+	DeliveredAt pgtype.Timestamptz `json:"delivered_at"`
+	ReadAt      pgtype.Timestamptz `json:"read_at"`
+}
+
+type MessageSearch struct {
+	MessageID    int64       `json:"message_id"`
+	SearchVector interface{} `json:"search_vector"`
 }
 
 type User struct {
-	ID             int64            `json:"id"`
-	Email          string           `json:"email"`
-	Username       string           `json:"username"`
-	Password       string           `json:"password"`
-	UsersPhotoLink pgtype.Text      `json:"users_photo_link"`
-	CreatedAt      pgtype.Timestamp `json:"created_at"`
-	UpdatedAt      pgtype.Timestamp `json:"updated_at"`
+	ID             int64              `json:"id"`
+	Email          string             `json:"email"`
+	Username       string             `json:"username"`
+	Password       string             `json:"password"`
+	UsersPhotoLink pgtype.Text        `json:"users_photo_link"`
+	CreatedAt      pgtype.Timestamp   `json:"created_at"`
+	UpdatedAt      pgtype.Timestamp   `json:"updated_at"`
+	LastSeenAt     pgtype.Timestamptz `json:"last_seen_at"`
+	DisplayName    string             `json:"display_name"`
+	StatusText     string             `json:"status_text"`
+	Bio            string             `json:"bio"`
+}
+
+type UserBlock struct {
+	BlockerID int64              `json:"blocker_id"`
+	BlockedID int64              `json:"blocked_id"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
 }
@@ -6,14 +6,98 @@ package db
 
 import (
 	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type Querier interface {
+	AddConversationMember(ctx context.Context, arg AddConversationMemberParams) error
+	AddMessageReaction(ctx context.Context, arg AddMessageReactionParams) (int64, error)
+	// only the uploader can attach an upload, and only to one message
+	AttachToMessage(ctx context.Context, arg AttachToMessageParams) ([]Attachment, error)
+	BlockUser(ctx context.Context, arg BlockUserParams) error
+	CountConversationMembers(ctx context.Context, conversationIds []int64) ([]CountConversationMembersRow, error)
+	CountMessageReactionEmojis(ctx context.Context, messageID int64) (int64, error)
+	CreateAttachment(ctx context.Context, arg CreateAttachmentParams) (Attachment, error)
+	CreateConversation(ctx context.Context, arg CreateConversationParams) (Conversation, error)
+	// returns no row when another transaction created the conversation first
+	CreateDirectConversation(ctx context.Context, directKey pgtype.Text) (Conversation, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
-	GetMessages(ctx context.Context, arg GetMessagesParams) ([]Message, error)
+	DecrementUnreadCount(ctx context.Context, arg DecrementUnreadCountParams) error
+	DeleteMessageEdits(ctx context.Context, messageID int64) error
+	GetAttachmentById(ctx context.Context, id int64) (Attachment, error)
+	GetAttachmentThumbnail(ctx context.Context, arg GetAttachmentThumbnailParams) (AttachmentThumbnail, error)
+	GetConversationById(ctx context.Context, id int64) (Conversation, error)
+	GetConversationMember(ctx context.Context, arg GetConversationMemberParams) (ConversationMember, error)
+	GetDirectConversation(ctx context.Context, directKey pgtype.Text) (Conversation, error)
+	GetMessageByClientId(ctx context.Context, arg GetMessageByClientIdParams) (Message, error)
+	GetMessageById(ctx context.Context, id int64) (Message, error)
+	GetMessageForUpdate(ctx context.Context, id int64) (Message, error)
 	GetUserByEmail(ctx context.Context, email string) (User, error)
 	GetUserById(ctx context.Context, id int64) (User, error)
+	HasMessageReactionEmoji(ctx context.Context, arg HasMessageReactionEmojiParams) (bool, error)
 	InsertMessage(ctx context.Context, arg InsertMessageParams) (Message, error)
+	InsertMessageEdit(ctx context.Context, arg InsertMessageEditParams) error
+	InsertMessageRecipients(ctx context.Context, arg InsertMessageRecipientsParams) (int64, error)
+	ListAttachmentsByMessageIds(ctx context.Context, messageIds []int64) ([]Attachment, error)
+	// the users the given user blocked and the users who blocked them
+	ListBlockRelatedIds(ctx context.Context, userID int64) ([]int64, error)
+	ListBlockedUsers(ctx context.Context, blockerID int64) ([]ListBlockedUsersRow, error)
+	ListConversationMemberIds(ctx context.Context, conversationID int64) ([]int64, error)
+	ListConversationMembers(ctx context.Context, conversationID int64) ([]ConversationMember, error)
+	ListConversationMessagesAfter(ctx context.Context, arg ListConversationMessagesAfterParams) ([]Message, error)
+	ListConversationMessagesAfterSeq(ctx context.Context, arg ListConversationMessagesAfterSeqParams) ([]Message, error)
+	ListConversationMessagesBefore(ctx context.Context, arg ListConversationMessagesBeforeParams) ([]Message, error)
+	ListConversationPeers(ctx context.Context, arg ListConversationPeersParams) ([]ListConversationPeersRow, error)
+	ListInbox(ctx context.Context, arg ListInboxParams) ([]ListInboxRow, error)
+	ListInboxBefore(ctx context.Context, arg ListInboxBeforeParams) ([]ListInboxBeforeRow, error)
+	ListLatestConversationMessages(ctx context.Context, arg ListLatestConversationMessagesParams) ([]Message, error)
+	ListMessageEdits(ctx context.Context, messageID int64) ([]MessageEdit, error)
+	ListMessageReceipts(ctx context.Context, messageIds []int64) ([]MessageRecipient, error)
+	ListMessagesByIds(ctx context.Context, ids []int64) ([]Message, error)
+	ListPeerIds(ctx context.Context, userID int64) ([]int64, error)
+	// messages of conversations the user has left since are dropped
+	ListPendingMessages(ctx context.Context, arg ListPendingMessagesParams) ([]Message, error)
+	ListReactionCounts(ctx context.Context, arg ListReactionCountsParams) ([]ListReactionCountsRow, error)
+	ListThreadReplies(ctx context.Context, arg ListThreadRepliesParams) ([]Message, error)
+	ListThreadRepliesAfter(ctx context.Context, arg ListThreadRepliesAfterParams) ([]Message, error)
+	ListThumbnailsByAttachmentIds(ctx context.Context, attachmentIds []int64) ([]AttachmentThumbnail, error)
+	ListUnprocessedImages(ctx context.Context) ([]int64, error)
+	ListUsersLastSeen(ctx context.Context, userIds []int64) ([]ListUsersLastSeenRow, error)
+	// the content did not decode as the image type it was sniffed as
+	MarkAttachmentNotImage(ctx context.Context, id int64) (Attachment, error)
+	// the content may have been rewritten without its location, so size and checksum are replaced too
+	MarkAttachmentProcessed(ctx context.Context, arg MarkAttachmentProcessedParams) (Attachment, error)
+	MarkConversationRead(ctx context.Context, arg MarkConversationReadParams) ([]MarkConversationReadRow, error)
+	MarkMessageSent(ctx context.Context, id int64) error
+	// returns the messages whose delivery to the user was not recorded yet
+	MarkMessagesDelivered(ctx context.Context, arg MarkMessagesDeliveredParams) ([]int64, error)
+	MarkMessagesSent(ctx context.Context, messageIds []int64) error
+	// the row lock taken here serializes the inserts of a conversation until their transaction ends
+	NextConversationSeq(ctx context.Context, id int64) (int64, error)
+	PromoteOldestMember(ctx context.Context, conversationID int64) error
+	// moves the conversation to the top of every member's inbox, the sender has nothing new to read
+	RecordConversationMessage(ctx context.Context, arg RecordConversationMessageParams) error
+	RecordMessageReply(ctx context.Context, arg RecordMessageReplyParams) error
+	// runs after a reply of the message was deleted, deleted replies do not count
+	RecountMessageReplies(ctx context.Context, id int64) error
+	RemoveConversationMember(ctx context.Context, arg RemoveConversationMemberParams) (int64, error)
+	RemoveMessageReaction(ctx context.Context, arg RemoveMessageReactionParams) (int64, error)
+	RenameConversation(ctx context.Context, arg RenameConversationParams) (Conversation, error)
+	// newest matches first in the conversations the user is a member of. The query takes the web search syntax:
+	// "quoted phrases", or, and -excluded words. The snippet marks the matches with U+E000 and U+E001,
+	// which the handler turns into <mark> tags once the content is HTML escaped.
+	SearchMessages(ctx context.Context, arg SearchMessagesParams) ([]SearchMessagesRow, error)
+	// prefix matches come first, then the closest fuzzy matches; the caller and the users blocking them are left out
+	SearchUsers(ctx context.Context, arg SearchUsersParams) ([]SearchUsersRow, error)
+	SetConversationLastMessage(ctx context.Context, arg SetConversationLastMessageParams) error
+	SoftDeleteMessage(ctx context.Context, id int64) (Message, error)
+	UnblockUser(ctx context.Context, arg UnblockUserParams) error
+	UpdateMessageContent(ctx context.Context, arg UpdateMessageContentParams) (Message, error)
+	UpdateUserLastSeen(ctx context.Context, arg UpdateUserLastSeenParams) error
+	UpdateUserPhoto(ctx context.Context, arg UpdateUserPhotoParams) (User, error)
+	UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (User, error)
+	UpsertAttachmentThumbnail(ctx context.Context, arg UpsertAttachmentThumbnailParams) error
 }
 
 var _ Querier = (*Queries)(nil)
@@ -7,13 +7,31 @@ package db
 
 import (
 	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const blockUser = `-- name: BlockUser :exec
+INSERT INTO user_block (blocker_id, blocked_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING
+`
+
+type BlockUserParams struct {
+	BlockerID int64 `json:"blocker_id"`
+	BlockedID int64 `json:"blocked_id"`
+}
+
+func (q *Queries) BlockUser(ctx context.Context, arg BlockUserParams) error {
+	_, err := q.db.Exec(ctx, blockUser, arg.BlockerID, arg.BlockedID)
+	return err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO
     users (email, password, username)
 VALUES 
- ($1,$2,$3) RETURNING id, email, username, password, users_photo_link, created_at, updated_at
+ ($1,$2,$3) RETURNING id, email, username, password, users_photo_link, created_at, updated_at, last_seen_at, display_name, status_text, bio
 `
 
 type CreateUserParams struct {
@@ -33,13 +51,17 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.UsersPhotoLink,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.LastSeenAt,
+		&i.DisplayName,
+		&i.StatusText,
+		&i.Bio,
 	)
 	return i, err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
 
-SELECT id, email, username, password, users_photo_link, created_at, updated_at FROM users where email = $1
+SELECT id, email, username, password, users_photo_link, created_at, updated_at, last_seen_at, display_name, status_text, bio FROM users where email = $1
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
@@ -53,13 +75,17 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.UsersPhotoLink,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.LastSeenAt,
+		&i.DisplayName,
+		&i.StatusText,
+		&i.Bio,
 	)
 	return i, err
 }
 
 const getUserById = `-- name: GetUserById :one
 
-SELECT id, email, username, password, users_photo_link, created_at, updated_at FROM users where id = $1
+SELECT id, email, username, password, users_photo_link, created_at, updated_at, last_seen_at, display_name, status_text, bio FROM users where id = $1
 `
 
 func (q *Queries) GetUserById(ctx context.Context, id int64) (User, error) {
@@ -73,6 +99,283 @@ func (q *Queries) GetUserById(ctx context.Context, id int64) (User, error) {
 		&i.UsersPhotoLink,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.LastSeenAt,
+		&i.DisplayName,
+		&i.StatusText,
+		&i.Bio,
+	)
+	return i, err
+}
+
+const listBlockRelatedIds = `-- name: ListBlockRelatedIds :many
+SELECT CASE WHEN blocker_id = $1::BIGINT THEN blocked_id ELSE blocker_id END::BIGINT AS user_id
+FROM user_block
+WHERE blocker_id = $1::BIGINT OR blocked_id = $1::BIGINT
+`
+
+// the users the given user blocked and the users who blocked them
+func (q *Queries) ListBlockRelatedIds(ctx context.Context, userID int64) ([]int64, error) {
+	rows, err := q.db.Query(ctx, listBlockRelatedIds, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []int64{}
+	for rows.Next() {
+		var user_id int64
+		if err := rows.Scan(&user_id); err != nil {
+			return nil, err
+		}
+		items = append(items, user_id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listBlockedUsers = `-- name: ListBlockedUsers :many
+SELECT u.id, u.username, u.display_name, u.status_text, u.bio, u.users_photo_link
+FROM user_block b
+JOIN users u ON u.id = b.blocked_id
+WHERE b.blocker_id = $1
+ORDER BY b.created_at DESC
+`
+
+type ListBlockedUsersRow struct {
+	ID             int64       `json:"id"`
+	Username       string      `json:"username"`
+	DisplayName    string      `json:"display_name"`
+	StatusText     string      `json:"status_text"`
+	Bio            string      `json:"bio"`
+	UsersPhotoLink pgtype.Text `json:"users_photo_link"`
+}
+
+func (q *Queries) ListBlockedUsers(ctx context.Context, blockerID int64) ([]ListBlockedUsersRow, error) {
+	rows, err := q.db.Query(ctx, listBlockedUsers, blockerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListBlockedUsersRow{}
+	for rows.Next() {
+		var i ListBlockedUsersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.DisplayName,
+			&i.StatusText,
+			&i.Bio,
+			&i.UsersPhotoLink,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUsersLastSeen = `-- name: ListUsersLastSeen :many
+SELECT id, last_seen_at FROM users
+WHERE id = ANY($1::BIGINT[])
+`
+
+type ListUsersLastSeenRow struct {
+	ID         int64              `json:"id"`
+	LastSeenAt pgtype.Timestamptz `json:"last_seen_at"`
+}
+
+func (q *Queries) ListUsersLastSeen(ctx context.Context, userIds []int64) ([]ListUsersLastSeenRow, error) {
+	rows, err := q.db.Query(ctx, listUsersLastSeen, userIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListUsersLastSeenRow{}
+	for rows.Next() {
+		var i ListUsersLastSeenRow
+		if err := rows.Scan(&i.ID, &i.LastSeenAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchUsers = `-- name: SearchUsers :many
+SELECT u.id, u.username, u.display_name, u.status_text, u.bio, u.users_photo_link
+FROM users u
+WHERE u.id <> $1::BIGINT
+AND (
+    lower(u.username) LIKE $2::TEXT
+    OR lower(u.display_name) LIKE $2::TEXT
+    OR $3::TEXT <% lower(u.username)
+    OR $3::TEXT <% lower(u.display_name)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_block b
+    WHERE b.blocker_id = u.id AND b.blocked_id = $1::BIGINT
+)
+ORDER BY
+    (lower(u.username) LIKE $2::TEXT OR lower(u.display_name) LIKE $2::TEXT) DESC,
+    GREATEST(word_similarity($3::TEXT, lower(u.username)), word_similarity($3::TEXT, lower(u.display_name))) DESC,
+    u.id
+LIMIT $5::INT OFFSET $4::INT
+`
+
+type SearchUsersParams struct {
+	UserID     int64  `json:"user_id"`
+	Prefix     string `json:"prefix"`
+	Query      string `json:"query"`
+	PageOffset int32  `json:"page_offset"`
+	PageLimit  int32  `json:"page_limit"`
+}
+
+type SearchUsersRow struct {
+	ID             int64       `json:"id"`
+	Username       string      `json:"username"`
+	DisplayName    string      `json:"display_name"`
+	StatusText     string      `json:"status_text"`
+	Bio            string      `json:"bio"`
+	UsersPhotoLink pgtype.Text `json:"users_photo_link"`
+}
+
+// prefix matches come first, then the closest fuzzy matches; the caller and the users blocking them are left out
+func (q *Queries) SearchUsers(ctx context.Context, arg SearchUsersParams) ([]SearchUsersRow, error) {
+	rows, err := q.db.Query(ctx, searchUsers,
+		arg.UserID,
+		arg.Prefix,
+		arg.Query,
+		arg.PageOffset,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []SearchUsersRow{}
+	for rows.Next() {
+		var i SearchUsersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.DisplayName,
+			&i.StatusText,
+			&i.Bio,
+			&i.UsersPhotoLink,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const unblockUser = `-- name: UnblockUser :exec
+DELETE FROM user_block
+WHERE blocker_id = $1 AND blocked_id = $2
+`
+
+type UnblockUserParams struct {
+	BlockerID int64 `json:"blocker_id"`
+	BlockedID int64 `json:"blocked_id"`
+}
+
+func (q *Queries) UnblockUser(ctx context.Context, arg UnblockUserParams) error {
+	_, err := q.db.Exec(ctx, unblockUser, arg.BlockerID, arg.BlockedID)
+	return err
+}
+
+const updateUserLastSeen = `-- name: UpdateUserLastSeen :exec
+UPDATE users SET last_seen_at = $2 WHERE id = $1
+`
+
+type UpdateUserLastSeenParams struct {
+	ID         int64              `json:"id"`
+	LastSeenAt pgtype.Timestamptz `json:"last_seen_at"`
+}
+
+func (q *Queries) UpdateUserLastSeen(ctx context.Context, arg UpdateUserLastSeenParams) error {
+	_, err := q.db.Exec(ctx, updateUserLastSeen, arg.ID, arg.LastSeenAt)
+	return err
+}
+
+const updateUserPhoto = `-- name: UpdateUserPhoto :one
+UPDATE users
+SET users_photo_link = $2, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING id, email, username, password, users_photo_link, created_at, updated_at, last_seen_at, display_name, status_text, bio
+`
+
+type UpdateUserPhotoParams struct {
+	ID             int64       `json:"id"`
+	UsersPhotoLink pgtype.Text `json:"users_photo_link"`
+}
+
+func (q *Queries) UpdateUserPhoto(ctx context.Context, arg UpdateUserPhotoParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUserPhoto, arg.ID, arg.UsersPhotoLink)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Username,
+		&i.Password,
+		&i.UsersPhotoLink,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.LastSeenAt,
+		&i.DisplayName,
+		&i.StatusText,
+		&i.Bio,
+	)
+	return i, err
+}
+
+const updateUserProfile = `-- name: UpdateUserProfile :one
+UPDATE users
+SET username = $2, display_name = $3, status_text = $4, bio = $5, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+RETURNING id, email, username, password, users_photo_link, created_at, updated_at, last_seen_at, display_name, status_text, bio
+`
+
+type UpdateUserProfileParams struct {
+	ID          int64  `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	StatusText  string `json:"status_text"`
+	Bio         string `json:"bio"`
+}
+
+func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (User, error) {
+	row := q.db.QueryRow(ctx, updateUserProfile,
+		arg.ID,
+		arg.Username,
+		arg.DisplayName,
+		arg.StatusText,
+		arg.Bio,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Username,
+		&i.Password,
+		&i.UsersPhotoLink,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.LastSeenAt,
+		&i.DisplayName,
+		&i.StatusText,
+		&i.Bio,
 	)
 	return i, err
 }
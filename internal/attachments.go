@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"context"
+	"log"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/internal/handlers"
+	"tarun-kavipurapu/test-go-chat/types"
+)
+
+// EventAttachmentReady tells that an image attachment was processed, its dimensions and thumbnails are known.
+const EventAttachmentReady = "attachment.ready"
+
+// AttachmentReady is the payload of attachment.ready, MessageId and ConversationId are zero while the upload is not sent.
+type AttachmentReady struct {
+	MessageId      int64                   `json:"message_id,omitempty"`
+	ConversationId int64                   `json:"conversation_id,omitempty"`
+	Attachment     types.AttachmentDetails `json:"attachment"`
+}
+
+// AttachmentProcessed pushes a processed attachment to the members of the conversation it was sent to,
+// or to the uploader while it is not sent yet, see media.Notifier.
+func (h *Hub) AttachmentProcessed(attachment db.Attachment) {
+	key := userKey(attachment.UploaderID)
+	if attachment.MessageID.Valid {
+		key = messageKey(attachment.MessageID.Int64)
+	}
+	h.pipeline.Submit(key, func(ctx context.Context) {
+		h.publishAttachmentReady(attachment, ctx)
+	})
+}
+
+func (h *Hub) publishAttachmentReady(attachment db.Attachment, ctx context.Context) {
+	details, err := handlers.LoadAttachmentDetails(ctx, h.store, []db.Attachment{attachment})
+	if err != nil {
+		log.Printf("Unable to fetch thumbnails of attachment %d: %v\n", attachment.ID, err)
+		return
+	}
+	ready := &AttachmentReady{Attachment: details[0]}
+	if !attachment.MessageID.Valid {
+		h.publishToUsers([]int64{attachment.UploaderID}, newSocketEvent(EventAttachmentReady, ready), nil)
+		return
+	}
+
+	message, err := h.store.GetMessageById(ctx, attachment.MessageID.Int64)
+	if err != nil {
+		log.Printf("Unable to fetch message %d: %v\n", attachment.MessageID.Int64, err)
+		return
+	}
+	if message.DeletedAt.Valid {
+		return
+	}
+	ready.MessageId = message.ID
+	ready.ConversationId = message.ConversationID
+	memberIds, err := h.store.ListConversationMemberIds(ctx, message.ConversationID)
+	if err != nil {
+		log.Printf("Unable to fetch members of conversation %d: %v\n", message.ConversationID, err)
+		return
+	}
+	h.publishToConversation(message.ConversationID, memberIds, newSocketEvent(EventAttachmentReady, ready), nil)
+}
@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"context"
+	"sync"
+	"tarun-kavipurapu/test-go-chat/types"
+)
+
+// backlog holds the stored messages loaded for a connection, its pending messages and replays, until the
+// writePump takes them. They bypass the shard and the send queue, so loading a long history never blocks
+// the shard nor overflows the queue. A loader adds one page with the job loading the next one, which the
+// writePump submits to the pipeline once the page is written, so at most a page per loader waits in memory.
+type backlog struct {
+	mu     sync.Mutex
+	events []*types.SocketEventStruct
+	next   []func(ctx context.Context)
+	// ready is signalled when events were added, the writePump waits on it
+	ready chan struct{}
+}
+
+func newBacklog() *backlog {
+	return &backlog{ready: make(chan struct{}, 1)}
+}
+
+// push adds the events for the writePump, next, when not nil, runs on the pipeline after they are written.
+func (b *backlog) push(events []*types.SocketEventStruct, next func(ctx context.Context)) {
+	b.mu.Lock()
+	b.events = append(b.events, events...)
+	if next != nil {
+		b.next = append(b.next, next)
+	}
+	b.mu.Unlock()
+
+	select {
+	case b.ready <- struct{}{}:
+	default:
+		// the writePump has not taken the earlier events yet, it gets these with them
+	}
+}
+
+// take returns everything pushed since the last call.
+func (b *backlog) take() ([]*types.SocketEventStruct, []func(ctx context.Context)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	events, next := b.events, b.next
+	b.events, b.next = nil, nil
+	return events, next
+}
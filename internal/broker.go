@@ -0,0 +1,168 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"tarun-kavipurapu/test-go-chat/config"
+	"tarun-kavipurapu/test-go-chat/types"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// BrokerEnvelope carries a socket event between nodes together with the users it is for.
+// Every node delivers it to the connections of those users it holds, except ExcludeClient.
+type BrokerEnvelope struct {
+	NodeId         string                   `json:"node_id"`
+	UserIds        []int64                  `json:"user_ids"`
+	ConversationId int64                    `json:"conversation_id,omitempty"`
+	ExcludeClient  string                   `json:"exclude_client,omitempty"`
+	Event          *types.SocketEventStruct `json:"event"`
+}
+
+// Broker moves socket events between the nodes of the cluster so a hub can reach users connected elsewhere.
+type Broker interface {
+	// PublishToUser delivers the event to every connection of the user on the other nodes.
+	PublishToUser(ctx context.Context, envelope *BrokerEnvelope) error
+	// PublishToConversation delivers the event to the listed members of a conversation on the other nodes.
+	PublishToConversation(ctx context.Context, envelope *BrokerEnvelope) error
+	// PublishToNode delivers the event to the listed users on a single node.
+	PublishToNode(ctx context.Context, nodeId string, envelope *BrokerEnvelope) error
+	// Subscribe hands every envelope published by another node for all nodes or for nodeId to handler until ctx is done.
+	// The handler must not block for long, it runs on the subscription's goroutine.
+	Subscribe(ctx context.Context, nodeId string, handler func(*BrokerEnvelope)) error
+	Close() error
+}
+
+// NewClusterFromConfig returns the broker and registry named by BROKER, the in-process ones when it is empty.
+func NewClusterFromConfig(cfg config.Config) (Broker, Registry, error) {
+	switch cfg.Broker {
+	case "", "memory":
+		return NewMemoryBroker(), NewMemoryRegistry(), nil
+	case "redis":
+		client := redis.NewClient(&redis.Options{
+			Addr:     cfg.RedisAddr,
+			Password: cfg.RedisPassword,
+		})
+		if err := client.Ping(context.Background()).Err(); err != nil {
+			return nil, nil, fmt.Errorf("unable to reach redis at %s: %w", cfg.RedisAddr, err)
+		}
+		return NewRedisBroker(client), NewRedisRegistry(client), nil
+	default:
+		return nil, nil, fmt.Errorf("unknown broker %q", cfg.Broker)
+	}
+}
+
+// decodeEnvelope rebuilds an envelope received from another process.
+// message.new payloads are decoded into *Message because the writePump tracks their delivery,
+// every other payload is forwarded to the sockets as it was received.
+func decodeEnvelope(data []byte) (*BrokerEnvelope, error) {
+	var wire struct {
+		BrokerEnvelope
+		Event types.SocketEventRequest `json:"event"`
+	}
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return nil, err
+	}
+
+	envelope := wire.BrokerEnvelope
+	envelope.Event = &types.SocketEventStruct{
+		EventName:    wire.Event.EventName,
+		EventId:      wire.Event.EventId,
+		EventPayload: wire.Event.EventPayload,
+	}
+	if wire.Event.EventName == EventMessageNew {
+		var message Message
+		if err := json.Unmarshal(wire.Event.EventPayload, &message); err != nil {
+			return nil, err
+		}
+		envelope.Event.EventPayload = &message
+	}
+	return &envelope, nil
+}
+
+// memoryBrokerQueueSize bounds the envelopes waiting for one subscriber.
+const memoryBrokerQueueSize = 1024
+
+// MemoryBroker is the in-process broker used on a single node and to run several hubs in one process.
+type MemoryBroker struct {
+	mu          sync.RWMutex
+	subscribers map[string]chan *BrokerEnvelope
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{subscribers: make(map[string]chan *BrokerEnvelope)}
+}
+
+func (b *MemoryBroker) PublishToUser(ctx context.Context, envelope *BrokerEnvelope) error {
+	return b.publish(envelope)
+}
+
+func (b *MemoryBroker) PublishToConversation(ctx context.Context, envelope *BrokerEnvelope) error {
+	return b.publish(envelope)
+}
+
+func (b *MemoryBroker) PublishToNode(ctx context.Context, nodeId string, envelope *BrokerEnvelope) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	queue, ok := b.subscribers[nodeId]
+	if !ok {
+		return fmt.Errorf("node %s is not subscribed", nodeId)
+	}
+	select {
+	case queue <- envelope:
+	default:
+		log.Printf("Memory broker queue of node %s is full, dropped %s\n", nodeId, envelope.Event.EventName)
+	}
+	return nil
+}
+
+// publish never blocks the hub, like redis pub/sub a subscriber that falls behind loses envelopes
+// and the recipients catch up from the pending messages when they reconnect.
+func (b *MemoryBroker) publish(envelope *BrokerEnvelope) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for nodeId, queue := range b.subscribers {
+		if nodeId == envelope.NodeId {
+			continue
+		}
+		select {
+		case queue <- envelope:
+		default:
+			log.Printf("Memory broker queue of node %s is full, dropped %s\n", nodeId, envelope.Event.EventName)
+		}
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(ctx context.Context, nodeId string, handler func(*BrokerEnvelope)) error {
+	queue := make(chan *BrokerEnvelope, memoryBrokerQueueSize)
+	b.mu.Lock()
+	if _, ok := b.subscribers[nodeId]; ok {
+		b.mu.Unlock()
+		return fmt.Errorf("node %s is already subscribed", nodeId)
+	}
+	b.subscribers[nodeId] = queue
+	b.mu.Unlock()
+
+	go func() {
+		for {
+			select {
+			case envelope := <-queue:
+				handler(envelope)
+			case <-ctx.Done():
+				b.mu.Lock()
+				delete(b.subscribers, nodeId)
+				b.mu.Unlock()
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (b *MemoryBroker) Close() error {
+	return nil
+}
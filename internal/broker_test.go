@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// subscribeTestNode subscribes the node to the broker until the test ends and returns the envelopes it receives.
+func subscribeTestNode(t *testing.T, broker Broker, nodeId string) <-chan *BrokerEnvelope {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	received := make(chan *BrokerEnvelope, 16)
+	if err := broker.Subscribe(ctx, nodeId, func(envelope *BrokerEnvelope) { received <- envelope }); err != nil {
+		t.Fatal(err)
+	}
+	return received
+}
+
+func expectEnvelope(t *testing.T, received <-chan *BrokerEnvelope) *BrokerEnvelope {
+	t.Helper()
+	select {
+	case envelope := <-received:
+		return envelope
+	case <-time.After(time.Second):
+		t.Fatal("no envelope received")
+		return nil
+	}
+}
+
+func expectNoEnvelope(t *testing.T, received <-chan *BrokerEnvelope) {
+	t.Helper()
+	select {
+	case envelope := <-received:
+		t.Fatalf("got %s from node %s", envelope.Event.EventName, envelope.NodeId)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// testBrokerDelivery checks that an envelope published by node a reaches node b and only b, as the two
+// nodes would use the broker from separate processes.
+func testBrokerDelivery(t *testing.T, brokerA Broker, brokerB Broker) {
+	ctx := context.Background()
+	receivedA := subscribeTestNode(t, brokerA, "a")
+	receivedB := subscribeTestNode(t, brokerB, "b")
+
+	message := &Message{Id: 7, ConversationId: 5, Content: "hi"}
+	err := brokerA.PublishToConversation(ctx, &BrokerEnvelope{NodeId: "a", UserIds: []int64{2, 3}, ConversationId: 5, Event: newSocketEvent(EventMessageNew, message)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope := expectEnvelope(t, receivedB)
+	delivered, ok := envelope.Event.EventPayload.(*Message)
+	if !ok || delivered.Id != 7 || len(envelope.UserIds) != 2 || envelope.ConversationId != 5 {
+		t.Fatalf("node b got %+v with payload %#v", envelope, envelope.Event.EventPayload)
+	}
+	expectNoEnvelope(t, receivedA)
+
+	if err := brokerB.PublishToUser(ctx, &BrokerEnvelope{NodeId: "b", UserIds: []int64{1}, Event: newSocketEvent(EventPong, nil)}); err != nil {
+		t.Fatal(err)
+	}
+	if envelope := expectEnvelope(t, receivedA); envelope.Event.EventName != EventPong || envelope.UserIds[0] != 1 {
+		t.Fatalf("node a got %s for %v", envelope.Event.EventName, envelope.UserIds)
+	}
+	expectNoEnvelope(t, receivedB)
+}
+
+func TestMemoryBrokerDelivery(t *testing.T) {
+	broker := NewMemoryBroker()
+	testBrokerDelivery(t, broker, broker)
+
+	if err := broker.Subscribe(context.Background(), "a", func(*BrokerEnvelope) {}); err == nil {
+		t.Fatal("subscribed node a twice")
+	}
+}
+
+func TestRedisBrokerDelivery(t *testing.T) {
+	server := miniredis.RunT(t)
+	brokerA := NewRedisBroker(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	brokerB := NewRedisBroker(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	t.Cleanup(func() {
+		brokerA.Close()
+		brokerB.Close()
+	})
+	testBrokerDelivery(t, brokerA, brokerB)
+}
+
+func TestDecodeEnvelopeKeepsOtherPayloadsRaw(t *testing.T) {
+	data, err := json.Marshal(&BrokerEnvelope{NodeId: "a", Event: newSocketEvent(EventPresence, &PresenceUpdate{UserId: 4, Online: true})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope, err := decodeEnvelope(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, ok := envelope.Event.EventPayload.(json.RawMessage)
+	if !ok {
+		t.Fatalf("payload decoded into %T", envelope.Event.EventPayload)
+	}
+	var update PresenceUpdate
+	if err := json.Unmarshal(raw, &update); err != nil || update.UserId != 4 || !update.Online {
+		t.Fatalf("payload %s", raw)
+	}
+
+	if _, err := decodeEnvelope([]byte(`{"event":{"eventName":"message.new","eventPayload":"text"}}`)); err == nil {
+		t.Fatal("decoded a message.new without a message")
+	}
+}
@@ -2,11 +2,18 @@ package internal
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"io"
 	"log"
+	"sync/atomic"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/internal/handlers"
+	"tarun-kavipurapu/test-go-chat/types"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
@@ -20,8 +27,9 @@ const (
 	// Send pings to peer with this period. Must be less than pongWait.
 	pingPeriod = (pongWait * 9) / 10
 
-	// Maximum message size allowed from peer.
-	maxMessageSize = 512
+	// Maximum frame size allowed from peer, room for an event carrying a message of handlers.MaxMessageLength
+	// characters, each escaped in the JSON, with its other fields.
+	maxMessageSize = 64 << 10
 )
 
 var (
@@ -30,59 +38,148 @@ var (
 )
 
 type Client struct {
+	// id identifies the connection across nodes, so an event can skip the connection it came from
+	id     string
 	conn   *websocket.Conn
 	userId int64
 	hub    *Hub
-	sendTo chan *Message
+	sendTo chan *types.SocketEventStruct
+
+	// spilled is set by the shard when a stored message did not fit in sendTo,
+	// the writePump then reloads the pending messages once the queue drained
+	spilled atomic.Bool
+
+	// typing throttles this connection's typing events, it is owned by the readPump
+	typing typingLimiter
+
+	// addressKeys caches the pipeline key of the conversations the connection sent to, it is owned by the readPump
+	addressKeys map[int64]string
+
+	// recent drops the messages written twice because a pending flush raced their live delivery,
+	// it is owned by the writePump
+	recent *messageWindow
+
+	// stored holds the pending and replayed messages loaded for the connection, see backlog
+	stored *backlog
+
+	// resume is the last sequence number the client had of each conversation it resumed on connect,
+	// seqs keeps those conversations in order and is owned by the writePump
+	resume map[int64]int64
+	seqs   *seqTracker
 }
 
+// Message is the payload of the message.send and message.new events.
+// To addresses a direct message, ConversationId addresses a group (or an existing direct conversation).
+// ReplyTo quotes an earlier message of the same conversation and AttachmentIds references files uploaded to /attachments.
+// ClientId is an optional idempotency key chosen by the sender, retrying with it never stores the message twice.
 type Message struct {
-	From    int64  `json:"from"`
-	To      int64  `json:"to"`
-	Content string `json:"Content"`
+	Id             int64     `json:"id"`
+	ClientId       string    `json:"client_id,omitempty"`
+	From           int64     `json:"from"`
+	To             int64     `json:"to"`
+	ConversationId int64     `json:"conversation_id"`
+	Seq            int64     `json:"seq"`
+	Content        string    `json:"Content"`
+	ReplyTo        int64     `json:"reply_to,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+
+	// AttachmentIds are sent with message.send, Attachments describe them on delivery
+	AttachmentIds []int64                   `json:"attachment_ids,omitempty"`
+	Attachments   []types.AttachmentDetails `json:"attachments,omitempty"`
+
+	// EditedAt and Deleted are only set on stored messages that were changed by their author
+	EditedAt *time.Time `json:"edited_at,omitempty"`
+	Deleted  bool       `json:"deleted,omitempty"`
+
+	// sender is the connection the message was read from and eventId the id of the event that carried it,
+	// neither is sent over the wire
+	sender  *Client
+	eventId string
 }
 
-func (c *Client) SendError(errorMsg string) {
+// newMessageFromRow converts a stored message into its wire representation.
+func newMessageFromRow(row db.Message) *Message {
+	message := &Message{
+		Id:             row.ID,
+		ClientId:       row.ClientID.String,
+		From:           row.FromUserID,
+		To:             row.ToUserID.Int64,
+		ConversationId: row.ConversationID,
+		Seq:            row.Seq,
+		Content:        row.Content,
+		ReplyTo:        row.ReplyTo.Int64,
+		CreatedAt:      row.CreatedAt.Time,
+	}
+	if row.EditedAt.Valid {
+		message.EditedAt = &row.EditedAt.Time
+	}
+	if row.DeletedAt.Valid {
+		message.Deleted = true
+		message.Content = handlers.DeletedMessageContent
+	}
+	return message
+}
 
-	c.sendTo <- &Message{
-		From:    0, //from server
-		To:      c.userId,
-		Content: fmt.Sprintf(`{"error": true, "message": "%s"}`, errorMsg),
+// connectionId returns the id of the connection, or an empty string for no connection.
+func (c *Client) connectionId() string {
+	if c == nil {
+		return ""
 	}
-	// Add a sleep time to allow the channel to be emptied
-	time.Sleep(2 * time.Second)
-	c.conn.Close()
+	return c.id
+}
 
+// SendError answers the client with an error event for the client event eventId.
+// It must not be called from a shard goroutine.
+func (c *Client) SendError(err error, eventId string) {
+	c.hub.replyError(c, err, eventId)
 }
 
 func (c *Client) readPump() {
-
+	// a fatal error leaves closing the connection to the writePump, which sends the close frame after the error
+	closing := false
 	defer func() {
-		c.conn.Close()
-		c.hub.unregister <- c
+		if !closing {
+			c.conn.Close()
+		}
+		c.hub.shardFor(c.userId).unregister <- c
+		c.hub.pipeline.Submit(userKey(c.userId), func(ctx context.Context) {
+			c.hub.clientDisconnected(c, ctx)
+		})
 	}()
 	c.conn.SetReadLimit(maxMessageSize)
 	c.conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 
 	for {
-		var msg Message
-		err := c.conn.ReadJSON(&msg)
+		var event types.SocketEventRequest
+		err := c.conn.ReadJSON(&event)
 		if err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			// a frame cut short, or empty, reads as an unexpected EOF, a broken connection as a close error
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+				// the frame was not an event envelope, the connection itself is fine
+				c.SendError(&SocketError{
+					Code:    ErrorCodeInvalidEvent,
+					Message: "Frames must be JSON events with an eventName and eventPayload",
+				}, "")
+				continue
+			}
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("error: %v", err)
 			}
 			break
 		}
 
-		log.Println(msg)
+		log.Println(event.EventName, string(event.EventPayload))
 
-		//Here Client.Id comes from the token and msg.from comes from the payload both of them should be same so that we can say we are sending the message by a credible user
-		if c.userId != msg.From {
-			c.SendError("Unauthorized !! Auth user and Sent User are Different")
-			return
+		if err := c.hub.dispatcher.Dispatch(c, &event); err != nil {
+			c.SendError(err, event.EventId)
+			if isFatalError(err) {
+				closing = true
+				return
+			}
 		}
-		c.hub.broadcast <- &msg
 	}
 }
 func (c *Client) writePump() {
@@ -90,6 +187,10 @@ func (c *Client) writePump() {
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
+		// whatever is still queued is never written, the shard closes the channel once the readPump unregistered
+		for range c.sendTo {
+			c.dequeued()
+		}
 	}()
 	for {
 		select {
@@ -101,27 +202,26 @@ func (c *Client) writePump() {
 				return
 			}
 
-			// Marshal the message to JSON
-			reqBodyBytes := new(bytes.Buffer)
-			json.NewEncoder(reqBodyBytes).Encode(message)
-			finalPayload := reqBodyBytes.Bytes()
-
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-
-			// Write the initial message
-			w.Write(finalPayload)
-
-			// Write any remaining queued messages
+			// Take any remaining queued messages along
+			batch := []*types.SocketEventStruct{message}
+			c.dequeued()
 			n := len(c.sendTo)
 			for i := 0; i < n; i++ {
-				json.NewEncoder(reqBodyBytes).Encode(<-c.sendTo)
-				w.Write(reqBodyBytes.Bytes())
+				queued, ok := <-c.sendTo
+				if !ok {
+					break
+				}
+				c.dequeued()
+				batch = append(batch, queued)
+			}
+			if !c.flush(batch, nil) {
+				return
 			}
 
-			if err := w.Close(); err != nil {
+		case <-c.stored.ready:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			events, next := c.stored.take()
+			if !c.flush(events, next) {
 				return
 			}
 
@@ -136,17 +236,119 @@ func (c *Client) writePump() {
 	}
 }
 
-func CreateNewSocketUser(hub *Hub, connection *websocket.Conn, userID int64) {
+// flush writes a batch of events to the socket, in sequence order and without the messages written already.
+// next are the backlog jobs waiting for the batch, they are submitted once the delivered messages are marked.
+// It reports false when the connection must close.
+func (c *Client) flush(batch []*types.SocketEventStruct, next []func(ctx context.Context)) bool {
+	written, gaps := c.seqs.filter(batch)
+	c.replayGaps(gaps)
+	written = c.recent.filter(written)
+	if len(written) > 0 {
+		if err := c.write(written); err != nil {
+			// the rest of the backlog stays pending for the next connection
+			return false
+		}
+	}
+	c.afterWrite(written, next)
+	c.reloadSpilled()
+
+	if closeErr := fatalError(written); closeErr != nil {
+		closeMessage := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, closeErr.Message)
+		c.conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(writeWait))
+		return false
+	}
+	return true
+}
+
+// write sends the events to the socket in a single frame, one JSON document per line.
+func (c *Client) write(events []*types.SocketEventStruct) error {
+	w, err := c.conn.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return err
+	}
+
+	// Marshal the messages to JSON
+	reqBodyBytes := new(bytes.Buffer)
+	for _, event := range events {
+		reqBodyBytes.Reset()
+		json.NewEncoder(reqBodyBytes).Encode(event)
+		w.Write(reqBodyBytes.Bytes())
+	}
+	return w.Close()
+}
+
+// reloadSpilled loads the messages the shard spilled into the backlog once the queue drained.
+// Messages already written before the reload are marked delivered, so they are not sent twice.
+func (c *Client) reloadSpilled() {
+	if len(c.sendTo) > 0 || !c.spilled.CompareAndSwap(true, false) {
+		return
+	}
+	// the pipeline may be waiting on the shard, which may be waiting on this writePump
+	go c.hub.pipeline.Submit(userKey(c.userId), func(ctx context.Context) {
+		c.hub.flushPendingMessages(c, 0, ctx)
+	})
+}
+
+// fatalError returns the written error event that requires closing the connection, if any.
+func fatalError(written []*types.SocketEventStruct) *types.SocketErrorPayload {
+	for _, event := range written {
+		if payload, ok := event.EventPayload.(*types.SocketErrorPayload); ok && payload.Close {
+			return payload
+		}
+	}
+	return nil
+}
+
+// afterWrite submits the marking of the written messages as delivered, then the backlog jobs waiting for them.
+// Echoes of the user's own messages are not deliveries and are skipped.
+func (c *Client) afterWrite(written []*types.SocketEventStruct, next []func(ctx context.Context)) {
+	var delivered []*Message
+	for _, event := range written {
+		message, ok := event.EventPayload.(*Message)
+		if ok && event.EventName == EventMessageNew && message.Id != 0 && message.From != c.userId {
+			delivered = append(delivered, message)
+		}
+	}
+	if len(delivered) == 0 && len(next) == 0 {
+		return
+	}
+	// the pipeline may be waiting on the shard, which may be waiting on this writePump
+	go func() {
+		if len(delivered) > 0 {
+			c.hub.pipeline.Submit(userKey(c.userId), func(ctx context.Context) {
+				c.hub.markDelivered(c.userId, delivered, ctx)
+			})
+		}
+		for _, job := range next {
+			c.hub.pipeline.Submit(userKey(c.userId), job)
+		}
+	}()
+}
+
+// CreateNewSocketUser starts serving a websocket connection of the user.
+// resume holds the last sequence number the client has of each conversation, see ParseResume,
+// the messages it missed there are replayed before live delivery.
+func CreateNewSocketUser(hub *Hub, connection *websocket.Conn, userID int64, resume map[int64]int64) {
 
 	client := &Client{
+		id:     uuid.NewString(),
 		hub:    hub,
 		conn:   connection,
 		userId: userID,
-		sendTo: make(chan *Message),
+		sendTo: make(chan *types.SocketEventStruct, hub.sendQueueSize),
+		resume: resume,
+		seqs:   newSeqTracker(resume),
+		recent: newMessageWindow(dedupeWindowSize),
+		stored: newBacklog(),
+
+		addressKeys: make(map[int64]string),
 	}
 
-	go client.readPump()
+	// the connection is registered before it starts reading, so its unregistration always comes after
 	go client.writePump()
-
-	client.hub.register <- client
+	client.hub.shardFor(userID).register <- client
+	client.hub.pipeline.Submit(userKey(userID), func(ctx context.Context) {
+		client.hub.clientConnected(client, ctx)
+	})
+	go client.readPump()
 }
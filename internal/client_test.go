@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"tarun-kavipurapu/test-go-chat/db/dbtest"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/internal/handlers"
+	"tarun-kavipurapu/test-go-chat/types"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialTestSocket serves a socket of the user, resuming the given conversations, on the hub and returns the client end of it.
+func dialTestSocket(t *testing.T, hub *Hub, userId int64, resume map[int64]int64) *websocket.Conn {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		connection, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		CreateNewSocketUser(hub, connection, userId, resume)
+	}))
+	t.Cleanup(server.Close)
+
+	socket, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { socket.Close() })
+	return socket
+}
+
+// socketReader reads the events written to a socket, a frame can hold several events, one per line.
+type socketReader struct {
+	socket  *websocket.Conn
+	pending [][]byte
+}
+
+func (r *socketReader) next(t *testing.T) types.SocketEventRequest {
+	t.Helper()
+	for len(r.pending) == 0 {
+		r.socket.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, frame, err := r.socket.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(frame))
+		scanner.Buffer(nil, maxMessageSize*2)
+		for scanner.Scan() {
+			r.pending = append(r.pending, append([]byte(nil), scanner.Bytes()...))
+		}
+	}
+	var event types.SocketEventRequest
+	if err := json.Unmarshal(r.pending[0], &event); err != nil {
+		t.Fatal(err)
+	}
+	r.pending = r.pending[1:]
+	return event
+}
+
+func (r *socketReader) expectError(t *testing.T, code string) {
+	t.Helper()
+	event := r.next(t)
+	var payload types.SocketErrorPayload
+	json.Unmarshal(event.EventPayload, &payload)
+	if event.EventName != EventError || payload.Code != code {
+		t.Fatalf("got %s %s, want error %s", event.EventName, event.EventPayload, code)
+	}
+}
+
+func (r *socketReader) expectPong(t *testing.T) {
+	t.Helper()
+	if event := r.next(t); event.EventName != EventPong {
+		t.Fatalf("got %s %s, want pong", event.EventName, event.EventPayload)
+	}
+}
+
+func TestReadPumpSurvivesMalformedFrames(t *testing.T) {
+	hub := startTestHub(t, dbtest.NewConn())
+	socket := dialTestSocket(t, hub, 1, nil)
+	reader := &socketReader{socket: socket}
+
+	for _, frame := range []string{`{"eventName":"ping"`, ``, `not json`, `{"eventName":1}`} {
+		if err := socket.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+			t.Fatal(err)
+		}
+		reader.expectError(t, ErrorCodeInvalidEvent)
+	}
+
+	// the connection is still usable
+	socket.WriteJSON(types.SocketEventStruct{EventName: EventPing})
+	reader.expectPong(t)
+}
+
+func TestReadPumpAcceptsFullSizeMessages(t *testing.T) {
+	conn := dbtest.NewConn()
+	conn.OnQuery("GetUserById", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.User{ID: args[0].(int64)}), nil
+	})
+	hub := startTestHub(t, conn)
+	socket := dialTestSocket(t, hub, 1, nil)
+	reader := &socketReader{socket: socket}
+	// content is the JSON of the content, so the test can escape every character the longest way
+	send := func(content string) {
+		frame := `{"eventName":"message.send","eventId":"event","eventPayload":{"from":1,"conversation_id":5,"Content":"` + content + `"}}`
+		if err := socket.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the longest message fits in a frame even with every character escaped as a surrogate pair
+	send(strings.Repeat(`\ud83d\ude00`, handlers.MaxMessageLength))
+	// the fake database has no conversation 5
+	reader.expectError(t, ErrorCodeConversationNotFound)
+
+	// one character more is refused by the handler without closing the connection
+	send(strings.Repeat(`\u003c`, handlers.MaxMessageLength+1))
+	reader.expectError(t, ErrorCodeInvalidPayload)
+
+	socket.WriteJSON(types.SocketEventStruct{EventName: EventPing})
+	reader.expectPong(t)
+}
+
+func TestPendingMessagesAreWrittenAndMarkedInBatches(t *testing.T) {
+	conn := dbtest.NewConn()
+	// 450 messages of user 2 in conversation 1, the ListPendingMessages arguments are user_id, limit and after_id
+	conn.OnQuery("ListPendingMessages", storedMessages(450, 1, 2, 2, 1))
+	conn.OnQuery("MarkMessagesDelivered", func(args []interface{}) ([][]interface{}, error) {
+		var delivered [][]interface{}
+		for _, messageId := range args[0].([]int64) {
+			delivered = append(delivered, []interface{}{messageId})
+		}
+		return delivered, nil
+	})
+	hub := newTestHub(conn)
+	// the author's queue takes every receipt
+	hub.sendQueueSize = 512
+	runTestHub(t, hub)
+	author := connectTestClient(hub, 2)
+	reader := &socketReader{socket: dialTestSocket(t, hub, 1, nil)}
+
+	for id := int64(1); id <= 450; id++ {
+		event := reader.next(t)
+		var message Message
+		json.Unmarshal(event.EventPayload, &message)
+		if event.EventName != EventMessageNew || message.Id != id {
+			t.Fatalf("got %s %s, want message %d", event.EventName, event.EventPayload, id)
+		}
+	}
+	for id := int64(1); id <= 450; id++ {
+		receipt, ok := nextEvent(t, author).EventPayload.(*Receipt)
+		if !ok || receipt.Status != ReceiptDelivered || receipt.MessageId != id || receipt.UserId != 1 {
+			t.Fatalf("author got %+v, want message %d delivered", receipt, id)
+		}
+	}
+
+	calls := conn.Calls("MarkMessagesDelivered")
+	marked := 0
+	for _, call := range calls {
+		marked += len(call[0].([]int64))
+	}
+	if marked != 450 || len(calls) > 450/pendingPageSize+1 {
+		t.Fatalf("%d messages marked delivered in %d queries", marked, len(calls))
+	}
+	if sent := conn.Calls("MarkMessagesSent"); len(sent) != len(calls) {
+		t.Fatalf("%d sent updates for %d delivered marks", len(sent), len(calls))
+	}
+}
@@ -0,0 +1,53 @@
+package internal
+
+import "tarun-kavipurapu/test-go-chat/types"
+
+// Message ids a connection remembers having written. A duplicate comes from a pending flush racing the live
+// delivery of the same message, so it arrives within about a page of pending messages and a send queue.
+const dedupeWindowSize = 512
+
+// messageWindow remembers the ids of the last stored messages written to a connection, so a message reaching
+// it both live and from the database is written once. It is only used by the connection's writePump.
+type messageWindow struct {
+	ids  []int64
+	next int
+}
+
+func newMessageWindow(size int) *messageWindow {
+	return &messageWindow{ids: make([]int64, 0, size)}
+}
+
+// filter drops the message.new events already written and records the others.
+func (w *messageWindow) filter(events []*types.SocketEventStruct) []*types.SocketEventStruct {
+	kept := events[:0]
+	for _, event := range events {
+		message, ok := event.EventPayload.(*Message)
+		if ok && event.EventName == EventMessageNew && message.Id != 0 {
+			if w.contains(message.Id) {
+				continue
+			}
+			w.add(message.Id)
+		}
+		kept = append(kept, event)
+	}
+	return kept
+}
+
+func (w *messageWindow) contains(id int64) bool {
+	for _, seen := range w.ids {
+		if seen == id {
+			return true
+		}
+	}
+	return false
+}
+
+// add records the id, replacing the oldest one once the window is full.
+func (w *messageWindow) add(id int64) {
+	if len(w.ids) < cap(w.ids) {
+		w.ids = append(w.ids, id)
+		return
+	}
+	w.ids[w.next] = id
+	w.next = (w.next + 1) % len(w.ids)
+}
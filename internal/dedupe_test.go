@@ -0,0 +1,39 @@
+package internal
+
+import (
+	"slices"
+	"tarun-kavipurapu/test-go-chat/types"
+	"testing"
+)
+
+func TestMessageWindowDropsDuplicates(t *testing.T) {
+	window := newMessageWindow(4)
+
+	written := window.filter([]*types.SocketEventStruct{
+		newMessageEvent(1, 1, 1),
+		newMessageEvent(2, 1, 2),
+		newSocketEvent(EventTypingStart, &Typing{}),
+		newMessageEvent(1, 1, 1),
+	})
+	if ids := messageIds(written); !slices.Equal(ids, []int64{1, 2}) {
+		t.Fatalf("written %v, want [1 2]", ids)
+	}
+	if len(written) != 3 {
+		t.Fatalf("%d events written, other events must pass", len(written))
+	}
+
+	// the live delivery racing the pending flush arrives in a later batch
+	if written := window.filter([]*types.SocketEventStruct{newMessageEvent(2, 1, 2)}); len(written) != 0 {
+		t.Fatal("message 2 written twice")
+	}
+}
+
+func TestMessageWindowForgetsOldest(t *testing.T) {
+	window := newMessageWindow(2)
+	window.filter([]*types.SocketEventStruct{newMessageEvent(1, 1, 1), newMessageEvent(2, 1, 2), newMessageEvent(3, 1, 3)})
+
+	written := window.filter([]*types.SocketEventStruct{newMessageEvent(1, 1, 1), newMessageEvent(3, 1, 3)})
+	if ids := messageIds(written); !slices.Equal(ids, []int64{1}) {
+		t.Fatalf("written %v, want [1]", ids)
+	}
+}
@@ -0,0 +1,35 @@
+package internal
+
+import (
+	"errors"
+	"tarun-kavipurapu/test-go-chat/types"
+)
+
+var ErrUnknownEvent = errors.New("unknown event")
+
+// EventHandler handles one event read from a client's socket.
+type EventHandler func(c *Client, event *types.SocketEventRequest) error
+
+// Dispatcher routes socket events to the handler registered for their name.
+// Handlers are registered before the hub runs, the map is only read afterwards.
+type Dispatcher struct {
+	handlers map[string]EventHandler
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{handlers: make(map[string]EventHandler)}
+}
+
+// Register sets the handler of an event name, registering a name again replaces its handler.
+func (d *Dispatcher) Register(eventName string, handler EventHandler) {
+	d.handlers[eventName] = handler
+}
+
+// Dispatch calls the handler registered for the event, unknown events return ErrUnknownEvent.
+func (d *Dispatcher) Dispatch(c *Client, event *types.SocketEventRequest) error {
+	handler, ok := d.handlers[event.EventName]
+	if !ok {
+		return ErrUnknownEvent
+	}
+	return handler(c, event)
+}
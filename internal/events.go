@@ -0,0 +1,263 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"tarun-kavipurapu/test-go-chat/internal/handlers"
+	"tarun-kavipurapu/test-go-chat/types"
+	"time"
+	"unicode/utf8"
+)
+
+// Socket event names, every frame on the socket is a types.SocketEventStruct carrying one of them.
+const (
+	// EventMessageSend is sent by a client to post a chat message.
+	EventMessageSend = "message.send"
+	// EventMessageNew delivers a chat message to the members of its conversation.
+	EventMessageNew = "message.new"
+	// EventMessageAck tells the sender that its message was stored.
+	EventMessageAck = "message.ack"
+	// EventMessageEdit and EventMessageDelete are sent by the author of a message to change it.
+	EventMessageEdit   = "message.edit"
+	EventMessageDelete = "message.delete"
+	// EventMessageEdited and EventMessageDeleted carry the changed message to the members of its conversation.
+	EventMessageEdited  = "message.edited"
+	EventMessageDeleted = "message.deleted"
+	// EventReceipt carries delivered and read receipts, clients send it with the read status.
+	EventReceipt = "receipt"
+	// EventError reports a problem with an event sent by the client.
+	EventError = "error"
+	EventPing  = "ping"
+	EventPong  = "pong"
+)
+
+const (
+	// maxClientIdLength matches the client_id column of the message table.
+	maxClientIdLength = 64
+
+	// Files a single message can carry.
+	maxAttachmentsPerMessage = 10
+)
+
+// Error codes of the error event, clients can rely on them staying the same.
+const (
+	ErrorCodeInvalidEvent         = "invalid_event"
+	ErrorCodeUnknownEvent         = "unknown_event"
+	ErrorCodeInvalidPayload       = "invalid_payload"
+	ErrorCodeUnauthorized         = "unauthorized"
+	ErrorCodeUserNotFound         = "user_not_found"
+	ErrorCodeConversationNotFound = "conversation_not_found"
+	ErrorCodePersistFailed        = "persist_failed"
+	ErrorCodeMessageNotFound      = "message_not_found"
+	ErrorCodeNotMessageAuthor     = "not_message_author"
+	ErrorCodeEditWindowExpired    = "edit_window_expired"
+	ErrorCodeInvalidReply         = "invalid_reply"
+	ErrorCodeInvalidAttachment    = "invalid_attachment"
+	ErrorCodeServerError          = "server_error"
+)
+
+const (
+	ReceiptDelivered = "delivered"
+	ReceiptRead      = "read"
+)
+
+// Receipt tells the author of a message that a recipient got or read it.
+// Clients send it with the read status to mark a conversation read up to MessageId.
+type Receipt struct {
+	Status         string    `json:"status"`
+	MessageId      int64     `json:"message_id"`
+	ConversationId int64     `json:"conversation_id"`
+	UserId         int64     `json:"user_id"`
+	At             time.Time `json:"at"`
+
+	// senderId is the author of the message, the receipt is relayed to their connections
+	senderId int64
+}
+
+// MessageAck is the payload of the message.ack event, it pairs the sender's ClientId with the stored message.
+// Duplicate is set when the ClientId was already used and the earlier message is returned.
+type MessageAck struct {
+	Id             int64     `json:"id"`
+	ClientId       string    `json:"client_id,omitempty"`
+	ConversationId int64     `json:"conversation_id"`
+	Seq            int64     `json:"seq"`
+	CreatedAt      time.Time `json:"created_at"`
+	Duplicate      bool      `json:"duplicate"`
+}
+
+// MessageChange is the payload of the message.edit and message.delete events, Content is only read for edits.
+type MessageChange struct {
+	Id      int64  `json:"id"`
+	Content string `json:"content,omitempty"`
+}
+
+// SocketError is returned by event handlers to answer the client with an error event.
+// Only fatal errors close the connection, everything else leaves the session usable.
+type SocketError struct {
+	Code    string
+	Message string
+	Fatal   bool
+}
+
+func (e *SocketError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+var (
+	errInvalidPayload     = &SocketError{Code: ErrorCodeInvalidPayload, Message: "Event payload does not match the event"}
+	errEmptyMessage       = &SocketError{Code: ErrorCodeInvalidPayload, Message: "A message needs content or attachments"}
+	errMessageTooLong     = &SocketError{Code: ErrorCodeInvalidPayload, Message: "Messages can be at most 4000 characters"}
+	errUnauthorizedSender = &SocketError{Code: ErrorCodeUnauthorized, Message: "Auth user and sent user are different", Fatal: true}
+)
+
+// isFatalError reports whether the error ends the connection.
+func isFatalError(err error) bool {
+	var socketErr *SocketError
+	return errors.As(err, &socketErr) && socketErr.Fatal
+}
+
+// clientEvent is an event addressed to a single connection.
+type clientEvent struct {
+	client *Client
+	event  *types.SocketEventStruct
+}
+
+func newSocketEvent(name string, payload interface{}) *types.SocketEventStruct {
+	return &types.SocketEventStruct{EventName: name, EventPayload: payload}
+}
+
+// newErrorEvent converts an error returned while handling the client event eventId into an error event.
+func newErrorEvent(err error, eventId string) *types.SocketEventStruct {
+	var socketErr *SocketError
+	switch {
+	case errors.As(err, &socketErr):
+	case errors.Is(err, ErrUnknownEvent):
+		socketErr = &SocketError{Code: ErrorCodeUnknownEvent, Message: "Unknown event"}
+	default:
+		// internal errors stay in the server log, they can name tables and addresses
+		log.Printf("Unable to handle event %q: %v\n", eventId, err)
+		socketErr = &SocketError{Code: ErrorCodeServerError, Message: "Internal error, please retry"}
+	}
+
+	return newSocketEvent(EventError, &types.SocketErrorPayload{
+		Code:    socketErr.Code,
+		Message: socketErr.Message,
+		EventId: eventId,
+		Close:   socketErr.Fatal,
+	})
+}
+
+// registerEventHandlers wires the events clients are allowed to send.
+func (h *Hub) registerEventHandlers() {
+	h.dispatcher.Register(EventMessageSend, h.onMessageSend)
+	h.dispatcher.Register(EventMessageEdit, h.onMessageEdit)
+	h.dispatcher.Register(EventMessageDelete, h.onMessageDelete)
+	h.dispatcher.Register(EventReactionAdd, h.onReactionAdd)
+	h.dispatcher.Register(EventReactionRemove, h.onReactionRemove)
+	h.dispatcher.Register(EventReceipt, h.onReceipt)
+	h.dispatcher.Register(EventPing, h.onPing)
+	h.dispatcher.Register(EventTypingStart, h.onTypingStart)
+	h.dispatcher.Register(EventTypingStop, h.onTypingStop)
+}
+
+func (h *Hub) onMessageSend(c *Client, event *types.SocketEventRequest) error {
+	var msg Message
+	if err := json.Unmarshal(event.EventPayload, &msg); err != nil {
+		return errInvalidPayload
+	}
+
+	//Here Client.Id comes from the token and msg.from comes from the payload both of them should be same so that we can say we are sending the message by a credible user
+	if c.userId != msg.From {
+		return errUnauthorizedSender
+	}
+	if strings.TrimSpace(msg.Content) == "" && len(msg.AttachmentIds) == 0 {
+		return errEmptyMessage
+	}
+	if utf8.RuneCountInString(msg.Content) > handlers.MaxMessageLength {
+		return errMessageTooLong
+	}
+	if len(msg.ClientId) > maxClientIdLength {
+		return &SocketError{Code: ErrorCodeInvalidPayload, Message: "client_id is too long"}
+	}
+	if len(msg.AttachmentIds) > maxAttachmentsPerMessage {
+		return &SocketError{Code: ErrorCodeInvalidPayload, Message: "A message can carry at most 10 attachments"}
+	}
+	msg.sender = c
+	msg.eventId = event.EventId
+	h.pipeline.Submit(h.addressKey(c, msg.To, msg.ConversationId), func(ctx context.Context) {
+		h.HandleMessageBroadcast(&msg, ctx)
+	})
+	return nil
+}
+
+func (h *Hub) onMessageEdit(c *Client, event *types.SocketEventRequest) error {
+	var change MessageChange
+	if err := json.Unmarshal(event.EventPayload, &change); err != nil {
+		return errInvalidPayload
+	}
+	if change.Id == 0 || strings.TrimSpace(change.Content) == "" {
+		return &SocketError{Code: ErrorCodeInvalidPayload, Message: "Edits need the message id and the new content"}
+	}
+	if utf8.RuneCountInString(change.Content) > handlers.MaxMessageLength {
+		return errMessageTooLong
+	}
+	h.pipeline.Submit(messageKey(change.Id), func(ctx context.Context) {
+		h.HandleMessageEdit(c, &change, event.EventId, ctx)
+	})
+	return nil
+}
+
+func (h *Hub) onMessageDelete(c *Client, event *types.SocketEventRequest) error {
+	var change MessageChange
+	if err := json.Unmarshal(event.EventPayload, &change); err != nil {
+		return errInvalidPayload
+	}
+	if change.Id == 0 {
+		return &SocketError{Code: ErrorCodeInvalidPayload, Message: "Deletes need the message id"}
+	}
+	h.pipeline.Submit(messageKey(change.Id), func(ctx context.Context) {
+		h.HandleMessageDelete(c, &change, event.EventId, ctx)
+	})
+	return nil
+}
+
+// messageChangeError converts an error of an edit or delete into the error event the author gets.
+func messageChangeError(err error) *SocketError {
+	switch {
+	case errors.Is(err, handlers.ErrMessageNotFound):
+		return &SocketError{Code: ErrorCodeMessageNotFound, Message: "Message not found"}
+	case errors.Is(err, handlers.ErrNotMessageAuthor):
+		return &SocketError{Code: ErrorCodeNotMessageAuthor, Message: "Only the author can change a message"}
+	case errors.Is(err, handlers.ErrEditWindowExpired):
+		return &SocketError{Code: ErrorCodeEditWindowExpired, Message: "The message can no longer be edited"}
+	default:
+		return &SocketError{Code: ErrorCodePersistFailed, Message: "Unable to change the message, please retry"}
+	}
+}
+
+func (h *Hub) onReceipt(c *Client, event *types.SocketEventRequest) error {
+	var receipt Receipt
+	if err := json.Unmarshal(event.EventPayload, &receipt); err != nil {
+		return errInvalidPayload
+	}
+	if receipt.Status != ReceiptRead || receipt.ConversationId == 0 || receipt.MessageId == 0 {
+		return &SocketError{Code: ErrorCodeInvalidPayload, Message: "Only read receipts with a conversation and message id can be sent"}
+	}
+
+	// read receipts always belong to the authenticated user
+	receipt.UserId = c.userId
+	h.pipeline.Submit(conversationKey(receipt.ConversationId), func(ctx context.Context) {
+		h.HandleReadEvent(&receipt, ctx)
+	})
+	return nil
+}
+
+func (h *Hub) onPing(c *Client, event *types.SocketEventRequest) error {
+	pong := newSocketEvent(EventPong, nil)
+	pong.EventId = event.EventId
+	h.reply(c, pong)
+	return nil
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"tarun-kavipurapu/test-go-chat/db/dbtest"
+	"tarun-kavipurapu/test-go-chat/types"
+	"testing"
+)
+
+// dispatch sends the client an event as if it was read from its socket.
+func dispatch(client *Client, name string, payload interface{}) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		panic(err)
+	}
+	return client.hub.dispatcher.Dispatch(client, &types.SocketEventRequest{EventName: name, EventId: "event", EventPayload: raw})
+}
+
+// expectSocketError checks that err answers the client with the error code.
+func expectSocketError(t testing.TB, err error, code string) {
+	t.Helper()
+	var socketErr *SocketError
+	if !errors.As(err, &socketErr) || socketErr.Code != code {
+		t.Fatalf("err = %v, want %s", err, code)
+	}
+}
+
+func TestReceiptsOnlyMarkRead(t *testing.T) {
+	hub := newTestHub(dbtest.NewConn())
+	client := newTestClient(hub, 1)
+
+	// delivered receipts are the server's to send
+	err := dispatch(client, EventReceipt, Receipt{Status: ReceiptDelivered, ConversationId: 1, MessageId: 1})
+	expectSocketError(t, err, ErrorCodeInvalidPayload)
+	err = dispatch(client, EventReceipt, Receipt{Status: ReceiptRead, MessageId: 1})
+	expectSocketError(t, err, ErrorCodeInvalidPayload)
+}
+
+func TestDispatchRejectsUnknownEvents(t *testing.T) {
+	hub := newTestHub(dbtest.NewConn())
+	client := newTestClient(hub, 1)
+
+	err := dispatch(client, "message.shout", Message{From: 1})
+	if !errors.Is(err, ErrUnknownEvent) {
+		t.Fatalf("err = %v, want ErrUnknownEvent", err)
+	}
+	payload := newErrorEvent(err, "event").EventPayload.(*types.SocketErrorPayload)
+	if payload.Code != ErrorCodeUnknownEvent || payload.EventId != "event" || payload.Close {
+		t.Fatalf("error event %+v, want a non fatal unknown_event for the event", payload)
+	}
+}
+
+func TestErrorEventHidesInternalErrors(t *testing.T) {
+	err := errors.New(`failed to connect to host=db.internal user=chat: dial tcp 10.0.0.5:5432`)
+	payload := newErrorEvent(err, "event").EventPayload.(*types.SocketErrorPayload)
+	if payload.Code != ErrorCodeServerError || strings.Contains(payload.Message, "10.0.0.5") {
+		t.Fatalf("error event %+v, want a server_error without the internal error", payload)
+	}
+}
+
+func TestMessageSendValidatesPayload(t *testing.T) {
+	hub := newTestHub(dbtest.NewConn())
+	client := newTestClient(hub, 1)
+
+	err := client.hub.dispatcher.Dispatch(client, &types.SocketEventRequest{EventName: EventMessageSend, EventPayload: []byte(`"hello"`)})
+	expectSocketError(t, err, ErrorCodeInvalidPayload)
+
+	err = dispatch(client, EventMessageSend, Message{From: 1, To: 2, Content: "hi", ClientId: string(make([]byte, maxClientIdLength+1))})
+	expectSocketError(t, err, ErrorCodeInvalidPayload)
+
+	for _, content := range []string{"", " \n\t "} {
+		err = dispatch(client, EventMessageSend, Message{From: 1, To: 2, Content: content})
+		expectSocketError(t, err, ErrorCodeInvalidPayload)
+	}
+	err = dispatch(client, EventMessageSend, Message{From: 1, To: 2, AttachmentIds: make([]int64, maxAttachmentsPerMessage+1)})
+	expectSocketError(t, err, ErrorCodeInvalidPayload)
+	// attachments make up for the content
+	if err = dispatch(client, EventMessageSend, Message{From: 1, To: 2, AttachmentIds: []int64{7}}); err != nil {
+		t.Fatalf("a message with only an attachment was refused: %v", err)
+	}
+	// sending as somebody else ends the session
+	err = dispatch(client, EventMessageSend, Message{From: 2, To: 1, Content: "hi"})
+	expectSocketError(t, err, ErrorCodeUnauthorized)
+	if !isFatalError(err) || !newErrorEvent(err, "").EventPayload.(*types.SocketErrorPayload).Close {
+		t.Fatal("impersonation must close the connection")
+	}
+}
+
+func TestPingIsAnsweredWithItsEventId(t *testing.T) {
+	hub := newTestHub(dbtest.NewConn())
+	client := newTestClient(hub, 1)
+
+	go dispatch(client, EventPing, nil)
+	reply := <-hub.shardFor(1).replies
+	if reply.client != client || reply.event.EventName != EventPong || reply.event.EventId != "event" {
+		t.Fatalf("got %s %q, want pong for the ping's event id", reply.event.EventName, reply.event.EventId)
+	}
+}
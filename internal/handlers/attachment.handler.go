@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/internal/middlewares"
+	"tarun-kavipurapu/test-go-chat/internal/storage"
+	"tarun-kavipurapu/test-go-chat/types"
+	"tarun-kavipurapu/test-go-chat/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// MaxAttachmentSize is the largest file that can be uploaded.
+	MaxAttachmentSize = 25 << 20
+
+	// How long a signed download URL stays valid.
+	attachmentURLExpiry = 15 * time.Minute
+
+	// Bytes looked at to find the real content type of an upload.
+	sniffLength = 512
+)
+
+// inlineTypes are shown by the browser, every other file is downloaded so an uploaded page or script never runs on our origin
+var inlineTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// MediaQueue processes image uploads in the background
+type MediaQueue interface {
+	Enqueue(attachmentId int64)
+}
+
+// AttachmentHandler uploads files to the blob store and serves them to the members of the conversation they were sent to
+type AttachmentHandler struct {
+	store db.Store
+	blobs storage.BlobStore
+	media MediaQueue
+}
+
+func NewAttachmentHandler(store db.Store, blobs storage.BlobStore, media MediaQueue) *AttachmentHandler {
+	return &AttachmentHandler{store: store, blobs: blobs, media: media}
+}
+
+// UploadAttachment stores the file of the multipart field "file" and returns its id,
+// which the caller then sends in the attachment_ids of a message
+func (a *AttachmentHandler) UploadAttachment(ctx *gin.Context) {
+	// the multipart framing needs a little room on top of the file
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, MaxAttachmentSize+1<<20)
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Send the file in the file field, at most 25 MB"})
+		return
+	}
+	if header.Size > MaxAttachmentSize {
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Attachments can be at most 25 MB"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Unable to read the file"})
+		return
+	}
+	defer file.Close()
+
+	// the type the client claims is ignored, the content decides
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Unable to read the file"})
+		return
+	}
+	head = head[:n]
+	mimeType := http.DetectContentType(head)
+
+	checksum := sha256.New()
+	body := io.TeeReader(io.MultiReader(bytes.NewReader(head), file), checksum)
+	key := "attachments/" + utils.GenerateUniqueFilename(header.Filename)
+	if err := a.blobs.Put(ctx, key, body, header.Size, mimeType); err != nil {
+		log.Printf("Unable to store attachment %s: %v\n", key, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Store the File"})
+		return
+	}
+
+	attachment, err := a.store.CreateAttachment(ctx, db.CreateAttachmentParams{
+		UploaderID: middlewares.GetAuthUserId(ctx),
+		StorageKey: key,
+		Filename:   truncateFilename(header.Filename),
+		MimeType:   mimeType,
+		SizeBytes:  header.Size,
+		Checksum:   hex.EncodeToString(checksum.Sum(nil)),
+	})
+	if err != nil {
+		a.blobs.Delete(ctx, key)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Save Attachment in Database"})
+		return
+	}
+	if IsImage(mimeType) {
+		a.media.Enqueue(attachment.ID)
+	}
+
+	ctx.JSON(http.StatusCreated, types.GenerateResponse(NewAttachmentDetails(attachment, nil), "Attachment Uploaded"))
+}
+
+// GetAttachment serves the content of an attachment, by redirecting to a signed URL when the blob store offers one.
+// Until it is sent only the uploader can fetch it, afterwards every member of the conversation can.
+func (a *AttachmentHandler) GetAttachment(ctx *gin.Context) {
+	attachmentId, ok := parseIdParam(ctx, "id")
+	if !ok {
+		return
+	}
+	attachment, ok := a.loadVisibleAttachment(ctx, attachmentId)
+	if !ok {
+		return
+	}
+	serveBlob(ctx, a.blobs, attachment.StorageKey, attachment.SizeBytes, attachment.MimeType, attachment.Filename)
+}
+
+// GetThumbnail serves a thumbnail of an image attachment, the sizes made are listed in its details
+func (a *AttachmentHandler) GetThumbnail(ctx *gin.Context) {
+	attachmentId, ok := parseIdParam(ctx, "id")
+	if !ok {
+		return
+	}
+	attachment, ok := a.loadVisibleAttachment(ctx, attachmentId)
+	if !ok {
+		return
+	}
+	thumbnail, err := a.store.GetAttachmentThumbnail(ctx, db.GetAttachmentThumbnailParams{
+		AttachmentID: attachment.ID,
+		Size:         ctx.Param("size"),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Thumbnail Not Found"})
+		return
+	}
+	serveBlob(ctx, a.blobs, thumbnail.StorageKey, -1, "image/jpeg", thumbnail.Size+"_"+attachment.Filename)
+}
+
+// serveBlob redirects to a signed URL of the blob when the store offers one and streams it otherwise
+func serveBlob(ctx *gin.Context, blobs storage.BlobStore, key string, size int64, mimeType string, filename string) {
+	// the type detected on upload is the one the browser must use
+	ctx.Header("X-Content-Type-Options", "nosniff")
+	download := storage.Download{
+		ContentType:        mimeType,
+		ContentDisposition: contentDisposition(mimeType, filename),
+	}
+	url, err := blobs.SignedURL(ctx, key, attachmentURLExpiry, download)
+	if err == nil {
+		ctx.Redirect(http.StatusFound, url)
+		return
+	}
+	if !errors.Is(err, storage.ErrSignedURLUnsupported) {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Fetch the File"})
+		return
+	}
+
+	content, err := blobs.Open(ctx, key)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "File Not Found"})
+		return
+	}
+	defer content.Close()
+	ctx.DataFromReader(http.StatusOK, size, mimeType, content, map[string]string{
+		"Content-Disposition": download.ContentDisposition,
+	})
+}
+
+// contentDisposition shows safe images in the browser and makes it download every other file
+func contentDisposition(mimeType string, filename string) string {
+	disposition := "attachment"
+	if inlineTypes[mimeType] {
+		disposition = "inline"
+	}
+	return mime.FormatMediaType(disposition, map[string]string{"filename": filename})
+}
+
+// loadVisibleAttachment loads an attachment the caller may see and writes the error response when there is none.
+// Images are kept from the other members until the processor has stripped their location.
+func (a *AttachmentHandler) loadVisibleAttachment(ctx *gin.Context, attachmentId int64) (db.Attachment, bool) {
+	userId := middlewares.GetAuthUserId(ctx)
+	attachment, err := a.store.GetAttachmentById(ctx, attachmentId)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Attachment Not Found"})
+		return db.Attachment{}, false
+	}
+	if !attachment.MessageID.Valid {
+		if attachment.UploaderID != userId {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Attachment Not Found"})
+			return db.Attachment{}, false
+		}
+		return attachment, true
+	}
+
+	message, err := a.store.GetMessageById(ctx, attachment.MessageID.Int64)
+	if err != nil || message.DeletedAt.Valid {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Attachment Not Found"})
+		return db.Attachment{}, false
+	}
+	_, err = a.store.GetConversationMember(ctx, db.GetConversationMemberParams{
+		ConversationID: message.ConversationID,
+		UserID:         userId,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "You are not a Member of this Conversation"})
+		return db.Attachment{}, false
+	}
+	if attachment.UploaderID != userId && IsImage(attachment.MimeType) && !attachment.ProcessedAt.Valid {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "The Attachment is still being Processed"})
+		return db.Attachment{}, false
+	}
+	return attachment, true
+}
+
+// truncateFilename keeps a file name within the filename column
+func truncateFilename(filename string) string {
+	runes := []rune(filename)
+	if len(runes) > 255 {
+		return string(runes[:255])
+	}
+	return filename
+}
+
+// NewAttachmentDetails converts a stored attachment and its thumbnails into their API representation
+func NewAttachmentDetails(row db.Attachment, thumbnails []db.AttachmentThumbnail) types.AttachmentDetails {
+	details := types.AttachmentDetails{
+		Id:         row.ID,
+		Filename:   row.Filename,
+		MimeType:   row.MimeType,
+		Size:       row.SizeBytes,
+		Checksum:   row.Checksum,
+		Processing: IsImage(row.MimeType) && !row.ProcessedAt.Valid,
+	}
+	if row.Width.Valid && row.Height.Valid {
+		details.Width = &row.Width.Int32
+		details.Height = &row.Height.Int32
+	}
+	for _, thumbnail := range thumbnails {
+		details.Thumbnails = append(details.Thumbnails, types.ThumbnailDetails{
+			Size:   thumbnail.Size,
+			Width:  thumbnail.Width,
+			Height: thumbnail.Height,
+		})
+	}
+	return details
+}
+
+// LoadAttachmentDetails converts stored attachments into their API representation with their thumbnails, in the same order
+func LoadAttachmentDetails(ctx context.Context, store db.Store, rows []db.Attachment) ([]types.AttachmentDetails, error) {
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	ids := make([]int64, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+	thumbnails, err := store.ListThumbnailsByAttachmentIds(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byAttachment := make(map[int64][]db.AttachmentThumbnail)
+	for _, thumbnail := range thumbnails {
+		byAttachment[thumbnail.AttachmentID] = append(byAttachment[thumbnail.AttachmentID], thumbnail)
+	}
+	details := make([]types.AttachmentDetails, len(rows))
+	for i, row := range rows {
+		details[i] = NewAttachmentDetails(row, byAttachment[row.ID])
+	}
+	return details, nil
+}
+
+// IsImage reports whether an upload is handed to the media processor
+func IsImage(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "image/")
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"tarun-kavipurapu/test-go-chat/db/dbtest"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/internal/storage"
+	"testing"
+	"time"
+)
+
+// memoryBlobs keeps blobs in a map, signing URLs only when sign is set and keeping the headers last signed.
+type memoryBlobs struct {
+	blobs    map[string]string
+	sign     bool
+	download storage.Download
+}
+
+func (m *memoryBlobs) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	content, err := io.ReadAll(body)
+	m.blobs[key] = string(content)
+	return err
+}
+
+func (m *memoryBlobs) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	content, ok := m.blobs[key]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return io.NopCloser(strings.NewReader(content)), nil
+}
+
+func (m *memoryBlobs) Delete(ctx context.Context, key string) error {
+	delete(m.blobs, key)
+	return nil
+}
+
+func (m *memoryBlobs) SignedURL(ctx context.Context, key string, expiry time.Duration, download storage.Download) (string, error) {
+	if !m.sign {
+		return "", storage.ErrSignedURLUnsupported
+	}
+	m.download = download
+	return "https://blobs.example/" + key, nil
+}
+
+// uploadsConn holds unsent uploads of user 1, their id picks the type: 1 is a png, 2 a web page and 3 an svg.
+func uploadsConn() *dbtest.Conn {
+	mimeTypes := map[int64]string{1: "image/png", 2: "text/html; charset=utf-8", 3: "image/svg+xml"}
+	conn := dbtest.NewConn()
+	conn.OnQuery("GetAttachmentById", func(args []interface{}) ([][]interface{}, error) {
+		id := args[0].(int64)
+		return dbtest.Rows(db.Attachment{ID: id, UploaderID: 1, StorageKey: "attachments/file", Filename: "file", MimeType: mimeTypes[id], SizeBytes: 7}), nil
+	})
+	return conn
+}
+
+func TestAttachmentsAreDownloadedUnlessSafeImages(t *testing.T) {
+	attachments := NewAttachmentHandler(dbtest.NewStore(uploadsConn()), &memoryBlobs{blobs: map[string]string{"attachments/file": "content"}}, nil)
+
+	for id, disposition := range map[string]string{"1": "inline", "2": "attachment", "3": "attachment"} {
+		recorder := serve(attachments.GetAttachment, 1, http.MethodGet, "/attachments/"+id, "", "id", id)
+		expectStatus(t, recorder, http.StatusOK)
+		if got := recorder.Header().Get("Content-Disposition"); got != disposition+`; filename=file` {
+			t.Fatalf("attachment %s served as %q, want %s", id, got, disposition)
+		}
+		if recorder.Header().Get("X-Content-Type-Options") != "nosniff" {
+			t.Fatalf("attachment %s served without nosniff", id)
+		}
+		if recorder.Body.String() != "content" {
+			t.Fatalf("attachment %s served %q", id, recorder.Body.String())
+		}
+	}
+}
+
+func TestSignedAttachmentsRedirect(t *testing.T) {
+	blobs := &memoryBlobs{sign: true}
+	attachments := NewAttachmentHandler(dbtest.NewStore(uploadsConn()), blobs, nil)
+
+	recorder := serve(attachments.GetAttachment, 1, http.MethodGet, "/attachments/2", "", "id", "2")
+	expectStatus(t, recorder, http.StatusFound)
+	if recorder.Header().Get("Location") != "https://blobs.example/attachments/file" || recorder.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatalf("redirected with headers %v", recorder.Header())
+	}
+	// the store serves the redirect with the type and disposition a streamed page gets
+	want := storage.Download{ContentType: "text/html; charset=utf-8", ContentDisposition: "attachment; filename=file"}
+	if blobs.download != want {
+		t.Fatalf("signed with %+v, want %+v", blobs.download, want)
+	}
+
+	// an upload not sent yet is the uploader's alone
+	expectStatus(t, serve(attachments.GetAttachment, 2, http.MethodGet, "/attachments/2", "", "id", "2"), http.StatusNotFound)
+}
@@ -2,11 +2,51 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
 	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/internal/middlewares"
+	"tarun-kavipurapu/test-go-chat/types"
+	"tarun-kavipurapu/test-go-chat/utils"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+
+	// MaxMessageLength is the longest message content accepted, in characters.
+	MaxMessageLength = 4000
+
+	// MessageEditWindow is how long after sending the author may edit a message, deleting has no limit.
+	MessageEditWindow = 15 * time.Minute
+
+	// DeletedMessageContent replaces the content of deleted messages in the history.
+	DeletedMessageContent = "message deleted"
+
+	// MaxReactionEmojis caps the different emojis a message can be reacted with.
+	MaxReactionEmojis = 20
+)
+
+var (
+	ErrNotConversationMember = errors.New("sender is not a member of the conversation")
+	ErrSelfConversation      = errors.New("a direct conversation needs two different users")
+	ErrMessageNotFound       = errors.New("message not found")
+	ErrNotMessageAuthor      = errors.New("only the author can change a message")
+	ErrEditWindowExpired     = errors.New("the message can no longer be edited")
+	ErrTooManyReactions      = errors.New("the message has too many different reactions")
+	ErrInvalidReply          = errors.New("replies must quote a message of the same conversation")
+	ErrInvalidAttachment     = errors.New("attachments must be unused uploads of the sender")
+)
+
+// errDuplicateMessage rolls back the transaction of a message whose client id was already used.
+var errDuplicateMessage = errors.New("duplicate client id")
+
 type ChatHandler struct {
 	store db.Store
 }
@@ -15,25 +55,785 @@ func NewChatHandler(store db.Store) *ChatHandler {
 	return &ChatHandler{store: store}
 }
 
-func (c *ChatHandler) InsertMessage(ctx context.Context, from int64, to int64, content string) error {
+// DirectKey identifies the direct conversation between two users regardless of who started it
+func DirectKey(userA int64, userB int64) string {
+	if userA > userB {
+		userA, userB = userB, userA
+	}
+	return fmt.Sprintf("%d:%d", userA, userB)
+}
+
+// ResolveConversation returns the conversation a message belongs to.
+// When no conversation id is given the direct conversation between from and to is used, and created on first use.
+func (c *ChatHandler) ResolveConversation(ctx context.Context, from int64, to int64, conversationId int64) (db.Conversation, error) {
+	if conversationId != 0 {
+		conversation, err := c.store.GetConversationById(ctx, conversationId)
+		if err != nil {
+			return db.Conversation{}, err
+		}
+		_, err = c.store.GetConversationMember(ctx, db.GetConversationMemberParams{
+			ConversationID: conversationId,
+			UserID:         from,
+		})
+		if err != nil {
+			return db.Conversation{}, ErrNotConversationMember
+		}
+		return conversation, nil
+	}
+
+	if from == to {
+		return db.Conversation{}, ErrSelfConversation
+	}
+	key := pgtype.Text{String: DirectKey(from, to), Valid: true}
+	conversation, err := c.store.GetDirectConversation(ctx, key)
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return conversation, err
+	}
+	err = c.store.ExecTx(ctx, func(q *db.Queries) error {
+		var err error
+		conversation, err = q.CreateDirectConversation(ctx, key)
+		if errors.Is(err, pgx.ErrNoRows) {
+			// created concurrently, its transaction has added the members as well
+			conversation, err = q.GetDirectConversation(ctx, key)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		for _, userId := range []int64{from, to} {
+			err = q.AddConversationMember(ctx, db.AddConversationMemberParams{
+				ConversationID: conversation.ID,
+				UserID:         userId,
+				Role:           RoleMember,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return conversation, err
+}
+
+// NewMessage is a message to store, see InsertMessage.
+type NewMessage struct {
+	From           int64
+	To             int64 // zero for group messages
+	ConversationId int64
+	Content        string
+	ClientId       string
+	// ReplyTo quotes a message of the same conversation, zero for none
+	ReplyTo int64
+	// AttachmentIds are uploads of the sender not attached to a message yet
+	AttachmentIds []int64
+}
+
+// InsertMessage stores the message with the next sequence number of its conversation and
+// a pending delivery row for every other member of the conversation.
+// A reply is counted on the message it quotes, and the attachments are linked to the message.
+// When the sender already stored a message with the same ClientId, that message is returned with duplicate set.
+func (c *ChatHandler) InsertMessage(ctx context.Context, params NewMessage) (message db.Message, duplicate bool, err error) {
+	from, to, conversationId := params.From, params.To, params.ConversationId
+	replyTo, clientId := params.ReplyTo, params.ClientId
+	err = c.store.ExecTx(ctx, func(q *db.Queries) error {
+		if replyTo != 0 {
+			quoted, err := q.GetMessageById(ctx, replyTo)
+			if errors.Is(err, pgx.ErrNoRows) || (err == nil && quoted.ConversationID != conversationId) {
+				return ErrInvalidReply
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		// taking the number locks the conversation, so numbers are committed in order and never skipped
+		seq, err := q.NextConversationSeq(ctx, conversationId)
+		if err != nil {
+			return err
+		}
+		message, err = q.InsertMessage(ctx, db.InsertMessageParams{
+			FromUserID:     from,
+			ToUserID:       pgtype.Int8{Int64: to, Valid: to != 0}, // group messages have no single recipient
+			ConversationID: conversationId,
+			IsSent:         false, // becomes true once every recipient got it, see MarkDelivered
+			Content:        params.Content,
+			ClientID:       pgtype.Text{String: clientId, Valid: clientId != ""},
+			Seq:            seq,
+			ReplyTo:        pgtype.Int8{Int64: replyTo, Valid: replyTo != 0},
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			// the insert hit the (from_user_id, client_id) constraint, this is a retry.
+			// Rolling back gives the sequence number back.
+			return errDuplicateMessage
+		}
+		if err != nil {
+			return err
+		}
+
+		// keep the inbox of every member current, see ConversationHandler.ListConversations
+		err = q.SetConversationLastMessage(ctx, db.SetConversationLastMessageParams{
+			ID:            conversationId,
+			LastMessageID: pgtype.Int8{Int64: message.ID, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		err = q.RecordConversationMessage(ctx, db.RecordConversationMessageParams{
+			ConversationID: conversationId,
+			CreatedAt:      message.CreatedAt.Time,
+			SenderID:       from,
+		})
+		if err != nil {
+			return err
+		}
 
-	_, err := c.store.InsertMessage(ctx, db.InsertMessageParams{
-		FromUserID: from,
-		ToUserID:   to,
-		IsSent:     true, //change this IsSent accordingly and make necessary changes in future for adding any new features
-		Content:    content,
+		if len(params.AttachmentIds) > 0 {
+			attached, err := q.AttachToMessage(ctx, db.AttachToMessageParams{
+				MessageID:  message.ID,
+				Ids:        params.AttachmentIds,
+				UploaderID: from,
+			})
+			if err != nil {
+				return err
+			}
+			if len(attached) != len(params.AttachmentIds) {
+				return ErrInvalidAttachment
+			}
+		}
+
+		if replyTo != 0 {
+			err = q.RecordMessageReply(ctx, db.RecordMessageReplyParams{
+				ID:        replyTo,
+				RepliedAt: message.CreatedAt.Time,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		recipients, err := q.InsertMessageRecipients(ctx, db.InsertMessageRecipientsParams{
+			MessageID:      message.ID,
+			ConversationID: conversationId,
+			SenderID:       from,
+		})
+		if err != nil {
+			return err
+		}
+		if recipients == 0 {
+			message.IsSent = true
+			return q.MarkMessageSent(ctx, message.ID)
+		}
+		return nil
 	})
+	if errors.Is(err, errDuplicateMessage) {
+		message, err = c.store.GetMessageByClientId(ctx, db.GetMessageByClientIdParams{
+			FromUserID: from,
+			ClientID:   pgtype.Text{String: clientId, Valid: true},
+		})
+		return message, err == nil, err
+	}
 
+	return message, false, err
+}
+
+// Attachments returns the attachments of the messages by message id, in upload order.
+func (c *ChatHandler) Attachments(ctx context.Context, messageIds []int64) (map[int64][]types.AttachmentDetails, error) {
+	rows, err := c.store.ListAttachmentsByMessageIds(ctx, messageIds)
+	if err != nil {
+		return nil, err
+	}
+	details, err := LoadAttachmentDetails(ctx, c.store, rows)
 	if err != nil {
+		return nil, err
+	}
+	attachments := make(map[int64][]types.AttachmentDetails)
+	for i, row := range rows {
+		attachments[row.MessageID.Int64] = append(attachments[row.MessageID.Int64], details[i])
+	}
+	return attachments, nil
+}
+
+// MessagesAfterSeq returns up to limit messages of the conversation numbered after afterSeq, in order.
+func (c *ChatHandler) MessagesAfterSeq(ctx context.Context, conversationId int64, afterSeq int64, limit int32) ([]db.Message, error) {
+	return c.store.ListConversationMessagesAfterSeq(ctx, db.ListConversationMessagesAfterSeqParams{
+		ConversationID: conversationId,
+		AfterSeq:       afterSeq,
+		Limit:          limit,
+	})
+}
+
+// EditMessage replaces the content of a message sent by userId within MessageEditWindow,
+// the content it had until now is kept in its edit history.
+func (c *ChatHandler) EditMessage(ctx context.Context, userId int64, messageId int64, content string) (db.Message, error) {
+	var message db.Message
+	err := c.store.ExecTx(ctx, func(q *db.Queries) error {
+		current, err := c.lockOwnMessage(ctx, q, userId, messageId)
+		if err != nil {
+			return err
+		}
+		if time.Since(current.CreatedAt.Time) > MessageEditWindow {
+			return ErrEditWindowExpired
+		}
+		err = q.InsertMessageEdit(ctx, db.InsertMessageEditParams{
+			MessageID: messageId,
+			Content:   current.Content,
+		})
+		if err != nil {
+			return err
+		}
+		message, err = q.UpdateMessageContent(ctx, db.UpdateMessageContentParams{
+			ID:      messageId,
+			Content: content,
+		})
+		return err
+	})
+	return message, err
+}
+
+// DeleteMessage turns a message sent by userId into a tombstone, its content and edit history are discarded.
+// A deleted reply no longer counts in the thread of the message it quotes.
+func (c *ChatHandler) DeleteMessage(ctx context.Context, userId int64, messageId int64) (db.Message, error) {
+	var message db.Message
+	err := c.store.ExecTx(ctx, func(q *db.Queries) error {
+		if _, err := c.lockOwnMessage(ctx, q, userId, messageId); err != nil {
+			return err
+		}
+		if err := q.DeleteMessageEdits(ctx, messageId); err != nil {
+			return err
+		}
+		var err error
+		message, err = q.SoftDeleteMessage(ctx, messageId)
+		if err != nil || !message.ReplyTo.Valid {
+			return err
+		}
+		return q.RecountMessageReplies(ctx, message.ReplyTo.Int64)
+	})
+	return message, err
+}
+
+// AddReaction reacts to a message of a conversation the user belongs to with an emoji.
+// It reports false when the user already reacted with that emoji.
+func (c *ChatHandler) AddReaction(ctx context.Context, userId int64, messageId int64, emoji string) (db.Message, bool, error) {
+	var message db.Message
+	added := false
+	err := c.store.ExecTx(ctx, func(q *db.Queries) error {
+		// the lock serializes the reactions of the message, so the cap holds
+		var err error
+		message, err = c.lockMemberMessage(ctx, q, userId, messageId)
+		if err != nil {
+			return err
+		}
+		used, err := q.HasMessageReactionEmoji(ctx, db.HasMessageReactionEmojiParams{MessageID: messageId, Emoji: emoji})
+		if err != nil {
+			return err
+		}
+		if !used {
+			emojis, err := q.CountMessageReactionEmojis(ctx, messageId)
+			if err != nil {
+				return err
+			}
+			if emojis >= MaxReactionEmojis {
+				return ErrTooManyReactions
+			}
+		}
+		rows, err := q.AddMessageReaction(ctx, db.AddMessageReactionParams{MessageID: messageId, UserID: userId, Emoji: emoji})
+		added = rows > 0
+		return err
+	})
+	return message, added, err
+}
+
+// RemoveReaction takes back the user's reaction to a message, it reports false when there was none.
+func (c *ChatHandler) RemoveReaction(ctx context.Context, userId int64, messageId int64, emoji string) (db.Message, bool, error) {
+	var message db.Message
+	removed := false
+	err := c.store.ExecTx(ctx, func(q *db.Queries) error {
+		var err error
+		message, err = c.lockMemberMessage(ctx, q, userId, messageId)
+		if err != nil {
+			return err
+		}
+		rows, err := q.RemoveMessageReaction(ctx, db.RemoveMessageReactionParams{MessageID: messageId, UserID: userId, Emoji: emoji})
+		removed = rows > 0
 		return err
+	})
+	return message, removed, err
+}
+
+// lockMemberMessage loads a message for the rest of the transaction and checks that userId belongs to its conversation.
+func (c *ChatHandler) lockMemberMessage(ctx context.Context, q *db.Queries, userId int64, messageId int64) (db.Message, error) {
+	message, err := q.GetMessageForUpdate(ctx, messageId)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && message.DeletedAt.Valid) {
+		return db.Message{}, ErrMessageNotFound
+	}
+	if err != nil {
+		return db.Message{}, err
+	}
+	_, err = q.GetConversationMember(ctx, db.GetConversationMemberParams{
+		ConversationID: message.ConversationID,
+		UserID:         userId,
+	})
+	if err != nil {
+		return db.Message{}, ErrNotConversationMember
+	}
+	return message, nil
+}
+
+// lockOwnMessage loads a message for the rest of the transaction and checks that userId wrote it.
+func (c *ChatHandler) lockOwnMessage(ctx context.Context, q *db.Queries, userId int64, messageId int64) (db.Message, error) {
+	message, err := q.GetMessageForUpdate(ctx, messageId)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && message.DeletedAt.Valid) {
+		return db.Message{}, ErrMessageNotFound
+	}
+	if err != nil {
+		return db.Message{}, err
+	}
+	if message.FromUserID != userId {
+		return db.Message{}, ErrNotMessageAuthor
+	}
+	return message, nil
+}
+
+// PendingMessages returns a page of the messages not yet delivered to the user with an id after afterId, oldest first.
+func (c *ChatHandler) PendingMessages(ctx context.Context, userId int64, afterId int64, limit int32) ([]db.Message, error) {
+	return c.store.ListPendingMessages(ctx, db.ListPendingMessagesParams{
+		UserID:  userId,
+		AfterID: afterId,
+		Limit:   limit,
+	})
+}
+
+// MarkDelivered records that the messages were written to one of the user's connections.
+// It returns the ones delivered for the first time, later devices of the same user do not count again.
+func (c *ChatHandler) MarkDelivered(ctx context.Context, userId int64, messageIds []int64) ([]int64, error) {
+	delivered, err := c.store.MarkMessagesDelivered(ctx, db.MarkMessagesDeliveredParams{
+		MessageIds: messageIds,
+		UserID:     userId,
+	})
+	if err != nil || len(delivered) == 0 {
+		return nil, err
+	}
+	return delivered, c.store.MarkMessagesSent(ctx, delivered)
+}
+
+// MarkRead marks the user's messages of a conversation as read up to and including upToMessageId.
+// It returns, per sender, the newest of their messages that became read.
+func (c *ChatHandler) MarkRead(ctx context.Context, userId int64, conversationId int64, upToMessageId int64) (map[int64]int64, error) {
+	newestBySender := make(map[int64]int64)
+	err := c.store.ExecTx(ctx, func(q *db.Queries) error {
+		rows, err := q.MarkConversationRead(ctx, db.MarkConversationReadParams{
+			UserID:         userId,
+			ConversationID: conversationId,
+			UpToMessageID:  upToMessageId,
+		})
+		if err != nil || len(rows) == 0 {
+			return err
+		}
+
+		for _, row := range rows {
+			// reading implies delivery, so the message may now be sent to everyone
+			if err := q.MarkMessageSent(ctx, row.MessageID); err != nil {
+				return err
+			}
+			if row.MessageID > newestBySender[row.FromUserID] {
+				newestBySender[row.FromUserID] = row.MessageID
+			}
+		}
+		return q.DecrementUnreadCount(ctx, db.DecrementUnreadCountParams{
+			ConversationID: conversationId,
+			UserID:         userId,
+			Read:           int32(len(rows)),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newestBySender, nil
+}
+
+// GetConversationMessages returns a page of the conversation history, newest first
+func (c *ChatHandler) GetConversationMessages(ctx *gin.Context) {
+	conversationId, ok := parseIdParam(ctx, "id")
+	if !ok {
+		return
+	}
+
+	_, err := c.store.GetConversationMember(ctx, db.GetConversationMemberParams{
+		ConversationID: conversationId,
+		UserID:         middlewares.GetAuthUserId(ctx),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "You are not a Member of this Conversation"})
+		return
+	}
+
+	c.respondWithMessagePage(ctx, conversationId)
+}
+
+// GetDirectMessages returns a page of the direct conversation between the caller and another user
+func (c *ChatHandler) GetDirectMessages(ctx *gin.Context) {
+	peerId, ok := parseIdParam(ctx, "userId")
+	if !ok {
+		return
+	}
+
+	key := DirectKey(middlewares.GetAuthUserId(ctx), peerId)
+	conversation, err := c.store.GetDirectConversation(ctx, pgtype.Text{String: key, Valid: true})
+	if errors.Is(err, pgx.ErrNoRows) {
+		// nothing was ever sent between the two users
+		ctx.JSON(http.StatusOK, types.GenerateResponse(types.MessagePage{Messages: []types.MessageDetails{}}, "Messages Fetched"))
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Fetch Conversation from Database"})
+		return
+	}
+
+	c.respondWithMessagePage(ctx, conversation.ID)
+}
+
+func (c *ChatHandler) respondWithMessagePage(ctx *gin.Context, conversationId int64) {
+	var query types.MessageHistoryQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Parsing request Error"})
+		return
+	}
+	if query.Before != "" && query.After != "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Use either before or after, not both"})
+		return
 	}
 
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	rows, err := c.listMessages(ctx, conversationId, query, limit+1)
+	if errors.Is(err, utils.ErrInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Fetch Messages from Database"})
+		return
+	}
+
+	// one extra row is fetched to know whether another page exists
+	page := types.MessagePage{HasMore: len(rows) > int(limit)}
+	if page.HasMore {
+		rows = rows[:limit]
+	}
+	if query.After != "" {
+		// rows after a cursor come oldest first
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	page.Messages = make([]types.MessageDetails, 0, len(rows))
+	for _, row := range rows {
+		page.Messages = append(page.Messages, NewMessageDetails(row))
+	}
+	if !c.decorateMessages(ctx, page.Messages) {
+		return
+	}
+	if len(rows) > 0 {
+		newest, oldest := rows[0], rows[len(rows)-1]
+		page.After = utils.EncodeCursor(newest.CreatedAt.Time, newest.ID)
+		page.Before = utils.EncodeCursor(oldest.CreatedAt.Time, oldest.ID)
+	}
+
+	ctx.JSON(http.StatusOK, types.GenerateResponse(page, "Messages Fetched"))
+}
+
+func (c *ChatHandler) listMessages(ctx context.Context, conversationId int64, query types.MessageHistoryQuery, limit int32) ([]db.Message, error) {
+	switch {
+	case query.Before != "":
+		createdAt, id, err := utils.DecodeCursor(query.Before)
+		if err != nil {
+			return nil, err
+		}
+		return c.store.ListConversationMessagesBefore(ctx, db.ListConversationMessagesBeforeParams{
+			ConversationID:  conversationId,
+			Limit:           limit,
+			CursorCreatedAt: createdAt,
+			CursorID:        id,
+		})
+	case query.After != "":
+		createdAt, id, err := utils.DecodeCursor(query.After)
+		if err != nil {
+			return nil, err
+		}
+		return c.store.ListConversationMessagesAfter(ctx, db.ListConversationMessagesAfterParams{
+			ConversationID:  conversationId,
+			Limit:           limit,
+			CursorCreatedAt: createdAt,
+			CursorID:        id,
+		})
+	default:
+		return c.store.ListLatestConversationMessages(ctx, db.ListLatestConversationMessagesParams{
+			ConversationID: conversationId,
+			Limit:          limit,
+		})
+	}
+}
+
+// GetThread returns a message with a page of its replies, oldest first
+func (c *ChatHandler) GetThread(ctx *gin.Context) {
+	messageId, ok := parseIdParam(ctx, "id")
+	if !ok {
+		return
+	}
+	var query types.ThreadQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Parsing request Error"})
+		return
+	}
+
+	parent, err := c.store.GetMessageById(ctx, messageId)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Message Not Found"})
+		return
+	}
+	_, err = c.store.GetConversationMember(ctx, db.GetConversationMemberParams{
+		ConversationID: parent.ConversationID,
+		UserID:         middlewares.GetAuthUserId(ctx),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "You are not a Member of this Conversation"})
+		return
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	rows, err := c.listReplies(ctx, messageId, query.After, limit+1)
+	if errors.Is(err, utils.ErrInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Fetch Replies from Database"})
+		return
+	}
+
+	// one extra row is fetched to know whether another page exists
+	page := types.ThreadPage{HasMore: len(rows) > int(limit)}
+	if page.HasMore {
+		rows = rows[:limit]
+	}
+	messages := make([]types.MessageDetails, 0, len(rows)+1)
+	messages = append(messages, NewMessageDetails(parent))
+	for _, row := range rows {
+		messages = append(messages, NewMessageDetails(row))
+	}
+	if !c.decorateMessages(ctx, messages) {
+		return
+	}
+	page.Parent, page.Replies = messages[0], messages[1:]
+	if len(rows) > 0 {
+		newest := rows[len(rows)-1]
+		page.After = utils.EncodeCursor(newest.CreatedAt.Time, newest.ID)
+	}
+
+	ctx.JSON(http.StatusOK, types.GenerateResponse(page, "Thread Fetched"))
+}
+
+func (c *ChatHandler) listReplies(ctx context.Context, messageId int64, after string, limit int32) ([]db.Message, error) {
+	if after == "" {
+		return c.store.ListThreadReplies(ctx, db.ListThreadRepliesParams{
+			ReplyTo: pgtype.Int8{Int64: messageId, Valid: true},
+			Limit:   limit,
+		})
+	}
+	createdAt, id, err := utils.DecodeCursor(after)
+	if err != nil {
+		return nil, err
+	}
+	return c.store.ListThreadRepliesAfter(ctx, db.ListThreadRepliesAfterParams{
+		ReplyTo:         pgtype.Int8{Int64: messageId, Valid: true},
+		Limit:           limit,
+		CursorCreatedAt: createdAt,
+		CursorID:        id,
+	})
+}
+
+// decorateMessages adds the receipts, reactions and quoted messages to a page of messages.
+// It writes the error response and reports false when one of them cannot be loaded.
+func (c *ChatHandler) decorateMessages(ctx *gin.Context, messages []types.MessageDetails) bool {
+	if err := c.attachReceipts(ctx, messages); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Fetch Receipts from Database"})
+		return false
+	}
+	if err := c.attachReactions(ctx, middlewares.GetAuthUserId(ctx), messages); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Fetch Reactions from Database"})
+		return false
+	}
+	if err := c.attachQuotes(ctx, messages); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Fetch Quoted Messages from Database"})
+		return false
+	}
+	if err := c.attachAttachments(ctx, messages); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Fetch Attachments from Database"})
+		return false
+	}
+	return true
+}
+
+// attachAttachments adds the files of the messages, deleted messages keep none
+func (c *ChatHandler) attachAttachments(ctx context.Context, messages []types.MessageDetails) error {
+	messageIds := make([]int64, 0, len(messages))
+	for _, message := range messages {
+		if !message.Deleted {
+			messageIds = append(messageIds, message.Id)
+		}
+	}
+	attachments, err := c.Attachments(ctx, messageIds)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		if found, ok := attachments[messages[i].Id]; ok {
+			messages[i].Attachments = found
+		}
+	}
+	return nil
+}
+
+// attachQuotes fills in the preview of the messages that replies quote
+func (c *ChatHandler) attachQuotes(ctx context.Context, messages []types.MessageDetails) error {
+	var quotedIds []int64
+	for _, message := range messages {
+		if message.ReplyTo != nil {
+			quotedIds = append(quotedIds, message.ReplyTo.Id)
+		}
+	}
+	if len(quotedIds) == 0 {
+		return nil
+	}
+	rows, err := c.store.ListMessagesByIds(ctx, quotedIds)
+	if err != nil {
+		return err
+	}
+
+	quoted := make(map[int64]db.Message, len(rows))
+	for _, row := range rows {
+		quoted[row.ID] = row
+	}
+	for i := range messages {
+		if messages[i].ReplyTo == nil {
+			continue
+		}
+		row, ok := quoted[messages[i].ReplyTo.Id]
+		if !ok {
+			continue
+		}
+		messages[i].ReplyTo.From = row.FromUserID
+		messages[i].ReplyTo.Content = preview(row.Content)
+		if row.DeletedAt.Valid {
+			messages[i].ReplyTo.Content = DeletedMessageContent
+			messages[i].ReplyTo.Deleted = true
+		}
+	}
 	return nil
 }
 
-func (c *ChatHandler) GetMessage(ctx *gin.Context) {
-	//get Messages By either sending as a Requst Object or a  Query Parameters
-	// c.store.GetMessages(ctx, db.GetMessagesParams{
-	// 	FromUserID: ,
-	// })
+// attachReceipts adds the delivery and read state of every recipient to the messages
+func (c *ChatHandler) attachReceipts(ctx context.Context, messages []types.MessageDetails) error {
+	messageIds := make([]int64, 0, len(messages))
+	for _, message := range messages {
+		messageIds = append(messageIds, message.Id)
+	}
+	rows, err := c.store.ListMessageReceipts(ctx, messageIds)
+	if err != nil {
+		return err
+	}
+
+	receipts := make(map[int64][]types.ReceiptDetails)
+	for _, row := range rows {
+		receipt := types.ReceiptDetails{UserId: row.UserID}
+		if row.DeliveredAt.Valid {
+			receipt.DeliveredAt = &row.DeliveredAt.Time
+		}
+		if row.ReadAt.Valid {
+			receipt.ReadAt = &row.ReadAt.Time
+		}
+		receipts[row.MessageID] = append(receipts[row.MessageID], receipt)
+	}
+	for i := range messages {
+		if found, ok := receipts[messages[i].Id]; ok {
+			messages[i].Receipts = found
+		}
+	}
+	return nil
+}
+
+// attachReactions adds how often each emoji was used on the messages and whether userId used it
+func (c *ChatHandler) attachReactions(ctx context.Context, userId int64, messages []types.MessageDetails) error {
+	messageIds := make([]int64, 0, len(messages))
+	for _, message := range messages {
+		messageIds = append(messageIds, message.Id)
+	}
+	rows, err := c.store.ListReactionCounts(ctx, db.ListReactionCountsParams{
+		UserID:     userId,
+		MessageIds: messageIds,
+	})
+	if err != nil {
+		return err
+	}
+
+	reactions := make(map[int64][]types.ReactionDetails)
+	for _, row := range rows {
+		reactions[row.MessageID] = append(reactions[row.MessageID], types.ReactionDetails{
+			Emoji:   row.Emoji,
+			Count:   row.Count,
+			Reacted: row.Reacted,
+		})
+	}
+	for i := range messages {
+		if found, ok := reactions[messages[i].Id]; ok {
+			messages[i].Reactions = found
+		}
+	}
+	return nil
+}
+
+// NewMessageDetails converts a stored message into its API representation
+func NewMessageDetails(row db.Message) types.MessageDetails {
+	details := types.MessageDetails{
+		Id:             row.ID,
+		From:           row.FromUserID,
+		To:             row.ToUserID.Int64,
+		ConversationId: row.ConversationID,
+		Seq:            row.Seq,
+		Content:        row.Content,
+		ClientId:       row.ClientID.String,
+		CreatedAt:      row.CreatedAt.Time,
+		ReplyCount:     row.ReplyCount,
+		Receipts:       []types.ReceiptDetails{},
+		Reactions:      []types.ReactionDetails{},
+		Attachments:    []types.AttachmentDetails{},
+	}
+	if row.ReplyTo.Valid {
+		details.ReplyTo = &types.QuotedMessage{Id: row.ReplyTo.Int64}
+	}
+	if row.LastReplyAt.Valid {
+		details.LastReplyAt = &row.LastReplyAt.Time
+	}
+	if row.EditedAt.Valid {
+		details.EditedAt = &row.EditedAt.Time
+	}
+	if row.DeletedAt.Valid {
+		details.Deleted = true
+		details.Content = DeletedMessageContent
+	}
+	return details
 }
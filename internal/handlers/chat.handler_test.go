@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"tarun-kavipurapu/test-go-chat/db/dbtest"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/types"
+	"tarun-kavipurapu/test-go-chat/utils"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// historyConn is a member of conversation 3 holding messages 1 to 5, a second apart.
+func historyConn() *dbtest.Conn {
+	start := time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)
+	messages := make([]db.Message, 5)
+	for i := range messages {
+		messages[i] = db.Message{
+			ID:             int64(i + 1),
+			ConversationID: 3,
+			Content:        "hello",
+			CreatedAt:      pgtype.Timestamptz{Time: start.Add(time.Duration(i) * time.Second), Valid: true},
+		}
+	}
+	// newest first, like the queries paging backwards
+	newestFirst := func(keep func(db.Message) bool, limit int32) [][]interface{} {
+		var page []db.Message
+		for i := len(messages) - 1; i >= 0 && len(page) < int(limit); i-- {
+			if keep(messages[i]) {
+				page = append(page, messages[i])
+			}
+		}
+		return dbtest.Rows(page...)
+	}
+
+	conn := dbtest.NewConn()
+	conn.OnQuery("GetConversationMember", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.ConversationMember{ConversationID: 3, UserID: args[1].(int64)}), nil
+	})
+	conn.OnQuery("ListLatestConversationMessages", func(args []interface{}) ([][]interface{}, error) {
+		return newestFirst(func(db.Message) bool { return true }, args[1].(int32)), nil
+	})
+	conn.OnQuery("ListConversationMessagesBefore", func(args []interface{}) ([][]interface{}, error) {
+		cursorAt, cursorId := args[2].(time.Time), args[3].(int64)
+		return newestFirst(func(m db.Message) bool {
+			return m.CreatedAt.Time.Before(cursorAt) || (m.CreatedAt.Time.Equal(cursorAt) && m.ID < cursorId)
+		}, args[1].(int32)), nil
+	})
+	return conn
+}
+
+func fetchMessagePage(t *testing.T, chat *ChatHandler, query string) types.MessagePage {
+	t.Helper()
+	recorder := serve(chat.GetConversationMessages, 1, http.MethodGet, "/conversations/3/messages?"+query, "", "id", "3")
+	expectStatus(t, recorder, http.StatusOK)
+	var response struct {
+		Data types.MessagePage `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response.Data
+}
+
+func pageIds(page types.MessagePage) []int64 {
+	ids := make([]int64, len(page.Messages))
+	for i, message := range page.Messages {
+		ids[i] = message.Id
+	}
+	return ids
+}
+
+func TestConversationMessagesCursorPaging(t *testing.T) {
+	chat := NewChatHandler(dbtest.NewStore(historyConn()))
+
+	first := fetchMessagePage(t, chat, "limit=2")
+	if ids := pageIds(first); !slices.Equal(ids, []int64{5, 4}) || !first.HasMore {
+		t.Fatalf("first page %v (has more %t), want [5 4] with more", ids, first.HasMore)
+	}
+	second := fetchMessagePage(t, chat, "limit=2&before="+first.Before)
+	if ids := pageIds(second); !slices.Equal(ids, []int64{3, 2}) || !second.HasMore {
+		t.Fatalf("second page %v (has more %t), want [3 2] with more", ids, second.HasMore)
+	}
+	last := fetchMessagePage(t, chat, "limit=2&before="+second.Before)
+	if ids := pageIds(last); !slices.Equal(ids, []int64{1}) || last.HasMore {
+		t.Fatalf("last page %v (has more %t), want [1] without more", ids, last.HasMore)
+	}
+}
+
+func TestConversationMessagesRejectsBadCursors(t *testing.T) {
+	chat := NewChatHandler(dbtest.NewStore(historyConn()))
+	cursor := utils.EncodeCursor(time.Now(), 1)
+
+	for _, query := range []string{"before=garbage", "after=%25%25", "before=" + cursor + "&after=" + cursor} {
+		recorder := serve(chat.GetConversationMessages, 1, http.MethodGet, "/conversations/3/messages?"+query, "", "id", "3")
+		expectStatus(t, recorder, http.StatusBadRequest)
+	}
+}
+
+func TestConversationMessagesRequiresMembership(t *testing.T) {
+	chat := NewChatHandler(dbtest.NewStore(dbtest.NewConn()))
+
+	recorder := serve(chat.GetConversationMessages, 1, http.MethodGet, "/conversations/3/messages", "", "id", "3")
+	expectStatus(t, recorder, http.StatusForbidden)
+}
+
+func TestInsertMessageIsIdempotentPerClientId(t *testing.T) {
+	stored := db.Message{ID: 9, FromUserID: 1, ConversationID: 3, Seq: 4, Content: "hi", ClientID: pgtype.Text{String: "abc", Valid: true}}
+	conn := dbtest.NewConn()
+	conn.OnQuery("NextConversationSeq", func(args []interface{}) ([][]interface{}, error) {
+		return [][]interface{}{{int64(5)}}, nil
+	})
+	// the insert conflicts on (from_user_id, client_id) and returns nothing
+	conn.OnQuery("GetMessageByClientId", func(args []interface{}) ([][]interface{}, error) {
+		if args[0].(int64) != 1 || args[1].(pgtype.Text).String != "abc" {
+			t.Fatalf("looked up client id %v of %v", args[1], args[0])
+		}
+		return dbtest.Rows(stored), nil
+	})
+	chat := NewChatHandler(dbtest.NewStore(conn))
+
+	message, duplicate, err := chat.InsertMessage(context.Background(), NewMessage{From: 1, ConversationId: 3, Content: "hi", ClientId: "abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !duplicate || message.ID != 9 {
+		t.Fatalf("got message %d (duplicate %t), want the earlier message 9", message.ID, duplicate)
+	}
+	if len(conn.Calls("InsertMessageRecipients")) != 0 {
+		t.Fatal("a retry must not record the message again")
+	}
+}
+
+func TestConversationMessagesCountReactions(t *testing.T) {
+	conn := historyConn()
+	conn.OnQuery("ListReactionCounts", func(args []interface{}) ([][]interface{}, error) {
+		if args[0].(int64) != 1 {
+			t.Fatalf("reactions counted for user %v, want the caller", args[0])
+		}
+		return dbtest.Rows(
+			db.ListReactionCountsRow{MessageID: 5, Emoji: "👍", Count: 2, Reacted: true},
+			db.ListReactionCountsRow{MessageID: 5, Emoji: "🎉", Count: 1},
+		), nil
+	})
+	chat := NewChatHandler(dbtest.NewStore(conn))
+
+	page := fetchMessagePage(t, chat, "limit=2")
+	want := []types.ReactionDetails{{Emoji: "👍", Count: 2, Reacted: true}, {Emoji: "🎉", Count: 1}}
+	if !slices.Equal(page.Messages[0].Reactions, want) || len(page.Messages[1].Reactions) != 0 {
+		t.Fatalf("reactions %+v and %+v, want %+v on message 5 only", page.Messages[0].Reactions, page.Messages[1].Reactions, want)
+	}
+}
+
+// threadConn is a member of conversation 3 where message 1 has replies 2 to 4, a second apart,
+// and message 9 belongs to conversation 4.
+func threadConn() *dbtest.Conn {
+	start := time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)
+	messages := make(map[int64]db.Message)
+	for id := int64(1); id <= 4; id++ {
+		messages[id] = db.Message{ID: id, ConversationID: 3, Content: "hello", CreatedAt: pgtype.Timestamptz{Time: start.Add(time.Duration(id) * time.Second), Valid: true}}
+		if id > 1 {
+			messages[id] = db.Message{ID: id, ConversationID: 3, Content: "reply", ReplyTo: pgtype.Int8{Int64: 1, Valid: true}, CreatedAt: messages[id].CreatedAt}
+		}
+	}
+	messages[9] = db.Message{ID: 9, ConversationID: 4, Content: "elsewhere"}
+	oldestFirst := func(after int64, limit int32) [][]interface{} {
+		var page []db.Message
+		for id := after + 1; id <= 4 && len(page) < int(limit); id++ {
+			page = append(page, messages[id])
+		}
+		return dbtest.Rows(page...)
+	}
+
+	conn := dbtest.NewConn()
+	conn.OnQuery("GetMessageById", func(args []interface{}) ([][]interface{}, error) {
+		message, ok := messages[args[0].(int64)]
+		if !ok {
+			return nil, nil
+		}
+		return dbtest.Rows(message), nil
+	})
+	conn.OnQuery("GetConversationMember", func(args []interface{}) ([][]interface{}, error) {
+		if args[0].(int64) != 3 {
+			return nil, nil
+		}
+		return dbtest.Rows(db.ConversationMember{ConversationID: 3, UserID: args[1].(int64)}), nil
+	})
+	// the thread queries take reply_to and limit, the cursor follows
+	conn.OnQuery("ListThreadReplies", func(args []interface{}) ([][]interface{}, error) {
+		return oldestFirst(1, args[1].(int32)), nil
+	})
+	conn.OnQuery("ListThreadRepliesAfter", func(args []interface{}) ([][]interface{}, error) {
+		return oldestFirst(args[3].(int64), args[1].(int32)), nil
+	})
+	conn.OnQuery("ListMessagesByIds", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(messages[1]), nil
+	})
+	return conn
+}
+
+func fetchThreadPage(t *testing.T, chat *ChatHandler, query string) types.ThreadPage {
+	t.Helper()
+	recorder := serve(chat.GetThread, 1, http.MethodGet, "/messages/1/thread?"+query, "", "id", "1")
+	expectStatus(t, recorder, http.StatusOK)
+	var response struct {
+		Data types.ThreadPage `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response.Data
+}
+
+func TestThreadPagesRepliesOldestFirst(t *testing.T) {
+	chat := NewChatHandler(dbtest.NewStore(threadConn()))
+
+	first := fetchThreadPage(t, chat, "limit=2")
+	if first.Parent.Id != 1 || len(first.Replies) != 2 || first.Replies[0].Id != 2 || first.Replies[1].Id != 3 || !first.HasMore {
+		t.Fatalf("first page %+v, want message 1 with replies 2 and 3 and more", first)
+	}
+	if quote := first.Replies[0].ReplyTo; quote == nil || quote.Id != 1 || quote.Content != "hello" {
+		t.Fatalf("reply quotes %+v, want message 1", quote)
+	}
+	last := fetchThreadPage(t, chat, "limit=2&after="+first.After)
+	if len(last.Replies) != 1 || last.Replies[0].Id != 4 || last.HasMore {
+		t.Fatalf("last page %+v, want reply 4 without more", last)
+	}
+}
+
+func TestThreadRefusals(t *testing.T) {
+	chat := NewChatHandler(dbtest.NewStore(threadConn()))
+
+	expectStatus(t, serve(chat.GetThread, 1, http.MethodGet, "/messages/7/thread", "", "id", "7"), http.StatusNotFound)
+	expectStatus(t, serve(chat.GetThread, 1, http.MethodGet, "/messages/9/thread", "", "id", "9"), http.StatusForbidden)
+	expectStatus(t, serve(chat.GetThread, 1, http.MethodGet, "/messages/1/thread?after=garbage", "", "id", "1"), http.StatusBadRequest)
+}
+
+func TestInsertReplyQuotesTheSameConversation(t *testing.T) {
+	conn := threadConn()
+	conn.OnQuery("NextConversationSeq", func(args []interface{}) ([][]interface{}, error) {
+		return [][]interface{}{{int64(5)}}, nil
+	})
+	conn.OnQuery("InsertMessage", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.Message{ID: 5, ConversationID: 3, ReplyTo: args[7].(pgtype.Int8), CreatedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true}}), nil
+	})
+	chat := NewChatHandler(dbtest.NewStore(conn))
+	ctx := context.Background()
+
+	for _, replyTo := range []int64{7, 9} {
+		_, _, err := chat.InsertMessage(ctx, NewMessage{From: 1, ConversationId: 3, Content: "hi", ReplyTo: replyTo})
+		if !errors.Is(err, ErrInvalidReply) {
+			t.Fatalf("reply to %d: err = %v, want ErrInvalidReply", replyTo, err)
+		}
+	}
+	if len(conn.Calls("InsertMessage")) != 0 {
+		t.Fatal("an invalid reply was stored")
+	}
+
+	message, _, err := chat.InsertMessage(ctx, NewMessage{From: 1, ConversationId: 3, Content: "hi", ReplyTo: 1})
+	if err != nil || message.ReplyTo.Int64 != 1 {
+		t.Fatalf("stored %+v (%v), want a reply to 1", message, err)
+	}
+	if calls := conn.Calls("RecordMessageReply"); len(calls) != 1 || calls[0][0].(int64) != 1 {
+		t.Fatalf("reply counted with %v, want on message 1", calls)
+	}
+}
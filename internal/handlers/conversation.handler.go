@@ -0,0 +1,461 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/internal/middlewares"
+	"tarun-kavipurapu/test-go-chat/types"
+	"tarun-kavipurapu/test-go-chat/utils"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+
+	// Length of the name column of the conversation table.
+	maxGroupNameLength = 255
+
+	// Characters of the last message shown in the conversation list.
+	previewLength = 100
+)
+
+type ConversationHandler struct {
+	store db.Store
+}
+
+func NewConversationHandler(store db.Store) *ConversationHandler {
+	return &ConversationHandler{store: store}
+}
+
+// CreateGroup creates a group conversation with the caller as its admin
+func (h *ConversationHandler) CreateGroup(ctx *gin.Context) {
+	var req types.CreateGroupRequest
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Parsing request Error"})
+		return
+	}
+	name, ok := groupName(ctx, req.Name)
+	if !ok {
+		return
+	}
+	userId := middlewares.GetAuthUserId(ctx)
+
+	for _, memberId := range req.MemberIds {
+		if _, err := h.store.GetUserById(ctx, memberId); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Member Not Found in the Database"})
+			return
+		}
+	}
+
+	var conversation db.Conversation
+	err = h.store.ExecTx(ctx, func(q *db.Queries) error {
+		var err error
+		conversation, err = q.CreateConversation(ctx, db.CreateConversationParams{
+			Name:      pgtype.Text{String: name, Valid: true},
+			IsGroup:   true,
+			CreatedBy: pgtype.Int8{Int64: userId, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		err = q.AddConversationMember(ctx, db.AddConversationMemberParams{
+			ConversationID: conversation.ID,
+			UserID:         userId,
+			Role:           RoleAdmin,
+		})
+		if err != nil {
+			return err
+		}
+		for _, memberId := range req.MemberIds {
+			err = q.AddConversationMember(ctx, db.AddConversationMemberParams{
+				ConversationID: conversation.ID,
+				UserID:         memberId,
+				Role:           RoleMember,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Create Group in Database"})
+		return
+	}
+
+	h.respondWithConversation(ctx, conversation, "Group Created")
+}
+
+// ListConversations returns the caller's direct conversations and groups, most recently active first,
+// with a preview of their last message and how many messages the caller has not read
+func (h *ConversationHandler) ListConversations(ctx *gin.Context) {
+	var query types.InboxQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Parsing request Error"})
+		return
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	userId := middlewares.GetAuthUserId(ctx)
+
+	rows, err := h.listInbox(ctx, userId, query.Before, limit+1)
+	if errors.Is(err, utils.ErrInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Fetch Conversations from Database"})
+		return
+	}
+
+	// one extra row is fetched to know whether another page exists
+	page := types.InboxPage{HasMore: len(rows) > int(limit)}
+	if page.HasMore {
+		rows = rows[:limit]
+	}
+	page.Conversations = make([]types.InboxEntry, 0, len(rows))
+	for _, row := range rows {
+		page.Conversations = append(page.Conversations, newInboxEntry(row))
+	}
+	if err := h.attachConversationMetadata(ctx, userId, page.Conversations); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Fetch Members from Database"})
+		return
+	}
+	if len(rows) > 0 {
+		oldest := rows[len(rows)-1]
+		page.Before = utils.EncodeCursor(oldest.LastActivityAt.Time, oldest.ID)
+	}
+
+	ctx.JSON(http.StatusOK, types.GenerateResponse(page, "Conversations Fetched"))
+}
+
+func (h *ConversationHandler) listInbox(ctx context.Context, userId int64, before string, limit int32) ([]db.ListInboxRow, error) {
+	if before == "" {
+		return h.store.ListInbox(ctx, db.ListInboxParams{UserID: userId, Limit: limit})
+	}
+	activityAt, id, err := utils.DecodeCursor(before)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := h.store.ListInboxBefore(ctx, db.ListInboxBeforeParams{
+		UserID:           userId,
+		Limit:            limit,
+		CursorActivityAt: activityAt,
+		CursorID:         id,
+	})
+	if err != nil {
+		return nil, err
+	}
+	inbox := make([]db.ListInboxRow, len(rows))
+	for i, row := range rows {
+		inbox[i] = db.ListInboxRow(row)
+	}
+	return inbox, nil
+}
+
+// attachConversationMetadata adds the member count of every conversation and the peer of the direct ones
+func (h *ConversationHandler) attachConversationMetadata(ctx context.Context, userId int64, entries []types.InboxEntry) error {
+	conversationIds := make([]int64, 0, len(entries))
+	var directIds []int64
+	for _, entry := range entries {
+		conversationIds = append(conversationIds, entry.ConversationId)
+		if !entry.IsGroup {
+			directIds = append(directIds, entry.ConversationId)
+		}
+	}
+
+	counts, err := h.store.CountConversationMembers(ctx, conversationIds)
+	if err != nil {
+		return err
+	}
+	memberCounts := make(map[int64]int64, len(counts))
+	for _, count := range counts {
+		memberCounts[count.ConversationID] = count.MemberCount
+	}
+
+	peers := make(map[int64]*types.PeerDetails)
+	if len(directIds) > 0 {
+		rows, err := h.store.ListConversationPeers(ctx, db.ListConversationPeersParams{
+			ConversationIds: directIds,
+			UserID:          userId,
+		})
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			peer := &types.PeerDetails{
+				UserId:      row.ID,
+				Username:    row.Username,
+				DisplayName: row.DisplayName,
+				PhotoLink:   row.UsersPhotoLink.String,
+			}
+			if row.LastSeenAt.Valid {
+				peer.LastSeenAt = &row.LastSeenAt.Time
+			}
+			peers[row.ConversationID] = peer
+		}
+	}
+
+	for i := range entries {
+		entries[i].MemberCount = memberCounts[entries[i].ConversationId]
+		entries[i].Peer = peers[entries[i].ConversationId]
+	}
+	return nil
+}
+
+// newInboxEntry converts an inbox row into its API representation
+func newInboxEntry(row db.ListInboxRow) types.InboxEntry {
+	entry := types.InboxEntry{
+		ConversationId: row.ID,
+		Name:           row.Name.String,
+		IsGroup:        row.IsGroup,
+		LastSeq:        row.LastSeq,
+		UnreadCount:    row.UnreadCount,
+		LastActivityAt: row.LastActivityAt.Time,
+	}
+	if row.LastMessageID.Valid {
+		entry.LastMessage = &types.LastMessageDetails{
+			Id:        row.LastMessageID.Int64,
+			From:      row.LastMessageFrom.Int64,
+			Content:   preview(row.LastMessageContent.String),
+			CreatedAt: row.LastMessageAt.Time,
+		}
+		if row.LastMessageDeletedAt.Valid {
+			entry.LastMessage.Content = DeletedMessageContent
+			entry.LastMessage.Deleted = true
+		}
+	}
+	return entry
+}
+
+// preview shortens a message to previewLength characters
+func preview(content string) string {
+	runes := []rune(content)
+	if len(runes) <= previewLength {
+		return content
+	}
+	return string(runes[:previewLength]) + "…"
+}
+
+// RenameGroup changes the name of a group the caller is a member of
+func (h *ConversationHandler) RenameGroup(ctx *gin.Context) {
+	conversationId, ok := parseIdParam(ctx, "id")
+	if !ok {
+		return
+	}
+	var req types.RenameGroupRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Parsing request Error"})
+		return
+	}
+	name, ok := groupName(ctx, req.Name)
+	if !ok {
+		return
+	}
+
+	if _, ok := h.requireGroupMember(ctx, conversationId, false); !ok {
+		return
+	}
+
+	conversation, err := h.store.RenameConversation(ctx, db.RenameConversationParams{
+		ID:   conversationId,
+		Name: pgtype.Text{String: name, Valid: true},
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Rename Group in Database"})
+		return
+	}
+
+	h.respondWithConversation(ctx, conversation, "Group Renamed")
+}
+
+// AddMembers adds users to a group, only admins are allowed to do so
+func (h *ConversationHandler) AddMembers(ctx *gin.Context) {
+	conversationId, ok := parseIdParam(ctx, "id")
+	if !ok {
+		return
+	}
+	var req types.AddMembersRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Parsing request Error"})
+		return
+	}
+
+	conversation, ok := h.requireGroupMember(ctx, conversationId, true)
+	if !ok {
+		return
+	}
+
+	for _, memberId := range req.UserIds {
+		if _, err := h.store.GetUserById(ctx, memberId); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Member Not Found in the Database"})
+			return
+		}
+	}
+	// either every user is added or none is
+	err := h.store.ExecTx(ctx, func(q *db.Queries) error {
+		for _, memberId := range req.UserIds {
+			err := q.AddConversationMember(ctx, db.AddConversationMemberParams{
+				ConversationID: conversationId,
+				UserID:         memberId,
+				Role:           RoleMember,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Add Member in Database"})
+		return
+	}
+
+	h.respondWithConversation(ctx, conversation, "Members Added")
+}
+
+// RemoveMember removes a user from a group, admins can remove anyone and members only themselves
+func (h *ConversationHandler) RemoveMember(ctx *gin.Context) {
+	conversationId, ok := parseIdParam(ctx, "id")
+	if !ok {
+		return
+	}
+	memberId, ok := parseIdParam(ctx, "userId")
+	if !ok {
+		return
+	}
+
+	mustBeAdmin := memberId != middlewares.GetAuthUserId(ctx)
+	conversation, ok := h.requireGroupMember(ctx, conversationId, mustBeAdmin)
+	if !ok {
+		return
+	}
+
+	if !h.removeMember(ctx, conversationId, memberId) {
+		return
+	}
+
+	h.respondWithConversation(ctx, conversation, "Member Removed")
+}
+
+// LeaveGroup removes the caller from a group
+func (h *ConversationHandler) LeaveGroup(ctx *gin.Context) {
+	conversationId, ok := parseIdParam(ctx, "id")
+	if !ok {
+		return
+	}
+
+	if _, ok := h.requireGroupMember(ctx, conversationId, false); !ok {
+		return
+	}
+
+	if !h.removeMember(ctx, conversationId, middlewares.GetAuthUserId(ctx)) {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, types.GenerateResponse(nil, "Left Group"))
+}
+
+func (h *ConversationHandler) removeMember(ctx *gin.Context, conversationId int64, memberId int64) bool {
+	err := h.store.ExecTx(ctx, func(q *db.Queries) error {
+		removed, err := q.RemoveConversationMember(ctx, db.RemoveConversationMemberParams{
+			ConversationID: conversationId,
+			UserID:         memberId,
+		})
+		if err != nil {
+			return err
+		}
+		if removed == 0 {
+			return pgx.ErrNoRows
+		}
+		// a group should never be left without an admin
+		return q.PromoteOldestMember(ctx, conversationId)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Member Not Found in the Group"})
+		return false
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Remove Member in Database"})
+		return false
+	}
+	return true
+}
+
+// groupName trims the name of a group and writes the error response when it does not fit the name column
+func groupName(ctx *gin.Context, name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxGroupNameLength {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Group names are 1 to 255 characters"})
+		return "", false
+	}
+	return name, true
+}
+
+// requireGroupMember loads the group and checks that the caller belongs to it
+func (h *ConversationHandler) requireGroupMember(ctx *gin.Context, conversationId int64, mustBeAdmin bool) (db.Conversation, bool) {
+	conversation, err := h.store.GetConversationById(ctx, conversationId)
+	if err != nil || !conversation.IsGroup {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Group Not Found"})
+		return db.Conversation{}, false
+	}
+
+	member, err := h.store.GetConversationMember(ctx, db.GetConversationMemberParams{
+		ConversationID: conversationId,
+		UserID:         middlewares.GetAuthUserId(ctx),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "You are not a Member of this Group"})
+		return db.Conversation{}, false
+	}
+	if mustBeAdmin && member.Role != RoleAdmin {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Only Group Admins can do this"})
+		return db.Conversation{}, false
+	}
+
+	return conversation, true
+}
+
+func (h *ConversationHandler) respondWithConversation(ctx *gin.Context, conversation db.Conversation, message string) {
+	details, err := h.conversationDetails(ctx, conversation)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Fetch Members from Database"})
+		return
+	}
+	ctx.JSON(http.StatusOK, types.GenerateResponse(details, message))
+}
+
+func (h *ConversationHandler) conversationDetails(ctx context.Context, conversation db.Conversation) (types.ConversationDetails, error) {
+	members, err := h.store.ListConversationMembers(ctx, conversation.ID)
+	if err != nil {
+		return types.ConversationDetails{}, err
+	}
+
+	details := types.ConversationDetails{
+		Id:      conversation.ID,
+		Name:    conversation.Name.String,
+		IsGroup: conversation.IsGroup,
+		Members: make([]types.ConversationMemberDetails, 0, len(members)),
+	}
+	for _, member := range members {
+		details.Members = append(details.Members, types.ConversationMemberDetails{
+			UserId: member.UserID,
+			Role:   member.Role,
+		})
+	}
+	return details, nil
+}
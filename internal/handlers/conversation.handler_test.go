@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"tarun-kavipurapu/test-go-chat/db/dbtest"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/types"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func directConversation(id int64, key string) [][]interface{} {
+	return dbtest.Rows(db.Conversation{ID: id, DirectKey: pgtype.Text{String: key, Valid: true}})
+}
+
+func TestResolveConversationReusesDirectConversation(t *testing.T) {
+	conn := dbtest.NewConn()
+	conn.OnQuery("GetDirectConversation", func(args []interface{}) ([][]interface{}, error) {
+		return directConversation(7, "1:2"), nil
+	})
+	chat := NewChatHandler(dbtest.NewStore(conn))
+
+	conversation, err := chat.ResolveConversation(context.Background(), 2, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conversation.ID != 7 {
+		t.Fatalf("conversation = %d, want 7", conversation.ID)
+	}
+	if key := conn.Calls("GetDirectConversation")[0][0].(pgtype.Text).String; key != "1:2" {
+		t.Fatalf("direct key = %q, want 1:2", key)
+	}
+	// an existing conversation costs a single read and writes nothing
+	if n := len(conn.Calls("CreateDirectConversation")) + len(conn.Calls("AddConversationMember")); n != 0 {
+		t.Fatalf("%d writes for an existing conversation", n)
+	}
+}
+
+func TestResolveConversationCreatesDirectConversation(t *testing.T) {
+	conn := dbtest.NewConn()
+	conn.OnQuery("CreateDirectConversation", func(args []interface{}) ([][]interface{}, error) {
+		return directConversation(7, "1:2"), nil
+	})
+	chat := NewChatHandler(dbtest.NewStore(conn))
+
+	conversation, err := chat.ResolveConversation(context.Background(), 1, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conversation.ID != 7 {
+		t.Fatalf("conversation = %d, want 7", conversation.ID)
+	}
+	members := conn.Calls("AddConversationMember")
+	if len(members) != 2 {
+		t.Fatalf("%d members added, want 2", len(members))
+	}
+}
+
+func TestResolveConversationCreatedConcurrently(t *testing.T) {
+	conn := dbtest.NewConn()
+	lookups := 0
+	conn.OnQuery("GetDirectConversation", func(args []interface{}) ([][]interface{}, error) {
+		// the other transaction commits between the first lookup and the insert
+		lookups++
+		if lookups == 1 {
+			return nil, nil
+		}
+		return directConversation(7, "1:2"), nil
+	})
+	chat := NewChatHandler(dbtest.NewStore(conn))
+
+	conversation, err := chat.ResolveConversation(context.Background(), 1, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conversation.ID != 7 {
+		t.Fatalf("conversation = %d, want 7", conversation.ID)
+	}
+	if len(conn.Calls("CreateDirectConversation")) != 1 || len(conn.Calls("AddConversationMember")) != 0 {
+		t.Fatal("the members of a conversation created concurrently were added again")
+	}
+}
+
+func TestResolveConversationRequiresMembership(t *testing.T) {
+	conn := dbtest.NewConn()
+	conn.OnQuery("GetConversationById", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.Conversation{ID: 3, IsGroup: true}), nil
+	})
+	chat := NewChatHandler(dbtest.NewStore(conn))
+
+	_, err := chat.ResolveConversation(context.Background(), 1, 0, 3)
+	if !errors.Is(err, ErrNotConversationMember) {
+		t.Fatalf("err = %v, want ErrNotConversationMember", err)
+	}
+}
+
+func TestResolveConversationRejectsSelf(t *testing.T) {
+	conn := dbtest.NewConn()
+	chat := NewChatHandler(dbtest.NewStore(conn))
+
+	_, err := chat.ResolveConversation(context.Background(), 1, 1, 0)
+	if !errors.Is(err, ErrSelfConversation) {
+		t.Fatalf("err = %v, want ErrSelfConversation", err)
+	}
+	if conn.Count() != 0 {
+		t.Fatal("a direct conversation with yourself reached the database")
+	}
+}
+
+func TestCreateGroupValidatesName(t *testing.T) {
+	for _, name := range []string{"", "   ", strings.Repeat("é", maxGroupNameLength+1)} {
+		conn := dbtest.NewConn()
+		handler := NewConversationHandler(dbtest.NewStore(conn))
+
+		recorder := serve(handler.CreateGroup, 1, http.MethodPost, "/conversations", `{"name":"`+name+`"}`)
+		expectStatus(t, recorder, http.StatusBadRequest)
+		if len(conn.Calls("CreateConversation")) != 0 {
+			t.Fatalf("group created with a name of %d characters", len([]rune(name)))
+		}
+	}
+}
+
+func TestRenameGroupTrimsName(t *testing.T) {
+	conn := dbtest.NewConn()
+	conn.OnQuery("GetConversationById", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.Conversation{ID: 3, IsGroup: true}), nil
+	})
+	conn.OnQuery("GetConversationMember", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.ConversationMember{ConversationID: 3, UserID: 1, Role: RoleMember}), nil
+	})
+	conn.OnQuery("RenameConversation", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.Conversation{ID: 3, IsGroup: true, Name: args[1].(pgtype.Text)}), nil
+	})
+	handler := NewConversationHandler(dbtest.NewStore(conn))
+
+	recorder := serve(handler.RenameGroup, 1, http.MethodPatch, "/conversations/3", `{"name":"  Hiking  "}`, "id", "3")
+	expectStatus(t, recorder, http.StatusOK)
+	if name := conn.Calls("RenameConversation")[0][1].(pgtype.Text).String; name != "Hiking" {
+		t.Fatalf("name = %q, want Hiking", name)
+	}
+}
+
+func TestAddMembersRejectsUnknownUsersBeforeWriting(t *testing.T) {
+	conn := dbtest.NewConn()
+	conn.OnQuery("GetConversationById", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.Conversation{ID: 3, IsGroup: true}), nil
+	})
+	conn.OnQuery("GetConversationMember", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.ConversationMember{ConversationID: 3, UserID: 1, Role: RoleAdmin}), nil
+	})
+	conn.OnQuery("GetUserById", func(args []interface{}) ([][]interface{}, error) {
+		if args[0].(int64) == 5 {
+			return nil, nil
+		}
+		return dbtest.Rows(db.User{ID: args[0].(int64)}), nil
+	})
+	handler := NewConversationHandler(dbtest.NewStore(conn))
+
+	recorder := serve(handler.AddMembers, 1, http.MethodPost, "/conversations/3/members", `{"user_ids":[4,5]}`, "id", "3")
+	expectStatus(t, recorder, http.StatusBadRequest)
+	if n := len(conn.Calls("AddConversationMember")); n != 0 {
+		t.Fatalf("%d members added although one user does not exist", n)
+	}
+}
+
+func TestAddMembersCapsUserIds(t *testing.T) {
+	conn := dbtest.NewConn()
+	handler := NewConversationHandler(dbtest.NewStore(conn))
+
+	userIds := strings.TrimSuffix(strings.Repeat("4,", 101), ",")
+	recorder := serve(handler.AddMembers, 1, http.MethodPost, "/conversations/3/members", `{"user_ids":[`+userIds+`]}`, "id", "3")
+	expectStatus(t, recorder, http.StatusBadRequest)
+	if conn.Count() != 0 {
+		t.Fatal("an oversized member list reached the database")
+	}
+}
+
+// inboxConn is a database where user 1 has group 7, with a long last message, direct conversation 8 with
+// user 2 and group 9, whose last message was deleted, most recently active first, a minute apart.
+func inboxConn() *dbtest.Conn {
+	start := time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) pgtype.Timestamptz {
+		return pgtype.Timestamptz{Time: start.Add(-time.Duration(minutes) * time.Minute), Valid: true}
+	}
+	inbox := []db.ListInboxRow{
+		{ID: 7, Name: pgtype.Text{String: "team", Valid: true}, IsGroup: true, LastSeq: 40, UnreadCount: 3, LastActivityAt: at(0),
+			LastMessageID: pgtype.Int8{Int64: 70, Valid: true}, LastMessageFrom: pgtype.Int8{Int64: 3, Valid: true},
+			LastMessageContent: pgtype.Text{String: strings.Repeat("é", previewLength+1), Valid: true}, LastMessageAt: at(0)},
+		{ID: 8, LastSeq: 2, LastActivityAt: at(1),
+			LastMessageID: pgtype.Int8{Int64: 80, Valid: true}, LastMessageFrom: pgtype.Int8{Int64: 2, Valid: true},
+			LastMessageContent: pgtype.Text{String: "hi", Valid: true}, LastMessageAt: at(1)},
+		{ID: 9, Name: pgtype.Text{String: "old", Valid: true}, IsGroup: true, LastSeq: 5, LastActivityAt: at(2),
+			LastMessageID: pgtype.Int8{Int64: 90, Valid: true}, LastMessageContent: pgtype.Text{String: "secret", Valid: true},
+			LastMessageAt: at(2), LastMessageDeletedAt: at(1)},
+	}
+
+	conn := dbtest.NewConn()
+	conn.OnQuery("ListInbox", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(inbox[:min(int(args[1].(int32)), len(inbox))]...), nil
+	})
+	conn.OnQuery("ListInboxBefore", func(args []interface{}) ([][]interface{}, error) {
+		cursorAt, cursorId := args[2].(time.Time), args[3].(int64)
+		var page []db.ListInboxBeforeRow
+		for _, row := range inbox {
+			at := row.LastActivityAt.Time
+			if (at.Before(cursorAt) || (at.Equal(cursorAt) && row.ID < cursorId)) && len(page) < int(args[1].(int32)) {
+				page = append(page, db.ListInboxBeforeRow(row))
+			}
+		}
+		return dbtest.Rows(page...), nil
+	})
+	conn.OnQuery("CountConversationMembers", func(args []interface{}) ([][]interface{}, error) {
+		var counts []db.CountConversationMembersRow
+		for _, id := range args[0].([]int64) {
+			counts = append(counts, db.CountConversationMembersRow{ConversationID: id, MemberCount: id - 5})
+		}
+		return dbtest.Rows(counts...), nil
+	})
+	conn.OnQuery("ListConversationPeers", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.ListConversationPeersRow{ConversationID: 8, ID: 2, Username: "bob"}), nil
+	})
+	return conn
+}
+
+func fetchInboxPage(t *testing.T, conversations *ConversationHandler, query string) types.InboxPage {
+	t.Helper()
+	recorder := serve(conversations.ListConversations, 1, http.MethodGet, "/conversations?"+query, "")
+	expectStatus(t, recorder, http.StatusOK)
+	var response struct {
+		Data types.InboxPage `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response.Data
+}
+
+func TestListConversationsPagesByActivity(t *testing.T) {
+	conn := inboxConn()
+	conversations := NewConversationHandler(dbtest.NewStore(conn))
+
+	first := fetchInboxPage(t, conversations, "limit=2")
+	if len(first.Conversations) != 2 || !first.HasMore {
+		t.Fatalf("first page holds %d conversations (has more %t), want 2 with more", len(first.Conversations), first.HasMore)
+	}
+	group, direct := first.Conversations[0], first.Conversations[1]
+	if group.ConversationId != 7 || group.Name != "team" || group.MemberCount != 2 || group.UnreadCount != 3 || group.Peer != nil {
+		t.Fatalf("group entry %+v", group)
+	}
+	if content := group.LastMessage.Content; content != strings.Repeat("é", previewLength)+"…" {
+		t.Fatalf("preview of a long message is %q", content)
+	}
+	if direct.ConversationId != 8 || direct.Peer == nil || direct.Peer.UserId != 2 || direct.LastMessage.Content != "hi" {
+		t.Fatalf("direct entry %+v with peer %+v", direct, direct.Peer)
+	}
+	if calls := conn.Calls("ListConversationPeers"); len(calls) != 1 || len(calls[0][0].([]int64)) != 1 {
+		t.Fatalf("peers looked up with %v, want only conversation 8", calls)
+	}
+
+	last := fetchInboxPage(t, conversations, "limit=2&before="+first.Before)
+	if len(last.Conversations) != 1 || last.HasMore {
+		t.Fatalf("last page holds %d conversations (has more %t), want 1 without more", len(last.Conversations), last.HasMore)
+	}
+	if deleted := last.Conversations[0]; deleted.ConversationId != 9 || !deleted.LastMessage.Deleted || deleted.LastMessage.Content != DeletedMessageContent {
+		t.Fatalf("deleted last message shown as %+v", deleted.LastMessage)
+	}
+}
+
+func TestListConversationsRejectsBadCursors(t *testing.T) {
+	conversations := NewConversationHandler(dbtest.NewStore(inboxConn()))
+
+	recorder := serve(conversations.ListConversations, 1, http.MethodGet, "/conversations?before=garbage", "")
+	expectStatus(t, recorder, http.StatusBadRequest)
+}
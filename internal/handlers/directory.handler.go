@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/internal/middlewares"
+	"tarun-kavipurapu/test-go-chat/types"
+	"tarun-kavipurapu/test-go-chat/utils"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Length bounds of a search, in characters.
+	minSearchLength = 2
+	maxSearchLength = 64
+
+	// Results past this position are not served, the search should be narrowed instead.
+	maxSearchOffset = 500
+)
+
+// likeEscaper escapes the wildcards of LIKE in the search, backslash is the default escape character
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// DirectoryHandler lets users find each other and block the users they do not want to be found by
+type DirectoryHandler struct {
+	store db.Store
+}
+
+func NewDirectoryHandler(store db.Store) *DirectoryHandler {
+	return &DirectoryHandler{store: store}
+}
+
+// SearchUsers matches the query against the start of usernames and display names, and fuzzily anywhere in them.
+// The caller and the users who blocked them are never returned.
+func (d *DirectoryHandler) SearchUsers(ctx *gin.Context) {
+	var query types.UserSearchQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Parsing request Error"})
+		return
+	}
+	search := strings.ToLower(strings.TrimSpace(query.Q))
+	if length := utf8.RuneCountInString(search); length < minSearchLength || length > maxSearchLength {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Search for 2 to 64 characters"})
+		return
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	var offset int32
+	if query.After != "" {
+		var err error
+		offset, err = utils.DecodeOffsetCursor(query.After)
+		if err != nil || offset > maxSearchOffset {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+	}
+
+	rows, err := d.store.SearchUsers(ctx, db.SearchUsersParams{
+		UserID:     middlewares.GetAuthUserId(ctx),
+		Prefix:     likeEscaper.Replace(search) + "%",
+		Query:      search,
+		PageOffset: offset,
+		PageLimit:  limit + 1,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Search Users in Database"})
+		return
+	}
+
+	// one extra row is fetched to know whether another page exists
+	page := types.UserSearchPage{HasMore: len(rows) > int(limit) && offset+limit <= maxSearchOffset}
+	if len(rows) > int(limit) {
+		rows = rows[:limit]
+	}
+	page.Users = make([]types.PublicProfile, 0, len(rows))
+	for _, row := range rows {
+		page.Users = append(page.Users, newDirectoryEntry(row))
+	}
+	if page.HasMore {
+		page.After = utils.EncodeOffsetCursor(offset + limit)
+	}
+
+	ctx.JSON(http.StatusOK, types.GenerateResponse(page, "Users Fetched"))
+}
+
+// BlockUser hides the caller from the searches of another user
+func (d *DirectoryHandler) BlockUser(ctx *gin.Context) {
+	blockedId, ok := d.otherUserParam(ctx)
+	if !ok {
+		return
+	}
+	err := d.store.BlockUser(ctx, db.BlockUserParams{
+		BlockerID: middlewares.GetAuthUserId(ctx),
+		BlockedID: blockedId,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Block User in Database"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, types.GenerateResponse(nil, "User Blocked"))
+}
+
+// UnblockUser takes back a block of the caller
+func (d *DirectoryHandler) UnblockUser(ctx *gin.Context) {
+	blockedId, ok := d.otherUserParam(ctx)
+	if !ok {
+		return
+	}
+	err := d.store.UnblockUser(ctx, db.UnblockUserParams{
+		BlockerID: middlewares.GetAuthUserId(ctx),
+		BlockedID: blockedId,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Unblock User in Database"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, types.GenerateResponse(nil, "User Unblocked"))
+}
+
+// ListBlockedUsers returns the users the caller blocked, most recent first
+func (d *DirectoryHandler) ListBlockedUsers(ctx *gin.Context) {
+	rows, err := d.store.ListBlockedUsers(ctx, middlewares.GetAuthUserId(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Fetch Blocked Users from Database"})
+		return
+	}
+	users := make([]types.PublicProfile, 0, len(rows))
+	for _, row := range rows {
+		users = append(users, newDirectoryEntry(db.SearchUsersRow(row)))
+	}
+
+	ctx.JSON(http.StatusOK, types.GenerateResponse(users, "Blocked Users Fetched"))
+}
+
+// otherUserParam reads the id of an existing user other than the caller from the path
+func (d *DirectoryHandler) otherUserParam(ctx *gin.Context) (int64, bool) {
+	userId, ok := parseIdParam(ctx, "id")
+	if !ok {
+		return 0, false
+	}
+	if userId == middlewares.GetAuthUserId(ctx) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "You cannot Block Yourself"})
+		return 0, false
+	}
+	if _, err := d.store.GetUserById(ctx, userId); err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User Not Found in the Database"})
+		return 0, false
+	}
+	return userId, true
+}
+
+// newDirectoryEntry converts a user found in the directory, rows of the directory never carry the email or password
+func newDirectoryEntry(row db.SearchUsersRow) types.PublicProfile {
+	return types.PublicProfile{
+		Id:          row.ID,
+		Username:    row.Username,
+		DisplayName: row.DisplayName,
+		StatusText:  row.StatusText,
+		Bio:         row.Bio,
+		PhotoLink:   row.UsersPhotoLink.String,
+	}
+}
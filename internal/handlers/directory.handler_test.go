@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"tarun-kavipurapu/test-go-chat/db/dbtest"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/types"
+	"tarun-kavipurapu/test-go-chat/utils"
+	"testing"
+)
+
+// directoryConn is a database of the users 1 to 30 named user01 to user30. Searches match the start
+// of usernames and leave out the caller, like the query does.
+func directoryConn() *dbtest.Conn {
+	conn := dbtest.NewConn()
+	// the SearchUsers arguments are user_id, prefix, query, page_offset and page_limit
+	conn.OnQuery("SearchUsers", func(args []interface{}) ([][]interface{}, error) {
+		prefix := strings.TrimSuffix(args[1].(string), "%")
+		var found []db.SearchUsersRow
+		for id := int64(1); id <= 30; id++ {
+			username := fmt.Sprintf("user%02d", id)
+			if id != args[0].(int64) && strings.HasPrefix(username, prefix) {
+				found = append(found, db.SearchUsersRow{ID: id, Username: username})
+			}
+		}
+		offset, limit := int(args[3].(int32)), int(args[4].(int32))
+		found = found[min(offset, len(found)):]
+		return dbtest.Rows(found[:min(limit, len(found))]...), nil
+	})
+	conn.OnQuery("GetUserById", func(args []interface{}) ([][]interface{}, error) {
+		if args[0].(int64) > 30 {
+			return nil, nil
+		}
+		return dbtest.Rows(db.User{ID: args[0].(int64)}), nil
+	})
+	conn.OnQuery("ListBlockedUsers", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.ListBlockedUsersRow{ID: 2, Username: "user02"}), nil
+	})
+	return conn
+}
+
+func searchUsers(t *testing.T, directory *DirectoryHandler, query string) types.UserSearchPage {
+	t.Helper()
+	recorder := serve(directory.SearchUsers, 1, http.MethodGet, "/users/search?"+query, "")
+	expectStatus(t, recorder, http.StatusOK)
+	var response struct {
+		Data types.UserSearchPage `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response.Data
+}
+
+func TestSearchUsersPages(t *testing.T) {
+	directory := NewDirectoryHandler(dbtest.NewStore(directoryConn()))
+
+	var ids []int64
+	page := types.UserSearchPage{HasMore: true}
+	for pages := 0; page.HasMore; pages++ {
+		if pages == 3 {
+			t.Fatal("more than 3 pages of 10 for 29 users")
+		}
+		page = searchUsers(t, directory, "q=User&limit=10&after="+page.After)
+		for _, user := range page.Users {
+			ids = append(ids, user.Id)
+		}
+	}
+	if len(ids) != 29 || ids[0] != 2 || ids[28] != 30 {
+		t.Fatalf("found %v, want users 2 to 30", ids)
+	}
+
+	if page := searchUsers(t, directory, "q=user1"); len(page.Users) != 10 || page.HasMore {
+		t.Fatalf("user1 found %d users (more %t), want 10", len(page.Users), page.HasMore)
+	}
+}
+
+func TestSearchUsersStopsPastTheLastOffset(t *testing.T) {
+	conn := dbtest.NewConn()
+	// every page is full
+	conn.OnQuery("SearchUsers", func(args []interface{}) ([][]interface{}, error) {
+		rows := make([]db.SearchUsersRow, args[4].(int32))
+		for i := range rows {
+			rows[i].ID = int64(args[3].(int32)) + int64(i) + 2
+		}
+		return dbtest.Rows(rows...), nil
+	})
+	directory := NewDirectoryHandler(dbtest.NewStore(conn))
+
+	if page := searchUsers(t, directory, "q=user&limit=10&after="+utils.EncodeOffsetCursor(maxSearchOffset-10)); !page.HasMore {
+		t.Fatalf("page ending at offset %d has no next one", maxSearchOffset)
+	}
+	// a page going past the last offset has no next one
+	page := searchUsers(t, directory, "q=user&limit=10&after="+utils.EncodeOffsetCursor(maxSearchOffset-5))
+	if len(page.Users) != 10 || page.HasMore || page.After != "" {
+		t.Fatalf("page past offset %d has more: %+v", maxSearchOffset, page)
+	}
+	recorder := serve(directory.SearchUsers, 1, http.MethodGet, "/users/search?q=user&after="+utils.EncodeOffsetCursor(maxSearchOffset+1), "")
+	expectStatus(t, recorder, http.StatusBadRequest)
+}
+
+func TestSearchUsersEscapesWildcards(t *testing.T) {
+	conn := directoryConn()
+	directory := NewDirectoryHandler(dbtest.NewStore(conn))
+
+	searchUsers(t, directory, "q=+A_b%25%5C+")
+	calls := conn.Calls("SearchUsers")
+	if len(calls) != 1 || calls[0][1] != `a\_b\%\\%` || calls[0][2] != `a_b%\` {
+		t.Fatalf("searched with %v, want the escaped prefix and the lowered query", calls)
+	}
+}
+
+func TestSearchUsersRefusals(t *testing.T) {
+	conn := directoryConn()
+	directory := NewDirectoryHandler(dbtest.NewStore(conn))
+
+	for _, query := range []string{"q=a", "q=+a+", "q=" + strings.Repeat("é", maxSearchLength+1), "q=user&after=garbage", "q=user&limit=x"} {
+		expectStatus(t, serve(directory.SearchUsers, 1, http.MethodGet, "/users/search?"+query, ""), http.StatusBadRequest)
+	}
+	if len(conn.Calls("SearchUsers")) != 0 {
+		t.Fatal("a refused search reached the database")
+	}
+}
+
+func TestBlockUser(t *testing.T) {
+	conn := directoryConn()
+	directory := NewDirectoryHandler(dbtest.NewStore(conn))
+
+	expectStatus(t, serve(directory.BlockUser, 1, http.MethodPost, "/users/1/block", "", "id", "1"), http.StatusBadRequest)
+	expectStatus(t, serve(directory.BlockUser, 1, http.MethodPost, "/users/31/block", "", "id", "31"), http.StatusNotFound)
+	if len(conn.Calls("BlockUser")) != 0 {
+		t.Fatal("a refused block was stored")
+	}
+
+	expectStatus(t, serve(directory.BlockUser, 1, http.MethodPost, "/users/2/block", "", "id", "2"), http.StatusOK)
+	expectStatus(t, serve(directory.UnblockUser, 1, http.MethodDelete, "/users/2/block", "", "id", "2"), http.StatusOK)
+	for _, name := range []string{"BlockUser", "UnblockUser"} {
+		if calls := conn.Calls(name); len(calls) != 1 || calls[0][0] != int64(1) || calls[0][1] != int64(2) {
+			t.Fatalf("%s called with %v, want 1 and 2", name, calls)
+		}
+	}
+
+	recorder := serve(directory.ListBlockedUsers, 1, http.MethodGet, "/users/blocked", "")
+	expectStatus(t, recorder, http.StatusOK)
+	if !strings.Contains(recorder.Body.String(), `"user_name":"user02"`) || strings.Contains(recorder.Body.String(), "email") {
+		t.Fatalf("blocked users listed as %s", recorder.Body.String())
+	}
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"tarun-kavipurapu/test-go-chat/internal/middlewares"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// serve runs handler on a request of the user, params are the path parameters as name and value pairs
+func serve(handler gin.HandlerFunc, userId int64, method string, target string, body string, params ...string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		ctx.Request.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(params); i += 2 {
+		ctx.Params = append(ctx.Params, gin.Param{Key: params[i], Value: params[i+1]})
+	}
+	middlewares.SetAuthUserId(ctx, userId)
+	handler(ctx)
+	return recorder
+}
+
+func expectStatus(t testing.TB, recorder *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if recorder.Code != status {
+		t.Fatalf("status = %d, want %d %s: %s", recorder.Code, status, http.StatusText(status), recorder.Body.String())
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/internal/middlewares"
+	"tarun-kavipurapu/test-go-chat/types"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// MessageNotifier pushes the changes of a stored message to the connected members of its conversation
+type MessageNotifier interface {
+	MessageEdited(message db.Message)
+	MessageDeleted(message db.Message)
+}
+
+// MessageHandler serves the REST side of editing and deleting messages, the socket offers the same events
+type MessageHandler struct {
+	store    db.Store
+	chat     *ChatHandler
+	notifier MessageNotifier
+}
+
+func NewMessageHandler(store db.Store, chat *ChatHandler, notifier MessageNotifier) *MessageHandler {
+	return &MessageHandler{store: store, chat: chat, notifier: notifier}
+}
+
+// EditMessage replaces the content of one of the caller's messages
+func (m *MessageHandler) EditMessage(ctx *gin.Context) {
+	messageId, ok := parseIdParam(ctx, "id")
+	if !ok {
+		return
+	}
+	var req types.EditMessageRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Parsing request Error"})
+		return
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "A message needs content"})
+		return
+	}
+	if utf8.RuneCountInString(req.Content) > MaxMessageLength {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Messages can be at most 4000 characters"})
+		return
+	}
+
+	message, err := m.chat.EditMessage(ctx, middlewares.GetAuthUserId(ctx), messageId, req.Content)
+	if !respondWithChangeError(ctx, err) {
+		return
+	}
+	m.notifier.MessageEdited(message)
+
+	ctx.JSON(http.StatusOK, types.GenerateResponse(NewMessageDetails(message), "Message Edited"))
+}
+
+// DeleteMessage replaces one of the caller's messages with a tombstone
+func (m *MessageHandler) DeleteMessage(ctx *gin.Context) {
+	messageId, ok := parseIdParam(ctx, "id")
+	if !ok {
+		return
+	}
+
+	message, err := m.chat.DeleteMessage(ctx, middlewares.GetAuthUserId(ctx), messageId)
+	if !respondWithChangeError(ctx, err) {
+		return
+	}
+	m.notifier.MessageDeleted(message)
+
+	ctx.JSON(http.StatusOK, types.GenerateResponse(NewMessageDetails(message), "Message Deleted"))
+}
+
+// GetMessageEdits returns the earlier versions of a message, oldest first
+func (m *MessageHandler) GetMessageEdits(ctx *gin.Context) {
+	messageId, ok := parseIdParam(ctx, "id")
+	if !ok {
+		return
+	}
+
+	message, err := m.store.GetMessageById(ctx, messageId)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Message Not Found"})
+		return
+	}
+	if !m.isMember(ctx, message.ConversationID) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "You are not a Member of this Conversation"})
+		return
+	}
+
+	rows, err := m.store.ListMessageEdits(ctx, messageId)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Fetch Edits from Database"})
+		return
+	}
+	edits := make([]types.MessageEditDetails, 0, len(rows))
+	for _, row := range rows {
+		edits = append(edits, types.MessageEditDetails{Content: row.Content, ReplacedAt: row.ReplacedAt.Time})
+	}
+
+	ctx.JSON(http.StatusOK, types.GenerateResponse(edits, "Edits Fetched"))
+}
+
+func (m *MessageHandler) isMember(ctx *gin.Context, conversationId int64) bool {
+	_, err := m.store.GetConversationMember(ctx, db.GetConversationMemberParams{
+		ConversationID: conversationId,
+		UserID:         middlewares.GetAuthUserId(ctx),
+	})
+	return err == nil
+}
+
+// respondWithChangeError writes the response for a failed edit or delete and reports whether it succeeded
+func respondWithChangeError(ctx *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrMessageNotFound), errors.Is(err, pgx.ErrNoRows):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Message Not Found"})
+	case errors.Is(err, ErrNotMessageAuthor):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Only the Author can change a Message"})
+	case errors.Is(err, ErrEditWindowExpired):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "The Message can no longer be Edited"})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Update Message in Database"})
+	}
+	return false
+}
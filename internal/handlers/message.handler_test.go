@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"tarun-kavipurapu/test-go-chat/db/dbtest"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// recordingNotifier remembers the changes it was told about.
+type recordingNotifier struct {
+	edited  []db.Message
+	deleted []db.Message
+}
+
+func (n *recordingNotifier) MessageEdited(message db.Message) { n.edited = append(n.edited, message) }
+func (n *recordingNotifier) MessageDeleted(message db.Message) {
+	n.deleted = append(n.deleted, message)
+}
+
+// authoredConn is a database where user 1 sent message 1 just now and message 3 long ago, user 2 sent
+// message 2, message 4 was deleted and message 5 of user 1 replies to message 2.
+func authoredConn() *dbtest.Conn {
+	now := time.Now()
+	messages := map[int64]db.Message{
+		1: {ID: 1, FromUserID: 1, ConversationID: 5, Content: "old", CreatedAt: pgtype.Timestamptz{Time: now, Valid: true}},
+		2: {ID: 2, FromUserID: 2, ConversationID: 5, Content: "theirs", CreatedAt: pgtype.Timestamptz{Time: now, Valid: true}},
+		3: {ID: 3, FromUserID: 1, ConversationID: 5, Content: "older", CreatedAt: pgtype.Timestamptz{Time: now.Add(-MessageEditWindow - time.Minute), Valid: true}},
+		4: {ID: 4, FromUserID: 1, ConversationID: 5, DeletedAt: pgtype.Timestamptz{Time: now, Valid: true}},
+		5: {ID: 5, FromUserID: 1, ConversationID: 5, Content: "reply", ReplyTo: pgtype.Int8{Int64: 2, Valid: true}, CreatedAt: pgtype.Timestamptz{Time: now, Valid: true}},
+	}
+	conn := dbtest.NewConn()
+	conn.OnQuery("GetMessageForUpdate", func(args []interface{}) ([][]interface{}, error) {
+		message, ok := messages[args[0].(int64)]
+		if !ok {
+			return nil, nil
+		}
+		return dbtest.Rows(message), nil
+	})
+	conn.OnQuery("UpdateMessageContent", func(args []interface{}) ([][]interface{}, error) {
+		message := messages[args[0].(int64)]
+		message.Content = args[1].(string)
+		message.EditedAt = pgtype.Timestamptz{Time: now, Valid: true}
+		return dbtest.Rows(message), nil
+	})
+	conn.OnQuery("SoftDeleteMessage", func(args []interface{}) ([][]interface{}, error) {
+		message := messages[args[0].(int64)]
+		message.Content = ""
+		message.DeletedAt = pgtype.Timestamptz{Time: now, Valid: true}
+		return dbtest.Rows(message), nil
+	})
+	return conn
+}
+
+func TestEditMessageKeepsHistoryAndNotifies(t *testing.T) {
+	conn := authoredConn()
+	notifier := &recordingNotifier{}
+	messages := NewMessageHandler(dbtest.NewStore(conn), NewChatHandler(dbtest.NewStore(conn)), notifier)
+
+	recorder := serve(messages.EditMessage, 1, http.MethodPatch, "/messages/1", `{"content":"new"}`, "id", "1")
+	expectStatus(t, recorder, http.StatusOK)
+
+	if edits := conn.Calls("InsertMessageEdit"); len(edits) != 1 || edits[0][1].(string) != "old" {
+		t.Fatalf("edit history got %v, want the old content", edits)
+	}
+	if len(notifier.edited) != 1 || notifier.edited[0].Content != "new" || !notifier.edited[0].EditedAt.Valid {
+		t.Fatalf("notified edits %+v", notifier.edited)
+	}
+}
+
+func TestEditMessageRefusals(t *testing.T) {
+	conn := authoredConn()
+	notifier := &recordingNotifier{}
+	messages := NewMessageHandler(dbtest.NewStore(conn), NewChatHandler(dbtest.NewStore(conn)), notifier)
+
+	for id, status := range map[string]int{"2": http.StatusForbidden, "3": http.StatusForbidden, "4": http.StatusNotFound, "9": http.StatusNotFound} {
+		recorder := serve(messages.EditMessage, 1, http.MethodPatch, "/messages/"+id, `{"content":"new"}`, "id", id)
+		expectStatus(t, recorder, status)
+	}
+
+	// content over the limit is refused before the message is even looked up
+	calls := len(conn.Calls("GetMessageForUpdate"))
+	body := `{"content":"` + strings.Repeat("é", MaxMessageLength+1) + `"}`
+	expectStatus(t, serve(messages.EditMessage, 1, http.MethodPatch, "/messages/1", body, "id", "1"), http.StatusBadRequest)
+	expectStatus(t, serve(messages.EditMessage, 1, http.MethodPatch, "/messages/1", `{"content":""}`, "id", "1"), http.StatusBadRequest)
+	if len(conn.Calls("GetMessageForUpdate")) != calls {
+		t.Fatal("an invalid edit reached the database")
+	}
+
+	if len(notifier.edited) != 0 || len(conn.Calls("UpdateMessageContent")) != 0 {
+		t.Fatal("a refused edit was applied")
+	}
+}
+
+func TestDeleteMessageLeavesTombstone(t *testing.T) {
+	conn := authoredConn()
+	notifier := &recordingNotifier{}
+	messages := NewMessageHandler(dbtest.NewStore(conn), NewChatHandler(dbtest.NewStore(conn)), notifier)
+
+	expectStatus(t, serve(messages.DeleteMessage, 2, http.MethodDelete, "/messages/1", "", "id", "1"), http.StatusForbidden)
+	expectStatus(t, serve(messages.DeleteMessage, 1, http.MethodDelete, "/messages/4", "", "id", "4"), http.StatusNotFound)
+	if len(notifier.deleted) != 0 {
+		t.Fatal("a refused delete was notified")
+	}
+
+	recorder := serve(messages.DeleteMessage, 1, http.MethodDelete, "/messages/3", "", "id", "3")
+	expectStatus(t, recorder, http.StatusOK)
+	if !strings.Contains(recorder.Body.String(), DeletedMessageContent) || strings.Contains(recorder.Body.String(), "older") {
+		t.Fatalf("deleted message returned as %s", recorder.Body.String())
+	}
+	if calls := conn.Calls("DeleteMessageEdits"); len(calls) != 1 || calls[0][0].(int64) != 3 {
+		t.Fatalf("edit history deleted with %v, want message 3", calls)
+	}
+	if len(notifier.deleted) != 1 || notifier.deleted[0].ID != 3 {
+		t.Fatalf("notified deletes %+v", notifier.deleted)
+	}
+	if len(conn.Calls("RecountMessageReplies")) != 0 {
+		t.Fatal("deleting a message that is not a reply recounted a thread")
+	}
+}
+
+func TestDeleteReplyRecountsItsThread(t *testing.T) {
+	conn := authoredConn()
+	messages := NewMessageHandler(dbtest.NewStore(conn), NewChatHandler(dbtest.NewStore(conn)), &recordingNotifier{})
+
+	expectStatus(t, serve(messages.DeleteMessage, 1, http.MethodDelete, "/messages/5", "", "id", "5"), http.StatusOK)
+	if calls := conn.Calls("RecountMessageReplies"); len(calls) != 1 || calls[0][0].(int64) != 2 {
+		t.Fatalf("thread recounted with %v, want message 2", calls)
+	}
+}
+
+func TestGetMessageEditsRequiresMembership(t *testing.T) {
+	conn := authoredConn()
+	conn.OnQuery("GetMessageById", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.Message{ID: args[0].(int64), ConversationID: 5}), nil
+	})
+	messages := NewMessageHandler(dbtest.NewStore(conn), NewChatHandler(dbtest.NewStore(conn)), &recordingNotifier{})
+
+	expectStatus(t, serve(messages.GetMessageEdits, 3, http.MethodGet, "/messages/1/edits", "", "id", "1"), http.StatusForbidden)
+	if len(conn.Calls("ListMessageEdits")) != 0 {
+		t.Fatal("edits of a conversation the caller is not in were loaded")
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/internal/middlewares"
+	"tarun-kavipurapu/test-go-chat/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxPresenceBatch caps the number of users of a bulk presence query
+const maxPresenceBatch = 100
+
+// PresenceSource reports which users currently have a live socket connection, a whole batch at once
+type PresenceSource interface {
+	OnlineUsers(userIds []int64) map[int64]bool
+}
+
+type PresenceHandler struct {
+	store    db.Store
+	presence PresenceSource
+}
+
+func NewPresenceHandler(store db.Store, presence PresenceSource) *PresenceHandler {
+	return &PresenceHandler{store: store, presence: presence}
+}
+
+// GetPresence returns whether a single user is online and when they were last seen, users only see the presence
+// of the users they share a conversation with and neither blocked
+func (p *PresenceHandler) GetPresence(ctx *gin.Context) {
+	userId, ok := parseIdParam(ctx, "id")
+	if !ok {
+		return
+	}
+
+	presences, err := p.lookup(ctx, []int64{userId})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Fetch Presence from Database"})
+		return
+	}
+	if len(presences) == 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User Not Found in the Database"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, types.GenerateResponse(presences[0], "Presence Fetched"))
+}
+
+// GetBulkPresence returns the presence of the users listed in the comma separated ids query parameter
+func (p *PresenceHandler) GetBulkPresence(ctx *gin.Context) {
+	var userIds []int64
+	for _, raw := range strings.Split(ctx.Query("ids"), ",") {
+		if raw == "" {
+			continue
+		}
+		userId, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ids"})
+			return
+		}
+		userIds = append(userIds, userId)
+	}
+	if len(userIds) == 0 || len(userIds) > maxPresenceBatch {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Provide between 1 and 100 ids"})
+		return
+	}
+
+	presences, err := p.lookup(ctx, userIds)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Fetch Presence from Database"})
+		return
+	}
+
+	// users whose presence is hidden are left out
+	ctx.JSON(http.StatusOK, types.GenerateResponse(presences, "Presence Fetched"))
+}
+
+// lookup returns the presence of the users visible to the authenticated user: themself and their peers,
+// unless either of them blocked the other
+func (p *PresenceHandler) lookup(ctx *gin.Context, userIds []int64) ([]types.PresenceDetails, error) {
+	userId := middlewares.GetAuthUserId(ctx)
+	peerIds, err := p.store.ListPeerIds(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	blockedIds, err := p.store.ListBlockRelatedIds(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := make(map[int64]bool, len(peerIds)+1)
+	visible[userId] = true
+	for _, peerId := range peerIds {
+		visible[peerId] = true
+	}
+	for _, blockedId := range blockedIds {
+		delete(visible, blockedId)
+	}
+	var visibleIds []int64
+	for _, id := range userIds {
+		if visible[id] {
+			visibleIds = append(visibleIds, id)
+		}
+	}
+	if len(visibleIds) == 0 {
+		return []types.PresenceDetails{}, nil
+	}
+
+	rows, err := p.store.ListUsersLastSeen(ctx, visibleIds)
+	if err != nil {
+		return nil, err
+	}
+
+	online := p.presence.OnlineUsers(visibleIds)
+	presences := make([]types.PresenceDetails, 0, len(rows))
+	for _, row := range rows {
+		presence := types.PresenceDetails{
+			UserId: row.ID,
+			Online: online[row.ID],
+		}
+		if row.LastSeenAt.Valid {
+			presence.LastSeenAt = &row.LastSeenAt.Time
+		}
+		presences = append(presences, presence)
+	}
+	return presences, nil
+}
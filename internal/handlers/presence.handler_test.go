@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"tarun-kavipurapu/test-go-chat/db/dbtest"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/types"
+	"testing"
+)
+
+// onlineUsers is a presence source counting the batches it was asked about.
+type onlineUsers struct {
+	online  map[int64]bool
+	batches [][]int64
+}
+
+func (o *onlineUsers) OnlineUsers(userIds []int64) map[int64]bool {
+	o.batches = append(o.batches, userIds)
+	online := make(map[int64]bool)
+	for _, userId := range userIds {
+		online[userId] = o.online[userId]
+	}
+	return online
+}
+
+// presenceConn is a database where user 1 shares conversations with users 2 and 3.
+// User 5 shares nothing with user 1.
+func presenceConn() *dbtest.Conn {
+	conn := dbtest.NewConn()
+	conn.OnQuery("ListPeerIds", func(args []interface{}) ([][]interface{}, error) {
+		return [][]interface{}{{int64(2)}, {int64(3)}}, nil
+	})
+	conn.OnQuery("ListUsersLastSeen", func(args []interface{}) ([][]interface{}, error) {
+		var rows []db.ListUsersLastSeenRow
+		for _, id := range args[0].([]int64) {
+			rows = append(rows, db.ListUsersLastSeenRow{ID: id})
+		}
+		return dbtest.Rows(rows...), nil
+	})
+	return conn
+}
+
+func TestGetPresenceOfPeers(t *testing.T) {
+	presence := NewPresenceHandler(dbtest.NewStore(presenceConn()), &onlineUsers{online: map[int64]bool{2: true}})
+
+	recorder := serve(presence.GetPresence, 1, http.MethodGet, "/presence/2", "", "id", "2")
+	expectStatus(t, recorder, http.StatusOK)
+	var response struct {
+		Data types.PresenceDetails `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Data.UserId != 2 || !response.Data.Online {
+		t.Fatalf("got %+v, want user 2 online", response.Data)
+	}
+
+	expectStatus(t, serve(presence.GetPresence, 1, http.MethodGet, "/presence/1", "", "id", "1"), http.StatusOK)
+	// no shared conversation
+	expectStatus(t, serve(presence.GetPresence, 1, http.MethodGet, "/presence/5", "", "id", "5"), http.StatusNotFound)
+}
+
+func TestGetBulkPresenceLeavesOutHiddenUsers(t *testing.T) {
+	conn := presenceConn()
+	source := &onlineUsers{online: map[int64]bool{3: true}}
+	presence := NewPresenceHandler(dbtest.NewStore(conn), source)
+
+	recorder := serve(presence.GetBulkPresence, 1, http.MethodGet, "/presence?ids=2,3,5", "")
+	expectStatus(t, recorder, http.StatusOK)
+	var response struct {
+		Data []types.PresenceDetails `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Data) != 2 || response.Data[0].UserId != 2 || response.Data[0].Online || !response.Data[1].Online {
+		t.Fatalf("got %+v, want user 2 offline and user 3 online", response.Data)
+	}
+	// the connections of the whole batch are looked up at once
+	if len(source.batches) != 1 || !slices.Equal(source.batches[0], []int64{2, 3}) {
+		t.Fatalf("presence asked for %v, want [[2 3]]", source.batches)
+	}
+
+	// nothing visible is not looked up
+	expectStatus(t, serve(presence.GetBulkPresence, 1, http.MethodGet, "/presence?ids=5", ""), http.StatusOK)
+	if calls := conn.Calls("ListUsersLastSeen"); len(calls) != 1 || !slices.Equal(calls[0][0].([]int64), []int64{2, 3}) {
+		t.Fatalf("last seen looked up with %v, want [[2 3]] once", calls)
+	}
+}
+
+func TestPresenceHidesUsersOnEitherSideOfABlock(t *testing.T) {
+	conn := presenceConn()
+	// user 1 also shares a conversation with user 4, blocked user 3 and was blocked by user 4
+	conn.OnQuery("ListPeerIds", func(args []interface{}) ([][]interface{}, error) {
+		return [][]interface{}{{int64(2)}, {int64(3)}, {int64(4)}}, nil
+	})
+	conn.OnQuery("ListBlockRelatedIds", func(args []interface{}) ([][]interface{}, error) {
+		return [][]interface{}{{int64(3)}, {int64(4)}}, nil
+	})
+	presence := NewPresenceHandler(dbtest.NewStore(conn), &onlineUsers{online: map[int64]bool{3: true, 4: true}})
+
+	for _, id := range []string{"3", "4"} {
+		expectStatus(t, serve(presence.GetPresence, 1, http.MethodGet, "/presence/"+id, "", "id", id), http.StatusNotFound)
+	}
+
+	recorder := serve(presence.GetBulkPresence, 1, http.MethodGet, "/presence?ids=2,3,4", "")
+	expectStatus(t, recorder, http.StatusOK)
+	var response struct {
+		Data []types.PresenceDetails `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Data) != 1 || response.Data[0].UserId != 2 {
+		t.Fatalf("got %+v, want only user 2", response.Data)
+	}
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/internal/media"
+	"tarun-kavipurapu/test-go-chat/internal/middlewares"
+	"tarun-kavipurapu/test-go-chat/internal/storage"
+	"tarun-kavipurapu/test-go-chat/types"
+	"tarun-kavipurapu/test-go-chat/utils"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// MaxProfilePhotoSize is the largest image accepted as profile photo, it is scaled down before it is stored.
+	MaxProfilePhotoSize = 5 << 20
+
+	// Lengths of the profile columns of the users table.
+	maxDisplayNameLength = 64
+	maxStatusTextLength  = 140
+	maxBioLength         = 500
+
+	// Postgres error code of a unique constraint violation.
+	uniqueViolation = "23505"
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.]{3,32}$`)
+
+// ProfileNotifier pushes a changed profile to the users sharing a conversation with its owner
+type ProfileNotifier interface {
+	ProfileUpdated(user db.User)
+}
+
+// ProfileHandler lets users read and change their own profile and serves profile photos
+type ProfileHandler struct {
+	store    db.Store
+	blobs    storage.BlobStore
+	notifier ProfileNotifier
+}
+
+func NewProfileHandler(store db.Store, blobs storage.BlobStore, notifier ProfileNotifier) *ProfileHandler {
+	return &ProfileHandler{store: store, blobs: blobs, notifier: notifier}
+}
+
+// GetProfile returns the profile of the caller
+func (p *ProfileHandler) GetProfile(ctx *gin.Context) {
+	user, err := p.store.GetUserById(ctx, middlewares.GetAuthUserId(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User Not Found in the Database"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, types.GenerateResponse(NewProfileDetails(user), "Profile Fetched"))
+}
+
+// UpdateProfile changes the username, display name, status text or bio of the caller
+func (p *ProfileHandler) UpdateProfile(ctx *gin.Context) {
+	var req types.UpdateProfileRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Parsing request Error"})
+		return
+	}
+	user, err := p.store.GetUserById(ctx, middlewares.GetAuthUserId(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User Not Found in the Database"})
+		return
+	}
+
+	params := db.UpdateUserProfileParams{
+		ID:          user.ID,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		StatusText:  user.StatusText,
+		Bio:         user.Bio,
+	}
+	if req.Username != nil {
+		params.Username = strings.TrimSpace(*req.Username)
+		if params.Username != user.Username && !usernamePattern.MatchString(params.Username) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Usernames are 3 to 32 letters, digits, dots or underscores"})
+			return
+		}
+	}
+	if req.DisplayName != nil {
+		params.DisplayName = strings.TrimSpace(*req.DisplayName)
+	}
+	if req.StatusText != nil {
+		params.StatusText = strings.TrimSpace(*req.StatusText)
+	}
+	if req.Bio != nil {
+		params.Bio = strings.TrimSpace(*req.Bio)
+	}
+	if utf8.RuneCountInString(params.DisplayName) > maxDisplayNameLength ||
+		utf8.RuneCountInString(params.StatusText) > maxStatusTextLength ||
+		utf8.RuneCountInString(params.Bio) > maxBioLength {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Display names are at most 64 characters, status texts 140 and bios 500"})
+		return
+	}
+
+	// nothing changed, updated_at stays as it is
+	if params.Username == user.Username && params.DisplayName == user.DisplayName &&
+		params.StatusText == user.StatusText && params.Bio == user.Bio {
+		ctx.JSON(http.StatusOK, types.GenerateResponse(NewProfileDetails(user), "Profile Updated"))
+		return
+	}
+
+	user, err = p.store.UpdateUserProfile(ctx, params)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Username is already Taken"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Update Profile in Database"})
+		return
+	}
+	p.notifier.ProfileUpdated(user)
+
+	ctx.JSON(http.StatusOK, types.GenerateResponse(NewProfileDetails(user), "Profile Updated"))
+}
+
+// UploadPhoto replaces the profile photo of the caller with the image of the multipart field "photo"
+func (p *ProfileHandler) UploadPhoto(ctx *gin.Context) {
+	userId := middlewares.GetAuthUserId(ctx)
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, MaxProfilePhotoSize+1<<20)
+	header, err := ctx.FormFile("photo")
+	if err != nil || header.Size > MaxProfilePhotoSize {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Send the image in the photo field, at most 5 MB"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Unable to read the file"})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Unable to read the file"})
+		return
+	}
+
+	photo, err := media.ProfilePhoto(data)
+	if errors.Is(err, media.ErrNotImage) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "The photo must be a JPEG, PNG, GIF or WebP image"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Process the Photo"})
+		return
+	}
+
+	user, err := p.store.GetUserById(ctx, userId)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "User Not Found in the Database"})
+		return
+	}
+	// a new name for every photo, so clients can cache the link
+	name := utils.GenerateUniqueFilename("photo.jpg")
+	if err := p.blobs.Put(ctx, profilePhotoKey(userId, name), bytes.NewReader(photo), int64(len(photo)), "image/jpeg"); err != nil {
+		log.Printf("Unable to store profile photo of %d: %v\n", userId, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Store the File"})
+		return
+	}
+	updated, err := p.store.UpdateUserPhoto(ctx, db.UpdateUserPhotoParams{
+		ID:             userId,
+		UsersPhotoLink: pgtype.Text{String: profilePhotoLink(userId, name), Valid: true},
+	})
+	if err != nil {
+		p.blobs.Delete(ctx, profilePhotoKey(userId, name))
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Update Profile in Database"})
+		return
+	}
+	if oldName, ok := strings.CutPrefix(user.UsersPhotoLink.String, profilePhotoLink(userId, "")); ok && oldName != "" {
+		if err := p.blobs.Delete(ctx, profilePhotoKey(userId, oldName)); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Unable to delete old profile photo of %d: %v\n", userId, err)
+		}
+	}
+	p.notifier.ProfileUpdated(updated)
+
+	ctx.JSON(http.StatusOK, types.GenerateResponse(NewProfileDetails(updated), "Profile Photo Updated"))
+}
+
+// GetPhoto serves a profile photo, the links are public so clients can load them like any image
+func (p *ProfileHandler) GetPhoto(ctx *gin.Context) {
+	userId, ok := parseIdParam(ctx, "id")
+	if !ok {
+		return
+	}
+	name := ctx.Param("name")
+	if strings.Contains(name, "..") {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "File Not Found"})
+		return
+	}
+	serveBlob(ctx, p.blobs, profilePhotoKey(userId, name), -1, "image/jpeg", name)
+}
+
+func profilePhotoKey(userId int64, name string) string {
+	return fmt.Sprintf("profiles/%d/%s", userId, name)
+}
+
+// profilePhotoLink is the users_photo_link of a photo stored in the blob store, served by GetPhoto
+func profilePhotoLink(userId int64, name string) string {
+	return fmt.Sprintf("/users/%d/photo/%s", userId, name)
+}
+
+// NewProfileDetails converts a user into the profile its owner sees
+func NewProfileDetails(user db.User) types.ProfileDetails {
+	return types.ProfileDetails{
+		Id:          user.ID,
+		Email:       user.Email,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		StatusText:  user.StatusText,
+		Bio:         user.Bio,
+		PhotoLink:   user.UsersPhotoLink.String,
+		CreatedAt:   user.CreatedAt.Time,
+		UpdatedAt:   user.UpdatedAt.Time,
+	}
+}
+
+// NewPublicProfile converts a user into the profile other users see
+func NewPublicProfile(user db.User) types.PublicProfile {
+	return types.PublicProfile{
+		Id:          user.ID,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		StatusText:  user.StatusText,
+		Bio:         user.Bio,
+		PhotoLink:   user.UsersPhotoLink.String,
+	}
+}
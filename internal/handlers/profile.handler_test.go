@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"tarun-kavipurapu/test-go-chat/db/dbtest"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/internal/middlewares"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// recordingProfiles remembers the profiles it was told about.
+type recordingProfiles []db.User
+
+func (r *recordingProfiles) ProfileUpdated(user db.User) {
+	*r = append(*r, user)
+}
+
+// profileConn is a database holding user 1, alice, whose photo is old.jpg. The username taken belongs to someone else.
+func profileConn() *dbtest.Conn {
+	conn := dbtest.NewConn()
+	conn.OnQuery("GetUserById", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.User{ID: 1, Username: "alice", DisplayName: "Alice", UsersPhotoLink: pgtype.Text{String: "/users/1/photo/old.jpg", Valid: true}}), nil
+	})
+	// the arguments are id, username, display_name, status_text and bio
+	conn.OnQuery("UpdateUserProfile", func(args []interface{}) ([][]interface{}, error) {
+		if args[1].(string) == "taken" {
+			return nil, &pgconn.PgError{Code: uniqueViolation}
+		}
+		return dbtest.Rows(db.User{ID: 1, Username: args[1].(string), DisplayName: args[2].(string), StatusText: args[3].(string), Bio: args[4].(string)}), nil
+	})
+	conn.OnQuery("UpdateUserPhoto", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.User{ID: 1, Username: "alice", UsersPhotoLink: args[1].(pgtype.Text)}), nil
+	})
+	return conn
+}
+
+func TestUpdateProfileChangesTheGivenFields(t *testing.T) {
+	conn := profileConn()
+	var notified recordingProfiles
+	profiles := NewProfileHandler(dbtest.NewStore(conn), &memoryBlobs{}, &notified)
+
+	recorder := serve(profiles.UpdateProfile, 1, http.MethodPatch, "/users/me", `{"status_text":"  away  "}`)
+	expectStatus(t, recorder, http.StatusOK)
+	calls := conn.Calls("UpdateUserProfile")
+	if len(calls) != 1 || calls[0][1] != "alice" || calls[0][2] != "Alice" || calls[0][3] != "away" {
+		t.Fatalf("updated with %v, want only the trimmed status text changed", calls)
+	}
+	if len(notified) != 1 || notified[0].StatusText != "away" {
+		t.Fatalf("notified %+v", notified)
+	}
+
+	// the same values again change nothing
+	expectStatus(t, serve(profiles.UpdateProfile, 1, http.MethodPatch, "/users/me", `{"user_name":"alice","display_name":"Alice "}`), http.StatusOK)
+	if len(conn.Calls("UpdateUserProfile")) != 1 || len(notified) != 1 {
+		t.Fatal("an unchanged profile was written")
+	}
+}
+
+func TestUpdateProfileRefusals(t *testing.T) {
+	conn := profileConn()
+	var notified recordingProfiles
+	profiles := NewProfileHandler(dbtest.NewStore(conn), &memoryBlobs{}, &notified)
+
+	for _, body := range []string{`{"user_name":"a"}`, `{"user_name":"with space"}`, `{"bio":"` + strings.Repeat("b", maxBioLength+1) + `"}`} {
+		expectStatus(t, serve(profiles.UpdateProfile, 1, http.MethodPatch, "/users/me", body), http.StatusBadRequest)
+	}
+	if len(conn.Calls("UpdateUserProfile")) != 0 {
+		t.Fatal("an invalid profile was written")
+	}
+	expectStatus(t, serve(profiles.UpdateProfile, 1, http.MethodPatch, "/users/me", `{"user_name":"taken"}`), http.StatusConflict)
+	if len(notified) != 0 {
+		t.Fatalf("notified %+v", notified)
+	}
+}
+
+// uploadPhoto sends the content as the photo field of a multipart form.
+func uploadPhoto(t *testing.T, profiles *ProfileHandler, content []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("photo", "me.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	form.Close()
+
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodPut, "/users/me/photo", &body)
+	ctx.Request.Header.Set("Content-Type", form.FormDataContentType())
+	middlewares.SetAuthUserId(ctx, 1)
+	profiles.UploadPhoto(ctx)
+	return recorder
+}
+
+func TestUploadPhotoReplacesTheOldOne(t *testing.T) {
+	conn := profileConn()
+	blobs := &memoryBlobs{blobs: map[string]string{"profiles/1/old.jpg": "old"}}
+	var notified recordingProfiles
+	profiles := NewProfileHandler(dbtest.NewStore(conn), blobs, &notified)
+
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, image.NewGray(image.Rect(0, 0, 600, 300))); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, uploadPhoto(t, profiles, encoded.Bytes()), http.StatusOK)
+
+	if _, ok := blobs.blobs["profiles/1/old.jpg"]; ok || len(blobs.blobs) != 1 {
+		t.Fatalf("blobs %v, want the new photo only", blobs.blobs)
+	}
+	link := conn.Calls("UpdateUserPhoto")[0][1].(pgtype.Text).String
+	name, _ := strings.CutPrefix(link, "/users/1/photo/")
+	config, err := jpeg.DecodeConfig(strings.NewReader(blobs.blobs[profilePhotoKey(1, name)]))
+	if err != nil || config.Width != 512 || config.Height != 256 {
+		t.Fatalf("photo at %s decodes as %+v (%v), want 512 by 256", link, config, err)
+	}
+	if len(notified) != 1 || notified[0].UsersPhotoLink.String != link {
+		t.Fatalf("notified %+v", notified)
+	}
+
+	expectStatus(t, uploadPhoto(t, profiles, []byte("not an image")), http.StatusBadRequest)
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"html"
+	"net/http"
+	"strings"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/internal/middlewares"
+	"tarun-kavipurapu/test-go-chat/types"
+	"tarun-kavipurapu/test-go-chat/utils"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Longest message search accepted, in characters.
+const maxMessageSearchLength = 200
+
+// snippetMarks turns the match markers SearchMessages puts in its snippets into HTML
+var snippetMarks = strings.NewReplacer("\ue000", "<mark>", "\ue001", "</mark>")
+
+// SearchHandler searches the messages of the caller's conversations
+type SearchHandler struct {
+	store db.Store
+}
+
+func NewSearchHandler(store db.Store) *SearchHandler {
+	return &SearchHandler{store: store}
+}
+
+// SearchMessages returns the messages matching the query, newest first, from the conversations the caller is a member of.
+// The query supports "quoted phrases", or and -excluded words, and can be narrowed by sender, conversation and time.
+func (s *SearchHandler) SearchMessages(ctx *gin.Context) {
+	var query types.MessageSearchQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Parsing request Error"})
+		return
+	}
+	search := strings.TrimSpace(query.Q)
+	if search == "" || utf8.RuneCountInString(search) > maxMessageSearchLength {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Search for 1 to 200 characters"})
+		return
+	}
+	if !query.Since.IsZero() && !query.Until.IsZero() && !query.Since.Before(query.Until) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "since must be before until"})
+		return
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	params := db.SearchMessagesParams{
+		Query:          search,
+		UserID:         middlewares.GetAuthUserId(ctx),
+		FromUserID:     pgtype.Int8{Int64: query.From, Valid: query.From != 0},
+		ConversationID: pgtype.Int8{Int64: query.ConversationId, Valid: query.ConversationId != 0},
+		Since:          pgtype.Timestamptz{Time: query.Since, Valid: !query.Since.IsZero()},
+		Until:          pgtype.Timestamptz{Time: query.Until, Valid: !query.Until.IsZero()},
+		PageLimit:      limit + 1,
+	}
+	// the first page has no cursor and starts with the newest match
+	if query.Before != "" {
+		createdAt, id, err := utils.DecodeCursor(query.Before)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		params.CursorCreatedAt = pgtype.Timestamptz{Time: createdAt, Valid: true}
+		params.CursorID = pgtype.Int8{Int64: id, Valid: true}
+	}
+
+	rows, err := s.store.SearchMessages(ctx, params)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to Search Messages in Database"})
+		return
+	}
+
+	// one extra row is fetched to know whether another page exists
+	page := types.MessageSearchPage{HasMore: len(rows) > int(limit)}
+	if page.HasMore {
+		rows = rows[:limit]
+	}
+	page.Messages = make([]types.MessageSearchResult, 0, len(rows))
+	for _, row := range rows {
+		page.Messages = append(page.Messages, types.MessageSearchResult{
+			Id:             row.ID,
+			From:           row.FromUserID,
+			ConversationId: row.ConversationID,
+			Seq:            row.Seq,
+			Snippet:        snippetMarks.Replace(html.EscapeString(row.Snippet)),
+			CreatedAt:      row.CreatedAt.Time,
+		})
+	}
+	if len(rows) > 0 {
+		oldest := rows[len(rows)-1]
+		page.Before = utils.EncodeCursor(oldest.CreatedAt.Time, oldest.ID)
+	}
+
+	ctx.JSON(http.StatusOK, types.GenerateResponse(page, "Messages Fetched"))
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"tarun-kavipurapu/test-go-chat/db/dbtest"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/types"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// searchConn is a database where messages 1 to 5, a second apart, match every search.
+func searchConn() *dbtest.Conn {
+	start := time.Date(2024, time.May, 1, 12, 0, 0, 0, time.UTC)
+	conn := dbtest.NewConn()
+	// the SearchMessages arguments are query, user_id, from_user_id, conversation_id, since, until,
+	// cursor_created_at, cursor_id and page_limit
+	conn.OnQuery("SearchMessages", func(args []interface{}) ([][]interface{}, error) {
+		cursorAt, cursorId := args[6].(pgtype.Timestamptz), args[7].(pgtype.Int8)
+		var page []db.SearchMessagesRow
+		for id := int64(5); id >= 1 && len(page) < int(args[8].(int32)); id-- {
+			createdAt := start.Add(time.Duration(id) * time.Second)
+			if cursorAt.Valid && !(createdAt.Before(cursorAt.Time) || (createdAt.Equal(cursorAt.Time) && id < cursorId.Int64)) {
+				continue
+			}
+			page = append(page, db.SearchMessagesRow{
+				ID:             id,
+				ConversationID: 3,
+				CreatedAt:      pgtype.Timestamptz{Time: createdAt, Valid: true},
+				Snippet:        "say \ue000hello\ue001 <b>",
+			})
+		}
+		return dbtest.Rows(page...), nil
+	})
+	return conn
+}
+
+func searchMessages(t *testing.T, search *SearchHandler, query string) types.MessageSearchPage {
+	t.Helper()
+	recorder := serve(search.SearchMessages, 1, http.MethodGet, "/messages/search?"+query, "")
+	expectStatus(t, recorder, http.StatusOK)
+	var response struct {
+		Data types.MessageSearchPage `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response.Data
+}
+
+func searchIds(page types.MessageSearchPage) []int64 {
+	ids := make([]int64, len(page.Messages))
+	for i, message := range page.Messages {
+		ids[i] = message.Id
+	}
+	return ids
+}
+
+func TestSearchMessagesPagesNewestFirst(t *testing.T) {
+	conn := searchConn()
+	search := NewSearchHandler(dbtest.NewStore(conn))
+
+	first := searchMessages(t, search, "q=hello&limit=2")
+	if ids := searchIds(first); !slices.Equal(ids, []int64{5, 4}) || !first.HasMore {
+		t.Fatalf("first page %v (has more %t), want [5 4] with more", ids, first.HasMore)
+	}
+	// the first page is not bounded by a cursor
+	if call := conn.Calls("SearchMessages")[0]; call[6].(pgtype.Timestamptz).Valid || call[7].(pgtype.Int8).Valid {
+		t.Fatalf("first page searched before %v and %v", call[6], call[7])
+	}
+	if snippet := first.Messages[0].Snippet; snippet != "say <mark>hello</mark> &lt;b&gt;" {
+		t.Fatalf("snippet %q", snippet)
+	}
+
+	second := searchMessages(t, search, "q=hello&limit=2&before="+first.Before)
+	if ids := searchIds(second); !slices.Equal(ids, []int64{3, 2}) || !second.HasMore {
+		t.Fatalf("second page %v (has more %t), want [3 2] with more", ids, second.HasMore)
+	}
+	last := searchMessages(t, search, "q=hello&limit=2&before="+second.Before)
+	if ids := searchIds(last); !slices.Equal(ids, []int64{1}) || last.HasMore {
+		t.Fatalf("last page %v (has more %t), want [1] without more", ids, last.HasMore)
+	}
+}
+
+func TestSearchMessagesFilters(t *testing.T) {
+	conn := searchConn()
+	search := NewSearchHandler(dbtest.NewStore(conn))
+
+	searchMessages(t, search, "q=+hello+world+")
+	searchMessages(t, search, "q=hello&from=2&conversation_id=3&since=2024-05-01T00:00:00Z&until=2024-05-02T00:00:00Z")
+	calls := conn.Calls("SearchMessages")
+	unfiltered, filtered := calls[0], calls[1]
+	if unfiltered[0] != "hello world" || unfiltered[1] != int64(1) {
+		t.Fatalf("searched %v for %v, want the trimmed query for the caller", unfiltered[0], unfiltered[1])
+	}
+	if unfiltered[2].(pgtype.Int8).Valid || unfiltered[3].(pgtype.Int8).Valid ||
+		unfiltered[4].(pgtype.Timestamptz).Valid || unfiltered[5].(pgtype.Timestamptz).Valid {
+		t.Fatalf("unfiltered search narrowed by %v", unfiltered[2:6])
+	}
+	if filtered[2] != (pgtype.Int8{Int64: 2, Valid: true}) || filtered[3] != (pgtype.Int8{Int64: 3, Valid: true}) ||
+		!filtered[4].(pgtype.Timestamptz).Time.Equal(time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)) ||
+		!filtered[5].(pgtype.Timestamptz).Time.Equal(time.Date(2024, time.May, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("filtered with %v", filtered[2:6])
+	}
+}
+
+func TestSearchMessagesRefusals(t *testing.T) {
+	conn := searchConn()
+	search := NewSearchHandler(dbtest.NewStore(conn))
+
+	for _, query := range []string{
+		"q=+",
+		"q=" + strings.Repeat("a", maxMessageSearchLength+1),
+		"q=hello&since=2024-05-02T00:00:00Z&until=2024-05-01T00:00:00Z",
+		"q=hello&since=yesterday",
+		"q=hello&before=garbage",
+		"q=hello&before=%25%25",
+	} {
+		expectStatus(t, serve(search.SearchMessages, 1, http.MethodGet, "/messages/search?"+query, ""), http.StatusBadRequest)
+	}
+	if len(conn.Calls("SearchMessages")) != 0 {
+		t.Fatal("a refused search reached the database")
+	}
+}
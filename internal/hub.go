@@ -2,103 +2,625 @@ package internal
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"log"
+	"runtime"
+	"slices"
 	db "tarun-kavipurapu/test-go-chat/db/sqlc"
 	"tarun-kavipurapu/test-go-chat/internal/handlers"
+	"tarun-kavipurapu/test-go-chat/types"
+	"time"
 )
 
-// Hub maintains the set of active clients and broadcasts messages to the clients.
+// Pending messages loaded per query when a connection comes online.
+const pendingPageSize = 200
+
+// Hub maintains the set of active clients and routes events to them.
+// A user can be connected from several devices, so every user id maps to the set of its connections.
+// The connections are partitioned by user id into shards, each running its own goroutine, which only
+// touch memory. Everything that needs the database or the network runs on the pipeline workers
+// and hands its events to the shards of their users.
 type Hub struct {
-	clients     map[int64]*Client
-	register    chan *Client
-	unregister  chan *Client
-	broadcast   chan *Message
+	shards     []*hubShard
+	dispatcher *Dispatcher
+	pipeline   *Pipeline
+
+	// sendQueueSize is the capacity of every connection's sendTo channel
+	sendQueueSize int
+
+	// typing indicators are only relayed, never stored, their state belongs to the typing goroutine
+	typing        chan *Typing
+	typingExpired chan *typingState
+	typingStates  map[typingKey]*typingState
+
+	// broker carries events to the users connected to other nodes, the outbox feeds it.
+	// registry tells which nodes hold a user.
+	nodeId   string
+	broker   Broker
+	registry Registry
+	outbox   chan *BrokerEnvelope
+
+	presence    *Presence
 	chatHandler *handlers.ChatHandler
 	store       db.Store
 }
 
+// HubOptions tunes a hub, zero values select the defaults.
+type HubOptions struct {
+	// NodeId names the node in the cluster.
+	NodeId string
+	// Workers is the size of the pipeline running the database work.
+	Workers int
+	// Shards is how many goroutines own the connections, one per CPU by default.
+	Shards int
+	// SendQueueSize is how many events a connection can have waiting for its writePump.
+	SendQueueSize int
+	// OverflowPolicy handles events for connections whose send queue is full.
+	OverflowPolicy OverflowPolicy
+}
+
+const (
+	// brokerPublishTimeout bounds how long the outbox waits on the broker for one publication.
+	brokerPublishTimeout = 2 * time.Second
+
+	// Envelopes waiting to be published to other nodes before routing blocks.
+	outboxSize = 1024
+)
+
 // NewHub initializes and returns a new Hub instance.
-func NewHub(chatHandler *handlers.ChatHandler, store db.Store) *Hub {
-	return &Hub{
-		broadcast:   make(chan *Message),
-		register:    make(chan *Client),
-		unregister:  make(chan *Client),
-		clients:     make(map[int64]*Client),
-		chatHandler: chatHandler,
+func NewHub(chatHandler *handlers.ChatHandler, store db.Store, presence *Presence, broker Broker, registry Registry, opts HubOptions) *Hub {
+	shards := opts.Shards
+	if shards <= 0 {
+		shards = runtime.NumCPU()
+	}
+	sendQueueSize := opts.SendQueueSize
+	if sendQueueSize <= 0 {
+		sendQueueSize = defaultSendQueueSize
+	}
+	policy := opts.OverflowPolicy
+	if policy == "" {
+		policy = OverflowDisconnect
+	}
+	h := &Hub{
+		shards:        make([]*hubShard, shards),
+		sendQueueSize: sendQueueSize,
+		typing:        make(chan *Typing),
+		typingExpired: make(chan *typingState),
+		typingStates:  make(map[typingKey]*typingState),
+		dispatcher:    NewDispatcher(),
+		pipeline:      NewPipeline(opts.Workers),
+		nodeId:        opts.NodeId,
+		broker:        broker,
+		registry:      registry,
+		outbox:        make(chan *BrokerEnvelope, outboxSize),
+		presence:      presence,
+		chatHandler:   chatHandler,
 
 		store: store,
 	}
+	for i := range h.shards {
+		h.shards[i] = newHubShard(i, policy)
+	}
+	h.registerEventHandlers()
+	return h
 }
 
-// Run handles the registration, unregistration, and message broadcasting to clients.
+// Run starts the shards and the goroutines around them, it returns when ctx is done.
 func (h *Hub) Run(ctx context.Context) {
-	for {
-		select {
-		case client := <-h.register:
-			h.HandleUserRegisterEvent(client, ctx)
+	// routes left behind by an earlier run under the same node id are stale
+	if _, err := h.registry.RemoveNode(ctx, h.nodeId); err != nil {
+		log.Printf("Unable to clear stale routes of node %s: %v\n", h.nodeId, err)
+	}
+	if _, err := h.registry.Heartbeat(ctx, h.nodeId); err != nil {
+		log.Printf("Unable to join node %s to the registry: %v\n", h.nodeId, err)
+	}
+	go h.keepLease(ctx)
+	go h.runOutbox(ctx)
+	h.pipeline.Run(ctx)
 
-		case client := <-h.unregister:
-			h.HandleUserDisconnectEvent(client)
+	for _, shard := range h.shards {
+		go shard.run()
+	}
+	go h.runTyping(ctx)
 
-		case message := <-h.broadcast:
-			h.HandleMessageBroadcast(message, ctx)
+	err := h.broker.Subscribe(ctx, h.nodeId, h.deliverLocal)
+	if err != nil {
+		log.Printf("Unable to subscribe node %s to the broker, only local users are reachable: %v\n", h.nodeId, err)
+	}
+	<-ctx.Done()
+}
+
+// shardFor returns the shard owning the user's connections.
+func (h *Hub) shardFor(userId int64) *hubShard {
+	return h.shards[uint64(userId)%uint64(len(h.shards))]
+}
+
+// clientConnected runs on the pipeline once the connection is registered with its shard.
+// The user only comes online with their first connection in the whole cluster.
+func (h *Hub) clientConnected(client *Client, ctx context.Context) {
+	if h.presence.Connect(client.userId) {
+		elsewhere := h.connectedElsewhere(client.userId, ctx)
+		if err := h.registry.Register(ctx, client.userId, h.nodeId); err != nil {
+			log.Printf("Unable to register client %d on node %s: %v\n", client.userId, h.nodeId, err)
+		}
+		if !elsewhere {
+			h.publishPresence(client.userId, true, ctx)
 		}
 	}
+
+	// resumed conversations are replayed first, their pending messages are then dropped as already written
+	if len(client.resume) > 0 {
+		h.resumeSession(client, ctx)
+		return
+	}
+	h.flushPendingMessages(client, 0, ctx)
 }
 
-// HandleUserRegisterEvent handles the user registration event.
-func (h *Hub) HandleUserRegisterEvent(client *Client, ctx context.Context) {
+// clientDisconnected runs on the pipeline once the connection stopped reading.
+// The user only goes offline when their last connection in the whole cluster is gone.
+func (h *Hub) clientDisconnected(client *Client, ctx context.Context) {
+	if !h.presence.Disconnect(client.userId) {
+		return
+	}
+	if err := h.registry.Unregister(ctx, client.userId, h.nodeId); err != nil {
+		log.Printf("Unable to unregister client %d from node %s: %v\n", client.userId, h.nodeId, err)
+	}
+	if !h.connectedElsewhere(client.userId, ctx) {
+		h.publishPresence(client.userId, false, ctx)
+	}
+}
+
+// flushPendingMessages loads a page of the messages stored while the user was offline, oldest first from afterId,
+// into the connection's backlog. The next page is loaded once the writePump wrote this one, and the messages are
+// marked delivered then.
+func (h *Hub) flushPendingMessages(client *Client, afterId int64, ctx context.Context) {
+	pending, err := h.chatHandler.PendingMessages(ctx, client.userId, afterId, pendingPageSize)
+	if err != nil {
+		log.Printf("Unable to fetch pending messages for client %d after %d: %v\n", client.userId, afterId, err)
+		return
+	}
+	if len(pending) == 0 {
+		return
+	}
 
-	h.clients[client.userId] = client
-	// Log client registration
-	fmt.Printf("Registered client: %d\n", client.userId)
+	events := make([]*types.SocketEventStruct, len(pending))
+	for i, message := range h.messagesFromRows(pending, ctx) {
+		events[i] = newSocketEvent(EventMessageNew, message)
+	}
+	log.Printf("Flushing %d pending messages to client: %d\n", len(pending), client.userId)
+	if len(pending) < pendingPageSize {
+		client.stored.push(events, nil)
+		return
+	}
+	afterId = pending[len(pending)-1].ID
+	client.stored.push(events, func(ctx context.Context) {
+		h.flushPendingMessages(client, afterId, ctx)
+	})
 }
 
-// HandleUserDisconnectEvent handles the user disconnection event.
-func (h *Hub) HandleUserDisconnectEvent(client *Client) {
-	if _, ok := h.clients[client.userId]; ok {
-		delete(h.clients, client.userId)
-		close(client.sendTo)
-		// Log client unregistration
-		log.Printf("Unregistered client: %d\n", client.userId)
+// markDelivered records the delivery of messages written to a connection of the user and
+// relays a delivered receipt to the authors of those delivered for the first time.
+func (h *Hub) markDelivered(userId int64, messages []*Message, ctx context.Context) {
+	messageIds := make([]int64, len(messages))
+	for i, message := range messages {
+		messageIds[i] = message.Id
+	}
+	delivered, err := h.chatHandler.MarkDelivered(ctx, userId, messageIds)
+	if err != nil {
+		log.Printf("Unable to mark %d messages delivered to %d: %v\n", len(messageIds), userId, err)
+		return
+	}
+
+	now := time.Now()
+	for _, message := range messages {
+		if !slices.Contains(delivered, message.Id) {
+			continue
+		}
+		h.publishToUsers([]int64{message.From}, newSocketEvent(EventReceipt, &Receipt{
+			Status:         ReceiptDelivered,
+			MessageId:      message.Id,
+			ConversationId: message.ConversationId,
+			UserId:         userId,
+			At:             now,
+			senderId:       message.From,
+		}), nil)
 	}
 }
 
-// HandleMessageBroadcast handles the message broadcasting.
+// HandleMessageBroadcast validates and stores a message and fans it out to every member of its conversation.
+// It runs on the pipeline worker of the message's conversation, so messages of a conversation keep their order.
 func (h *Hub) HandleMessageBroadcast(message *Message, ctx context.Context) {
 
+	senderClient := message.sender
 	_, err := h.store.GetUserById(ctx, int64(message.From))
 	if err != nil {
 		log.Println("From userId is not available in Database Please Register")
+		h.replyError(senderClient, &SocketError{Code: ErrorCodeUserNotFound, Message: "Sender is not registered"}, message.eventId)
+		return
+	}
+	if message.ConversationId == 0 {
+		_, err = h.store.GetUserById(ctx, int64(message.To))
+		if err != nil {
+			log.Println("To userId is not available in Database Please Register")
+			h.replyError(senderClient, &SocketError{Code: ErrorCodeUserNotFound, Message: "Recipient is not registered"}, message.eventId)
+			return
+		}
+	}
+
+	conversation, err := h.chatHandler.ResolveConversation(ctx, message.From, message.To, message.ConversationId)
+	if err != nil {
+		log.Printf("Unable to resolve conversation for message from %d: %v\n", message.From, err)
+		if errors.Is(err, handlers.ErrSelfConversation) {
+			h.replyError(senderClient, &SocketError{Code: ErrorCodeInvalidPayload, Message: "Cannot send a direct message to yourself"}, message.eventId)
+		} else {
+			h.replyError(senderClient, &SocketError{Code: ErrorCodeConversationNotFound, Message: "Conversation not found or you are not a member"}, message.eventId)
+		}
+		return
+	}
+	message.ConversationId = conversation.ID
+
+	memberIds, err := h.store.ListConversationMemberIds(ctx, conversation.ID)
+	if err != nil {
+		log.Printf("Unable to fetch members of conversation %d: %v\n", conversation.ID, err)
+		h.replyError(senderClient, &SocketError{Code: ErrorCodeServerError, Message: "Unable to fetch conversation members"}, message.eventId)
+		return
+	}
+	if conversation.IsGroup {
+		message.To = 0
+	} else if message.To == 0 {
+		for _, memberId := range memberIds {
+			if memberId != message.From {
+				message.To = memberId
+			}
+		}
+	}
+
+	//Insert into the Databsae, recipients that are offline keep it pending until they reconnect
+	row, duplicate, err := h.chatHandler.InsertMessage(ctx, handlers.NewMessage{
+		From:           message.From,
+		To:             message.To,
+		ConversationId: message.ConversationId,
+		Content:        message.Content,
+		ClientId:       message.ClientId,
+		ReplyTo:        message.ReplyTo,
+		AttachmentIds:  message.AttachmentIds,
+	})
+	if errors.Is(err, handlers.ErrInvalidReply) {
+		h.replyError(senderClient, &SocketError{Code: ErrorCodeInvalidReply, Message: "Replies must quote a message of the same conversation"}, message.eventId)
+		return
+	}
+	if errors.Is(err, handlers.ErrInvalidAttachment) {
+		h.replyError(senderClient, &SocketError{Code: ErrorCodeInvalidAttachment, Message: "Attachments must be your own uploads, not sent with another message"}, message.eventId)
+		return
+	}
+	if err != nil {
+		log.Printf("Unable to insert message from %d: %v\n", message.From, err)
+		h.replyError(senderClient, &SocketError{Code: ErrorCodePersistFailed, Message: "Unable to store the message, please retry"}, message.eventId)
+		return
+
+	}
+	message.Id = row.ID
+	message.Seq = row.Seq
+	message.CreatedAt = row.CreatedAt.Time
+
+	h.reply(senderClient, newSocketEvent(EventMessageAck, &MessageAck{
+		Id:             row.ID,
+		ClientId:       message.ClientId,
+		ConversationId: row.ConversationID,
+		Seq:            row.Seq,
+		CreatedAt:      row.CreatedAt.Time,
+		Duplicate:      duplicate,
+	}))
+	if duplicate {
+		// members already got it, or have it pending, from the first attempt
+		return
+	}
+	if len(message.AttachmentIds) > 0 {
+		// the event describes the files instead of repeating their ids
+		message.Attachments = h.messagesFromRows([]db.Message{row}, ctx)[0].Attachments
+		message.AttachmentIds = nil
+	}
+	// the sender's other devices get an echo so the conversation stays in sync everywhere
+	h.publishToConversation(message.ConversationId, memberIds, newSocketEvent(EventMessageNew, message), senderClient)
+}
+
+// HandleReadEvent stores that the user read a conversation up to a message and tells the authors.
+// It runs on the pipeline worker of the conversation.
+func (h *Hub) HandleReadEvent(read *Receipt, ctx context.Context) {
+	newestBySender, err := h.chatHandler.MarkRead(ctx, read.UserId, read.ConversationId, read.MessageId)
+	if err != nil {
+		log.Printf("Unable to mark conversation %d read for %d: %v\n", read.ConversationId, read.UserId, err)
+		return
+	}
+
+	now := time.Now()
+	for senderId, messageId := range newestBySender {
+		h.publishToUsers([]int64{senderId}, newSocketEvent(EventReceipt, &Receipt{
+			Status:         ReceiptRead,
+			MessageId:      messageId,
+			ConversationId: read.ConversationId,
+			UserId:         read.UserId,
+			At:             now,
+		}), nil)
+	}
+}
+
+// HandleMessageEdit applies an edit sent by the author over the socket and pushes it to the conversation.
+func (h *Hub) HandleMessageEdit(client *Client, change *MessageChange, eventId string, ctx context.Context) {
+	row, err := h.chatHandler.EditMessage(ctx, client.userId, change.Id, change.Content)
+	if err != nil {
+		log.Printf("Unable to edit message %d for %d: %v\n", change.Id, client.userId, err)
+		h.replyError(client, messageChangeError(err), eventId)
+		return
+	}
+	h.publishMessageChange(EventMessageEdited, row, ctx)
+}
+
+// HandleMessageDelete deletes a message for its author and pushes the tombstone to the conversation.
+func (h *Hub) HandleMessageDelete(client *Client, change *MessageChange, eventId string, ctx context.Context) {
+	row, err := h.chatHandler.DeleteMessage(ctx, client.userId, change.Id)
+	if err != nil {
+		log.Printf("Unable to delete message %d for %d: %v\n", change.Id, client.userId, err)
+		h.replyError(client, messageChangeError(err), eventId)
+		return
+	}
+	h.publishMessageChange(EventMessageDeleted, row, ctx)
+}
+
+// MessageEdited pushes a message edited through the REST API, see handlers.MessageNotifier.
+func (h *Hub) MessageEdited(message db.Message) {
+	h.pipeline.Submit(messageKey(message.ID), func(ctx context.Context) {
+		h.publishMessageChange(EventMessageEdited, message, ctx)
+	})
+}
+
+// MessageDeleted pushes a message deleted through the REST API, see handlers.MessageNotifier.
+func (h *Hub) MessageDeleted(message db.Message) {
+	h.pipeline.Submit(messageKey(message.ID), func(ctx context.Context) {
+		h.publishMessageChange(EventMessageDeleted, message, ctx)
+	})
+}
+
+// publishMessageChange sends the changed message to every connection of the conversation's members,
+// the author's included, which confirms the change to them.
+func (h *Hub) publishMessageChange(eventName string, row db.Message, ctx context.Context) {
+	memberIds, err := h.store.ListConversationMemberIds(ctx, row.ConversationID)
+	if err != nil {
+		log.Printf("Unable to fetch members of conversation %d: %v\n", row.ConversationID, err)
 		return
 	}
-	senderClient := h.clients[int64(message.From)]
-	_, err = h.store.GetUserById(ctx, int64(message.To))
+	h.publishToConversation(row.ConversationID, memberIds, newSocketEvent(eventName, h.messagesFromRows([]db.Message{row}, ctx)[0]), nil)
+}
+
+// messagesFromRows converts stored messages into their wire representation with their attachments.
+// When the attachments cannot be loaded the messages go out without them.
+func (h *Hub) messagesFromRows(rows []db.Message, ctx context.Context) []*Message {
+	messages := make([]*Message, len(rows))
+	messageIds := make([]int64, 0, len(rows))
+	for i, row := range rows {
+		messages[i] = newMessageFromRow(row)
+		if !messages[i].Deleted {
+			messageIds = append(messageIds, row.ID)
+		}
+	}
+	if len(messageIds) == 0 {
+		return messages
+	}
+	attachments, err := h.chatHandler.Attachments(ctx, messageIds)
+	if err != nil {
+		log.Printf("Unable to fetch attachments of %d messages: %v\n", len(messageIds), err)
+		return messages
+	}
+	for _, message := range messages {
+		message.Attachments = attachments[message.Id]
+	}
+	return messages
+}
+
+// route delivers an envelope created on this node to the users connected here and then,
+// through the outbox, to the other nodes.
+func (h *Hub) route(envelope *BrokerEnvelope) {
+	h.deliverLocal(envelope)
+	h.outbox <- envelope
+}
+
+// deliverLocal hands every shard the part of the envelope addressed to its users.
+func (h *Hub) deliverLocal(envelope *BrokerEnvelope) {
+	if len(h.shards) == 1 {
+		h.shards[0].deliveries <- envelope
+		return
+	}
+	byShard := make(map[*hubShard][]int64)
+	for _, userId := range envelope.UserIds {
+		shard := h.shardFor(userId)
+		byShard[shard] = append(byShard[shard], userId)
+	}
+	for shard, userIds := range byShard {
+		shardEnvelope := *envelope
+		shardEnvelope.UserIds = userIds
+		shard.deliveries <- &shardEnvelope
+	}
+}
+
+// handleOrphanedUsers publishes that the users of a crashed node went offline, unless they are connected elsewhere.
+func (h *Hub) handleOrphanedUsers(userIds []int64) {
+	for _, userId := range userIds {
+		userId := userId
+		h.pipeline.Submit(userKey(userId), func(ctx context.Context) {
+			if h.presence.IsOnline(userId) || h.connectedElsewhere(userId, ctx) {
+				return
+			}
+			h.publishPresence(userId, false, ctx)
+		})
+	}
+}
+
+// registerLocalUsers registers the users connected here again after the node lost its lease.
+// Another node may have removed this one meanwhile and told the users' peers that they went offline.
+func (h *Hub) registerLocalUsers() {
+	userIds := h.presence.ConnectedUsers()
+	log.Printf("Lease of node %s lapsed, registering its %d users again\n", h.nodeId, len(userIds))
+	for _, userId := range userIds {
+		userId := userId
+		h.pipeline.Submit(userKey(userId), func(ctx context.Context) {
+			// the user may have left while the lease was renewed
+			if !h.presence.IsOnline(userId) {
+				return
+			}
+			if err := h.registry.Register(ctx, userId, h.nodeId); err != nil {
+				log.Printf("Unable to register client %d on node %s: %v\n", userId, h.nodeId, err)
+				return
+			}
+			h.publishPresence(userId, true, ctx)
+		})
+	}
+}
+
+// keepLease renews the node's lease and cleans up after crashed nodes until ctx is done.
+// It runs on its own goroutine so a busy hub never loses its lease.
+func (h *Hub) keepLease(ctx context.Context) {
+	ticker := time.NewTicker(nodeHeartbeatPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.renewLease(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// renewLease sends the node's heartbeat and removes crashed nodes.
+// When the lease had lapsed another node may have removed this one, so its users are registered again.
+func (h *Hub) renewLease(ctx context.Context) {
+	lapsed, err := h.registry.Heartbeat(ctx, h.nodeId)
 	if err != nil {
-		log.Println("To userId is not available in Database Please Register")
+		log.Printf("Unable to renew the lease of node %s: %v\n", h.nodeId, err)
 		return
 	}
-	//Insert into the Databsae
-	err = h.chatHandler.InsertMessage(ctx, message.From, message.To, message.Content)
+	if lapsed {
+		h.registerLocalUsers()
+	}
+	h.removeExpiredNodes(ctx)
+}
+
+func (h *Hub) removeExpiredNodes(ctx context.Context) {
+	expired, err := h.registry.ExpiredNodes(ctx)
 	if err != nil {
-		senderClient.SendError("Unable to Insert Messaages In the Database")
+		log.Printf("Unable to list expired nodes: %v\n", err)
 		return
+	}
+	for _, nodeId := range expired {
+		userIds, err := h.registry.RemoveNode(ctx, nodeId)
+		if err != nil {
+			log.Printf("Unable to remove expired node %s: %v\n", nodeId, err)
+			continue
+		}
+		if len(userIds) == 0 {
+			continue
+		}
+		log.Printf("Removed expired node %s holding %d users\n", nodeId, len(userIds))
+		h.handleOrphanedUsers(userIds)
+	}
+}
+
+// connectedElsewhere reports whether the user has connections on another node.
+func (h *Hub) connectedElsewhere(userId int64, ctx context.Context) bool {
+	routes, err := h.registry.Lookup(ctx, []int64{userId})
+	if err != nil {
+		log.Printf("Unable to look up the nodes of %d: %v\n", userId, err)
+		return false
+	}
+	for _, nodeId := range routes[userId] {
+		if nodeId != h.nodeId {
+			return true
+		}
+	}
+	return false
+}
 
+// publishToUsers delivers an event to the users' connections, on this node and on the others.
+// The excluded connection, usually the one the event came from, is skipped wherever it lives.
+// It must not be called from a shard goroutine.
+func (h *Hub) publishToUsers(userIds []int64, event *types.SocketEventStruct, exclude *Client) {
+	h.route(h.newEnvelope(userIds, 0, event, exclude))
+}
+
+// publishToConversation is publishToUsers for the members of a conversation.
+func (h *Hub) publishToConversation(conversationId int64, memberIds []int64, event *types.SocketEventStruct, exclude *Client) {
+	h.route(h.newEnvelope(memberIds, conversationId, event, exclude))
+}
+
+func (h *Hub) newEnvelope(userIds []int64, conversationId int64, event *types.SocketEventStruct, exclude *Client) *BrokerEnvelope {
+	return &BrokerEnvelope{
+		NodeId:         h.nodeId,
+		UserIds:        userIds,
+		ConversationId: conversationId,
+		ExcludeClient:  exclude.connectionId(),
+		Event:          event,
 	}
-	client, ok := h.clients[message.To]
-	if ok {
+}
+
+// runOutbox publishes the envelopes delivered locally to the other nodes, in the order they were routed.
+func (h *Hub) runOutbox(ctx context.Context) {
+	for {
 		select {
-		case client.sendTo <- message:
-			log.Printf("Sent message to client: %d\n", message.To)
-		default:
-			// If the client's sendTo channel is blocked
-			close(client.sendTo)
-			delete(h.clients, client.userId)
-			log.Printf("Closed channel and removed client due to blocked sendTo: %d\n", message.To)
-		}
-	} else {
-		//In this Section IT should Publish to the redis CLient of
-		log.Printf("Attempted to send message to non-existent client: %d\n", message.To)
+		case envelope := <-h.outbox:
+			h.publish(envelope)
+		case <-ctx.Done():
+			return
+		}
 	}
 }
+
+// publish sends the envelope only to the nodes that hold one of its users, each with just their users.
+// When the registry cannot be read it falls back to broadcasting to every node.
+func (h *Hub) publish(envelope *BrokerEnvelope) {
+	ctx, cancel := context.WithTimeout(context.Background(), brokerPublishTimeout)
+	defer cancel()
+
+	routes, err := h.registry.Lookup(ctx, envelope.UserIds)
+	if err != nil {
+		log.Printf("Unable to look up nodes for %s, broadcasting to every node: %v\n", envelope.Event.EventName, err)
+		if envelope.ConversationId != 0 {
+			err = h.broker.PublishToConversation(ctx, envelope)
+		} else {
+			err = h.broker.PublishToUser(ctx, envelope)
+		}
+		if err != nil {
+			log.Printf("Unable to publish %s to other nodes: %v\n", envelope.Event.EventName, err)
+		}
+		return
+	}
+
+	byNode := make(map[string][]int64)
+	for _, userId := range envelope.UserIds {
+		for _, nodeId := range routes[userId] {
+			if nodeId != h.nodeId {
+				byNode[nodeId] = append(byNode[nodeId], userId)
+			}
+		}
+	}
+	for nodeId, userIds := range byNode {
+		nodeEnvelope := *envelope
+		nodeEnvelope.UserIds = userIds
+		if err := h.broker.PublishToNode(ctx, nodeId, &nodeEnvelope); err != nil {
+			log.Printf("Unable to publish %s to node %s: %v\n", envelope.Event.EventName, nodeId, err)
+		}
+	}
+}
+
+// reply hands an event for a single connection to its shard, it is nil-safe for events without a sender.
+// It must not be called from a shard goroutine.
+func (h *Hub) reply(client *Client, event *types.SocketEventStruct) {
+	if client == nil {
+		return
+	}
+	h.shardFor(client.userId).replies <- &clientEvent{client: client, event: event}
+}
+
+// replyError answers a connection with an error event from a pipeline worker.
+func (h *Hub) replyError(client *Client, err error, eventId string) {
+	h.reply(client, newErrorEvent(err, eventId))
+}
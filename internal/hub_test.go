@@ -0,0 +1,379 @@
+package internal
+
+import (
+	"context"
+	"sync"
+	"tarun-kavipurapu/test-go-chat/db/dbtest"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/internal/handlers"
+	"tarun-kavipurapu/test-go-chat/types"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// newTestHub returns a hub on the fake connection, its loop is not started.
+func newTestHub(conn *dbtest.Conn) *Hub {
+	store := dbtest.NewStore(conn)
+	return NewHub(handlers.NewChatHandler(store), store, NewPresence(), NewMemoryBroker(), NewMemoryRegistry(), HubOptions{NodeId: "node"})
+}
+
+// newTestClient returns a connection of the user that is not backed by a socket.
+func newTestClient(hub *Hub, userId int64) *Client {
+	return &Client{
+		id:     uuid.NewString(),
+		hub:    hub,
+		userId: userId,
+		sendTo: make(chan *types.SocketEventStruct, hub.sendQueueSize),
+
+		addressKeys: make(map[int64]string),
+		recent:      newMessageWindow(dedupeWindowSize),
+		stored:      newBacklog(),
+	}
+}
+
+// startTestHub returns a hub whose shards, pipeline and outbox run until the test ends.
+func startTestHub(t testing.TB, conn *dbtest.Conn) *Hub {
+	return runTestHub(t, newTestHub(conn))
+}
+
+// startNodeTestHub is startTestHub for a node of a cluster sharing the broker and registry.
+func startNodeTestHub(t testing.TB, conn *dbtest.Conn, nodeId string, broker Broker, registry Registry) *Hub {
+	store := dbtest.NewStore(conn)
+	return runTestHub(t, NewHub(handlers.NewChatHandler(store), store, NewPresence(), broker, registry, HubOptions{NodeId: nodeId}))
+}
+
+func runTestHub(t testing.TB, hub *Hub) *Hub {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go hub.Run(ctx)
+	return hub
+}
+
+// connectTestClient registers a connection of the user with its shard, without loading anything for it.
+// The shards only take registrations once the hub joined the cluster.
+func connectTestClient(hub *Hub, userId int64) *Client {
+	client := newTestClient(hub, userId)
+	hub.shardFor(userId).register <- client
+	return client
+}
+
+// nextEvent waits for the next event queued for the connection.
+func nextEvent(t testing.TB, client *Client) *types.SocketEventStruct {
+	t.Helper()
+	select {
+	case event := <-client.sendTo:
+		client.dequeued()
+		return event
+	case <-time.After(time.Second):
+		t.Fatalf("no event for client of user %d", client.userId)
+		return nil
+	}
+}
+
+// storedMessages answers a paged message query with the messages after the cursor argument,
+// up to the limit argument, out of the numbers from 1 to count used as id and seq.
+func storedMessages(count int64, conversationId int64, from int64, cursorArg int, limitArg int) dbtest.QueryFunc {
+	return func(args []interface{}) ([][]interface{}, error) {
+		after := args[cursorArg].(int64)
+		limit := int64(args[limitArg].(int32))
+		var messages []db.Message
+		for id := after + 1; id <= count && id <= after+limit; id++ {
+			messages = append(messages, db.Message{ID: id, Seq: id, ConversationID: conversationId, FromUserID: from})
+		}
+		return dbtest.Rows(messages...), nil
+	}
+}
+
+// newMessageEvent returns a message.new event of a stored message.
+func newMessageEvent(id int64, conversationId int64, seq int64) *types.SocketEventStruct {
+	return newSocketEvent(EventMessageNew, &Message{Id: id, ConversationId: conversationId, Seq: seq})
+}
+
+// messageIds returns the ids of the message.new events.
+func messageIds(events []*types.SocketEventStruct) []int64 {
+	var ids []int64
+	for _, event := range events {
+		if message, ok := event.EventPayload.(*Message); ok && event.EventName == EventMessageNew {
+			ids = append(ids, message.Id)
+		}
+	}
+	return ids
+}
+
+// writeBacklog stands in for the writePump of a connection without a socket: it takes the events in its backlog
+// and runs the jobs waiting for them, until the backlog stays empty.
+func writeBacklog(t testing.TB, client *Client) []*types.SocketEventStruct {
+	t.Helper()
+	var written []*types.SocketEventStruct
+	// the first events may still be loaded by the pipeline
+	wait := time.Second
+	for {
+		select {
+		case <-client.stored.ready:
+		case <-time.After(wait):
+			return written
+		}
+		wait = 50 * time.Millisecond
+		events, next := client.stored.take()
+		written = append(written, events...)
+		for _, job := range next {
+			job(context.Background())
+		}
+	}
+}
+
+func TestFlushPendingMessagesPages(t *testing.T) {
+	conn := dbtest.NewConn()
+	// the ListPendingMessages arguments are user_id, limit and after_id
+	conn.OnQuery("ListPendingMessages", storedMessages(450, 1, 2, 2, 1))
+	hub := newTestHub(conn)
+	client := newTestClient(hub, 1)
+
+	hub.flushPendingMessages(client, 0, context.Background())
+	// the next page waits for the first one to be written
+	events, next := client.stored.take()
+	if len(events) != pendingPageSize || len(next) != 1 || len(conn.Calls("ListPendingMessages")) != 1 {
+		t.Fatalf("%d events and %d jobs in the backlog after the first page", len(events), len(next))
+	}
+	next[0](context.Background())
+	flushed := append(messageIds(events), messageIds(writeBacklog(t, client))...)
+
+	if len(flushed) != 450 {
+		t.Fatalf("%d messages flushed, want 450", len(flushed))
+	}
+	for i, id := range flushed {
+		if id != int64(i+1) {
+			t.Fatalf("message %d flushed at position %d", id, i)
+		}
+	}
+	pages := conn.Calls("ListPendingMessages")
+	if len(pages) != 3 {
+		t.Fatalf("%d pages loaded, want 3", len(pages))
+	}
+	if after := pages[2][2].(int64); after != 2*pendingPageSize {
+		t.Fatalf("last page loaded after %d, want %d", after, 2*pendingPageSize)
+	}
+}
+
+func TestHandleReadEventNotifiesEachAuthor(t *testing.T) {
+	conn := dbtest.NewConn()
+	conn.OnQuery("MarkConversationRead", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(
+			db.MarkConversationReadRow{MessageID: 10, FromUserID: 2},
+			db.MarkConversationReadRow{MessageID: 11, FromUserID: 2},
+			db.MarkConversationReadRow{MessageID: 12, FromUserID: 3},
+		), nil
+	})
+	hub := startTestHub(t, conn)
+	alice, bob := connectTestClient(hub, 2), connectTestClient(hub, 3)
+
+	hub.HandleReadEvent(&Receipt{Status: ReceiptRead, ConversationId: 5, MessageId: 12, UserId: 1}, context.Background())
+
+	for client, newest := range map[*Client]int64{alice: 11, bob: 12} {
+		receipt, ok := nextEvent(t, client).EventPayload.(*Receipt)
+		if !ok || receipt.Status != ReceiptRead || receipt.MessageId != newest || receipt.UserId != 1 || receipt.ConversationId != 5 {
+			t.Fatalf("user %d got %+v, want a read receipt up to %d", client.userId, receipt, newest)
+		}
+	}
+}
+
+// groupConn is a database holding users 1 to 3 as members of group 5. It stores messages like Postgres would,
+// numbering them and refusing a second insert with the same client id.
+func groupConn() *dbtest.Conn {
+	conn := dbtest.NewConn()
+	var mu sync.Mutex
+	var messages []db.Message
+	conn.OnQuery("GetUserById", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.User{ID: args[0].(int64)}), nil
+	})
+	conn.OnQuery("GetConversationById", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.Conversation{ID: args[0].(int64), IsGroup: true}), nil
+	})
+	conn.OnQuery("GetConversationMember", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.ConversationMember{ConversationID: args[0].(int64), UserID: args[1].(int64)}), nil
+	})
+	conn.OnQuery("ListConversationMemberIds", func(args []interface{}) ([][]interface{}, error) {
+		return [][]interface{}{{int64(1)}, {int64(2)}, {int64(3)}}, nil
+	})
+	conn.OnQuery("NextConversationSeq", func(args []interface{}) ([][]interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return [][]interface{}{{int64(len(messages) + 1)}}, nil
+	})
+	conn.OnQuery("InsertMessage", func(args []interface{}) ([][]interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		message := db.Message{
+			ID:             int64(len(messages) + 1),
+			FromUserID:     args[0].(int64),
+			ConversationID: args[2].(int64),
+			Content:        args[4].(string),
+			ClientID:       args[5].(pgtype.Text),
+			Seq:            args[6].(int64),
+			CreatedAt:      pgtype.Timestamptz{Time: time.Now(), Valid: true},
+		}
+		for _, stored := range messages {
+			if message.ClientID.Valid && stored.FromUserID == message.FromUserID && stored.ClientID == message.ClientID {
+				return nil, nil
+			}
+		}
+		messages = append(messages, message)
+		return dbtest.Rows(message), nil
+	})
+	conn.OnQuery("GetMessageByClientId", func(args []interface{}) ([][]interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, stored := range messages {
+			if stored.FromUserID == args[0].(int64) && stored.ClientID == args[1].(pgtype.Text) {
+				return dbtest.Rows(stored), nil
+			}
+		}
+		return nil, nil
+	})
+	return conn
+}
+
+func TestMessageRetryIsAckedWithoutDeliveringTwice(t *testing.T) {
+	hub := startTestHub(t, groupConn())
+	sender, member := connectTestClient(hub, 1), connectTestClient(hub, 2)
+
+	for attempt := 0; attempt < 2; attempt++ {
+		hub.HandleMessageBroadcast(&Message{From: 1, ConversationId: 5, Content: "hi", ClientId: "abc", sender: sender}, context.Background())
+
+		ack, ok := nextEvent(t, sender).EventPayload.(*MessageAck)
+		if !ok || ack.Id != 1 || ack.ClientId != "abc" || ack.Duplicate != (attempt == 1) {
+			t.Fatalf("attempt %d acked with %+v", attempt, ack)
+		}
+	}
+
+	if message, ok := nextEvent(t, member).EventPayload.(*Message); !ok || message.Id != 1 {
+		t.Fatalf("member got %+v, want message 1", message)
+	}
+	select {
+	case event := <-member.sendTo:
+		t.Fatalf("member got %s %+v after message 1", event.EventName, event.EventPayload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestPublishReachesOnlyNodesHoldingRecipients(t *testing.T) {
+	broker, registry := NewMemoryBroker(), NewMemoryRegistry()
+	ctx := context.Background()
+	for _, nodeId := range []string{"a", "b", "c"} {
+		registry.Heartbeat(ctx, nodeId)
+	}
+	registry.Register(ctx, 2, "b")
+	registry.Register(ctx, 4, "c")
+	hub := startNodeTestHub(t, dbtest.NewConn(), "a", broker, registry)
+	receivedB := subscribeTestNode(t, broker, "b")
+	receivedC := subscribeTestNode(t, broker, "c")
+
+	hub.publishToUsers([]int64{1, 2, 3}, newSocketEvent(EventPong, nil), nil)
+
+	if envelope := expectEnvelope(t, receivedB); len(envelope.UserIds) != 1 || envelope.UserIds[0] != 2 || envelope.NodeId != "a" {
+		t.Fatalf("node b got users %v from node %s, want [2] from a", envelope.UserIds, envelope.NodeId)
+	}
+	expectNoEnvelope(t, receivedC)
+}
+
+func TestRemoveExpiredNodesPublishesOrphansOffline(t *testing.T) {
+	broker, registry := NewMemoryBroker(), NewMemoryRegistry()
+	ctx := context.Background()
+	registry.Heartbeat(ctx, "a")
+	registry.Heartbeat(ctx, "b")
+	// users 2 and 3 were on node b when it crashed, user 3 is also connected here
+	registry.Register(ctx, 2, "b")
+	registry.Register(ctx, 3, "b")
+	registry.mu.Lock()
+	registry.leases["b"] = time.Now()
+	registry.mu.Unlock()
+
+	conn := dbtest.NewConn()
+	conn.OnQuery("ListPeerIds", func(args []interface{}) ([][]interface{}, error) {
+		return [][]interface{}{{int64(1)}}, nil
+	})
+	hub := startNodeTestHub(t, conn, "a", broker, registry)
+	peer := connectTestClient(hub, 1)
+	hub.presence.Connect(3)
+
+	hub.removeExpiredNodes(ctx)
+
+	update, ok := nextEvent(t, peer).EventPayload.(*PresenceUpdate)
+	if !ok || update.UserId != 2 || update.Online || update.LastSeenAt == nil {
+		t.Fatalf("peer got %+v, want user 2 offline", update)
+	}
+	select {
+	case event := <-peer.sendTo:
+		t.Fatalf("peer got %s %+v after user 2 went offline", event.EventName, event.EventPayload)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if calls := conn.Calls("UpdateUserLastSeen"); len(calls) != 1 {
+		t.Fatalf("last seen stored %d times, want once", len(calls))
+	}
+	if expired, _ := registry.ExpiredNodes(ctx); len(expired) != 0 {
+		t.Fatalf("nodes %v still expired", expired)
+	}
+}
+
+func TestLapsedLeaseRegistersLocalUsersAgain(t *testing.T) {
+	broker, registry := NewMemoryBroker(), NewMemoryRegistry()
+	ctx := context.Background()
+	conn := dbtest.NewConn()
+	conn.OnQuery("ListPeerIds", func(args []interface{}) ([][]interface{}, error) {
+		if args[0].(int64) == 1 {
+			return [][]interface{}{{int64(2)}}, nil
+		}
+		return [][]interface{}{{int64(1)}}, nil
+	})
+	hub := startNodeTestHub(t, conn, "a", broker, registry)
+	client, peer := connectTestClient(hub, 1), connectTestClient(hub, 2)
+	for _, userId := range []int64{1, 2} {
+		hub.presence.Connect(userId)
+		registry.Register(ctx, userId, "a")
+	}
+
+	// the node misses its heartbeats and another node removes it
+	registry.mu.Lock()
+	registry.leases["a"] = time.Now()
+	registry.mu.Unlock()
+	if userIds, _ := registry.RemoveNode(ctx, "a"); len(userIds) != 2 {
+		t.Fatalf("removing the node returned users %v, want 1 and 2", userIds)
+	}
+
+	hub.renewLease(ctx)
+
+	// the peers hear that the users are online once they are registered again
+	for watcher, userId := range map[*Client]int64{peer: 1, client: 2} {
+		if update, ok := nextEvent(t, watcher).EventPayload.(*PresenceUpdate); !ok || update.UserId != userId || !update.Online {
+			t.Fatalf("user %d got %+v, want user %d online", watcher.userId, update, userId)
+		}
+	}
+	routes, err := registry.Lookup(ctx, []int64{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, userId := range []int64{1, 2} {
+		if len(routes[userId]) != 1 || routes[userId][0] != "a" {
+			t.Fatalf("user %d routed to %v, want [a]", userId, routes[userId])
+		}
+	}
+}
+
+func TestReplyToAnotherConversationIsRefused(t *testing.T) {
+	conn := groupConn()
+	conn.OnQuery("GetMessageById", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.Message{ID: args[0].(int64), ConversationID: 6}), nil
+	})
+	hub := startTestHub(t, conn)
+	sender, member := connectTestClient(hub, 1), connectTestClient(hub, 2)
+
+	hub.HandleMessageBroadcast(&Message{From: 1, ConversationId: 5, Content: "hi", ReplyTo: 3, sender: sender}, context.Background())
+	event := nextEvent(t, sender)
+	if payload, ok := event.EventPayload.(*types.SocketErrorPayload); !ok || payload.Code != ErrorCodeInvalidReply {
+		t.Fatalf("sender got %s %+v, want an invalid_reply error", event.EventName, event.EventPayload)
+	}
+	expectNoEvent(t, member)
+}
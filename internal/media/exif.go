@@ -0,0 +1,235 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const (
+	// EXIF tags read or cleared while stripping.
+	tagOrientation = 0x0112
+	tagGPSInfo     = 0x8825
+)
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	xmpHeader  = []byte("http://ns.adobe.com/xap/1.0/\x00")
+)
+
+// StripLocation removes the location an image carries in its metadata without re-encoding it.
+// The GPS entries of JPEG EXIF data are blanked and XMP packets, which may repeat them, are dropped.
+// PNG and WebP lose their EXIF and XMP chunks. It also returns the EXIF orientation, 1 when there is none.
+// Content it cannot parse is returned unchanged.
+func StripLocation(format string, data []byte) ([]byte, int) {
+	switch format {
+	case "jpeg":
+		return stripJPEG(data)
+	case "png":
+		return stripPNG(data), 1
+	case "webp":
+		return stripWebP(data), 1
+	default:
+		return data, 1
+	}
+}
+
+// stripJPEG walks the segments up to the image data, blanking the GPS entries of APP1 EXIF segments
+// in place and leaving out APP1 XMP segments.
+func stripJPEG(data []byte) ([]byte, int) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return data, 1
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+	orientation := 1
+	offset := 2
+	for offset+4 <= len(data) {
+		if data[offset] != 0xFF {
+			return data, 1
+		}
+		marker := data[offset+1]
+		// fill byte before a marker
+		if marker == 0xFF {
+			out = append(out, 0xFF)
+			offset++
+			continue
+		}
+		// markers without a length
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			out = append(out, data[offset:offset+2]...)
+			offset += 2
+			continue
+		}
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+		end := offset + 2 + length
+		if length < 2 || end > len(data) {
+			return data, 1
+		}
+		// start of scan, the rest is image data
+		if marker == 0xDA {
+			break
+		}
+		segment := data[offset:end]
+		if marker == 0xE1 {
+			payload := segment[4:]
+			if bytes.HasPrefix(payload, xmpHeader) {
+				offset = end
+				continue
+			}
+			if bytes.HasPrefix(payload, exifHeader) {
+				segment = append([]byte(nil), segment...)
+				orientation = stripTIFF(segment[4+len(exifHeader):])
+			}
+		}
+		out = append(out, segment...)
+		offset = end
+	}
+	return append(out, data[offset:]...), orientation
+}
+
+// stripTIFF blanks the GPS directory of the EXIF data in place and returns the orientation of the first image.
+func stripTIFF(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return 1
+	}
+
+	orientation := 1
+	ifd := int(order.Uint32(tiff[4:]))
+	entries, ok := ifdEntries(tiff, order, ifd)
+	if !ok {
+		return 1
+	}
+	for i := 0; i < entries; i++ {
+		entry := tiff[ifd+2+i*12:]
+		switch order.Uint16(entry) {
+		case tagOrientation:
+			if value := int(order.Uint16(entry[8:])); value >= 1 && value <= 8 {
+				orientation = value
+			}
+		case tagGPSInfo:
+			blankIFD(tiff, order, int(order.Uint32(entry[8:])))
+		}
+	}
+	return orientation
+}
+
+// ifdEntries returns the number of entries of the directory at offset when all of them are inside tiff.
+func ifdEntries(tiff []byte, order binary.ByteOrder, offset int) (int, bool) {
+	if offset < 8 || offset+2 > len(tiff) {
+		return 0, false
+	}
+	entries := int(order.Uint16(tiff[offset:]))
+	if offset+2+entries*12 > len(tiff) {
+		return 0, false
+	}
+	return entries, true
+}
+
+// blankIFD zeroes the values and entries of a directory and leaves it empty.
+func blankIFD(tiff []byte, order binary.ByteOrder, offset int) {
+	entries, ok := ifdEntries(tiff, order, offset)
+	if !ok {
+		return
+	}
+	for i := 0; i < entries; i++ {
+		entry := tiff[offset+2+i*12 : offset+2+(i+1)*12]
+		size := tiffTypeSize(order.Uint16(entry[2:])) * int(order.Uint32(entry[4:]))
+		// values longer than four bytes are stored elsewhere
+		if size > 4 {
+			if valueAt := int(order.Uint32(entry[8:])); valueAt >= 0 && size <= len(tiff) && valueAt <= len(tiff)-size {
+				clear(tiff[valueAt : valueAt+size])
+			}
+		}
+		clear(entry)
+	}
+	order.PutUint16(tiff[offset:], 0)
+}
+
+func tiffTypeSize(fieldType uint16) int {
+	switch fieldType {
+	case 1, 2, 6, 7: // BYTE, ASCII, SBYTE, UNDEFINED
+		return 1
+	case 3, 8: // SHORT, SSHORT
+		return 2
+	case 4, 9, 11: // LONG, SLONG, FLOAT
+		return 4
+	case 5, 10, 12: // RATIONAL, SRATIONAL, DOUBLE
+		return 8
+	default:
+		return 0
+	}
+}
+
+// stripPNG leaves out the eXIf chunk and the iTXt chunk holding XMP.
+func stripPNG(data []byte) []byte {
+	const signatureLength = 8
+	if len(data) < signatureLength || string(data[1:4]) != "PNG" {
+		return data
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:signatureLength]...)
+	offset := signatureLength
+	for offset+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+		end := offset + 12 + length
+		if length < 0 || end > len(data) {
+			return data
+		}
+		chunkType := string(data[offset+4 : offset+8])
+		content := data[offset+8 : offset+8+length]
+		drop := chunkType == "eXIf" || (chunkType == "iTXt" && bytes.HasPrefix(content, []byte("XML:com.adobe.xmp\x00")))
+		if !drop {
+			out = append(out, data[offset:end]...)
+		}
+		offset = end
+	}
+	return append(out, data[offset:]...)
+}
+
+// stripWebP leaves out the EXIF and XMP chunks and clears their flags in the VP8X header.
+func stripWebP(data []byte) []byte {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return data
+	}
+	const (
+		flagXMP  = 1 << 2
+		flagEXIF = 1 << 3
+	)
+	out := make([]byte, 12, len(data))
+	copy(out, data[:12])
+	offset := 12
+	for offset+8 <= len(data) {
+		length := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		end := offset + 8 + length + length%2
+		if length < 0 || end > len(data) {
+			return data
+		}
+		chunk := data[offset:end]
+		switch string(chunk[:4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk = append([]byte(nil), chunk...)
+			if len(chunk) > 8 {
+				chunk[8] &^= flagXMP | flagEXIF
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, chunk...)
+		}
+		offset = end
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out
+}
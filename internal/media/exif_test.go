@@ -0,0 +1,184 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// latitude is the GPS value written into the test images, stripping must leave none of it.
+var latitude = []uint32{48, 1, 51, 1, 2413, 100}
+
+// exifTIFF returns EXIF data in the byte order with the orientation and a GPS directory holding the latitude.
+func exifTIFF(order binary.ByteOrder, orientation uint16) []byte {
+	const ifd0, gpsIFD, values = 8, 38, 56
+	tiff := make([]byte, values+len(latitude)*4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], ifd0)
+
+	entry := func(at int, tag uint16, fieldType uint16, count uint32, value uint32) {
+		order.PutUint16(tiff[at:], tag)
+		order.PutUint16(tiff[at+2:], fieldType)
+		order.PutUint32(tiff[at+4:], count)
+		if fieldType == 3 {
+			order.PutUint16(tiff[at+8:], uint16(value))
+		} else {
+			order.PutUint32(tiff[at+8:], value)
+		}
+	}
+	order.PutUint16(tiff[ifd0:], 2)
+	entry(ifd0+2, tagOrientation, 3, 1, uint32(orientation))
+	entry(ifd0+14, tagGPSInfo, 4, 1, gpsIFD)
+	order.PutUint16(tiff[gpsIFD:], 1)
+	entry(gpsIFD+2, 0x0002, 5, 3, values) // GPSLatitude, three rationals
+	for i, value := range latitude {
+		order.PutUint32(tiff[values+i*4:], value)
+	}
+	return tiff
+}
+
+// testJPEG encodes a width by height image with an EXIF segment holding the TIFF data and an XMP segment.
+func testJPEG(t testing.TB, width int, height int, tiff []byte) []byte {
+	t.Helper()
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, width, height)), nil); err != nil {
+		t.Fatal(err)
+	}
+	segment := func(payload ...[]byte) []byte {
+		content := bytes.Join(payload, nil)
+		return append([]byte{0xFF, 0xE1, byte((len(content) + 2) >> 8), byte(len(content) + 2)}, content...)
+	}
+	data := append([]byte{}, encoded.Bytes()[:2]...)
+	data = append(data, segment(exifHeader, tiff)...)
+	data = append(data, segment(xmpHeader, []byte("<x:xmpmeta>GPSLatitude</x:xmpmeta>"))...)
+	return append(data, encoded.Bytes()[2:]...)
+}
+
+// containsLatitude looks for the latitude values in either byte order.
+func containsLatitude(data []byte) bool {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		values := make([]byte, len(latitude)*4)
+		for i, value := range latitude {
+			order.PutUint32(values[i*4:], value)
+		}
+		if bytes.Contains(data, values) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestStripLocationOfJPEG(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		data := testJPEG(t, 4, 2, exifTIFF(order, 6))
+		original := append([]byte(nil), data...)
+
+		stripped, orientation := StripLocation("jpeg", data)
+		if orientation != 6 {
+			t.Fatalf("%v: orientation %d, want 6", order, orientation)
+		}
+		if !containsLatitude(original) || containsLatitude(stripped) {
+			t.Fatalf("%v: the latitude was not removed", order)
+		}
+		if bytes.Contains(stripped, []byte("GPSLatitude")) {
+			t.Fatalf("%v: the XMP segment was kept", order)
+		}
+		if !bytes.Equal(data, original) {
+			t.Fatalf("%v: the upload was changed in place", order)
+		}
+		config, err := jpeg.DecodeConfig(bytes.NewReader(stripped))
+		if err != nil || config.Width != 4 || config.Height != 2 {
+			t.Fatalf("%v: stripped image decodes as %+v (%v)", order, config, err)
+		}
+	}
+}
+
+func TestStripLocationKeepsWhatItCannotParse(t *testing.T) {
+	truncated := testJPEG(t, 4, 2, exifTIFF(binary.LittleEndian, 3))[:30]
+	for format, data := range map[string][]byte{"jpeg": truncated, "png": []byte("\x89PNG\r\n\x1a\n\x00\x00"), "gif": []byte("GIF89a")} {
+		stripped, orientation := StripLocation(format, data)
+		if !bytes.Equal(stripped, data) || orientation != 1 {
+			t.Fatalf("%s changed to %q with orientation %d", format, stripped, orientation)
+		}
+	}
+}
+
+func pngChunk(chunkType string, content []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(content)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, content...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+func TestStripLocationOfPNG(t *testing.T) {
+	var encoded bytes.Buffer
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(1, 1, color.NRGBA{R: 255, A: 255})
+	if err := png.Encode(&encoded, img); err != nil {
+		t.Fatal(err)
+	}
+	// the metadata goes right after the IHDR chunk
+	const ihdrEnd = 8 + 12 + 13
+	data := append([]byte{}, encoded.Bytes()[:ihdrEnd]...)
+	data = append(data, pngChunk("eXIf", exifTIFF(binary.BigEndian, 1))...)
+	data = append(data, pngChunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00GPSLatitude"))...)
+	data = append(data, pngChunk("tEXt", []byte("Comment\x00kept"))...)
+	data = append(data, encoded.Bytes()[ihdrEnd:]...)
+
+	stripped, orientation := StripLocation("png", data)
+	if orientation != 1 || containsLatitude(stripped) || bytes.Contains(stripped, []byte("GPSLatitude")) {
+		t.Fatalf("png kept its location (orientation %d)", orientation)
+	}
+	if !bytes.Contains(stripped, []byte("Comment\x00kept")) {
+		t.Fatal("png lost a chunk without location")
+	}
+	decoded, err := png.Decode(bytes.NewReader(stripped))
+	if err != nil || decoded.Bounds() != img.Bounds() || decoded.At(1, 1) != img.At(1, 1) {
+		t.Fatalf("stripped png decodes as %v (%v)", decoded, err)
+	}
+}
+
+func webpChunk(chunkType string, content []byte) []byte {
+	chunk := append([]byte(chunkType), binary.LittleEndian.AppendUint32(nil, uint32(len(content)))...)
+	chunk = append(chunk, content...)
+	if len(content)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func TestStripLocationOfWebP(t *testing.T) {
+	const flagXMP, flagEXIF, flagAlpha = 1 << 2, 1 << 3, 1 << 4
+	vp8x := make([]byte, 10)
+	vp8x[0] = flagXMP | flagEXIF | flagAlpha
+	chunks := [][]byte{
+		webpChunk("VP8X", vp8x),
+		webpChunk("VP8L", []byte{0x2F, 1, 2, 3, 4}),
+		webpChunk("EXIF", exifTIFF(binary.LittleEndian, 1)),
+		webpChunk("XMP ", []byte("GPSLatitude")),
+	}
+	body := append([]byte("WEBP"), bytes.Join(chunks, nil)...)
+	data := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...)
+	data = append(data, body...)
+
+	stripped, _ := StripLocation("webp", data)
+	want := append([]byte("WEBP"), chunks[0]...)
+	want = append(want, chunks[1]...)
+	want[4+8] = flagAlpha
+	if !bytes.Equal(stripped[8:], want) {
+		t.Fatalf("stripped webp %q, want %q", stripped[8:], want)
+	}
+	if size := binary.LittleEndian.Uint32(stripped[4:]); int(size) != len(stripped)-8 {
+		t.Fatalf("RIFF size %d, want %d", size, len(stripped)-8)
+	}
+}
@@ -0,0 +1,228 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/png"
+	"io"
+	"log"
+	"runtime"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/internal/storage"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// Image uploads waiting for a worker, past it they are picked up on the next start.
+	processorQueueSize = 1024
+
+	// Larger images are stripped and measured but not decoded into thumbnails.
+	maxThumbnailPixels = 40_000_000
+)
+
+// Image types the processor decodes, other images are only marked processed.
+var decodedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Notifier is told when an attachment is processed, whatever the outcome.
+type Notifier interface {
+	AttachmentProcessed(attachment db.Attachment)
+}
+
+// Processor checks image uploads in the background. It makes sure the content decodes as the sniffed type,
+// strips the location from the metadata, stores thumbnails next to the upload and records the dimensions.
+type Processor struct {
+	store    db.Store
+	blobs    storage.BlobStore
+	notifier Notifier
+	workers  int
+	maxSize  int64
+	queue    chan int64
+}
+
+// NewProcessor returns a processor running workers images at once, half the CPUs when it is zero.
+// Uploads are at most maxSize bytes, a longer blob is rejected without being read whole.
+func NewProcessor(store db.Store, blobs storage.BlobStore, notifier Notifier, workers int, maxSize int64) *Processor {
+	if workers <= 0 {
+		workers = max(1, runtime.NumCPU()/2)
+	}
+	return &Processor{
+		store:    store,
+		blobs:    blobs,
+		notifier: notifier,
+		workers:  workers,
+		maxSize:  maxSize,
+		queue:    make(chan int64, processorQueueSize),
+	}
+}
+
+// Run starts the workers and queues the images an earlier run left unprocessed, the workers stop when ctx is done.
+func (p *Processor) Run(ctx context.Context) {
+	for i := 0; i < p.workers; i++ {
+		go func() {
+			for {
+				select {
+				case attachmentId := <-p.queue:
+					if err := p.process(ctx, attachmentId); err != nil {
+						log.Printf("Unable to process attachment %d: %v\n", attachmentId, err)
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		attachmentIds, err := p.store.ListUnprocessedImages(ctx)
+		if err != nil {
+			log.Println("Unable to list unprocessed images:", err)
+			return
+		}
+		for _, attachmentId := range attachmentIds {
+			select {
+			case p.queue <- attachmentId:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Enqueue hands an image upload to the workers without waiting, see handlers.MediaQueue.
+func (p *Processor) Enqueue(attachmentId int64) {
+	select {
+	case p.queue <- attachmentId:
+	default:
+		log.Printf("Media queue full, attachment %d is processed on the next start\n", attachmentId)
+	}
+}
+
+// process leaves the attachment unprocessed when the blob store or the database fails, so it is retried on the next start.
+func (p *Processor) process(ctx context.Context, attachmentId int64) error {
+	attachment, err := p.store.GetAttachmentById(ctx, attachmentId)
+	if err != nil {
+		return err
+	}
+	if attachment.ProcessedAt.Valid {
+		return nil
+	}
+	data, err := p.read(ctx, attachment.StorageKey)
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > p.maxSize {
+		return p.reject(ctx, attachment)
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if errors.Is(err, image.ErrFormat) && !decodedTypes[attachment.MimeType] {
+		// an image type without a decoder, kept as it is
+		return p.finish(ctx, attachment, data, nil)
+	}
+	if err != nil || "image/"+format != attachment.MimeType {
+		return p.reject(ctx, attachment)
+	}
+
+	stripped, orientation := StripLocation(format, data)
+	if !bytes.Equal(stripped, data) {
+		if err := p.blobs.Put(ctx, attachment.StorageKey, bytes.NewReader(stripped), int64(len(stripped)), attachment.MimeType); err != nil {
+			return err
+		}
+	}
+
+	size := image.Point{X: config.Width, Y: config.Height}
+	// the dimensions are the ones of the upright image
+	if orientation >= 5 {
+		size = image.Point{X: config.Height, Y: config.Width}
+	}
+	if config.Width*config.Height > maxThumbnailPixels {
+		return p.finish(ctx, attachment, stripped, &size)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(stripped))
+	if err != nil {
+		// the header was fine but the pixels are not
+		return p.reject(ctx, attachment)
+	}
+	for _, thumbnailSize := range ThumbnailSizes {
+		if max(config.Width, config.Height) <= thumbnailSize.MaxEdge {
+			continue
+		}
+		if err := p.storeThumbnail(ctx, attachment.ID, img, orientation, thumbnailSize); err != nil {
+			return err
+		}
+	}
+	return p.finish(ctx, attachment, stripped, &size)
+}
+
+func (p *Processor) read(ctx context.Context, key string) ([]byte, error) {
+	content, err := p.blobs.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	// one byte past the limit tells a blob that is too large
+	return io.ReadAll(io.LimitReader(content, p.maxSize+1))
+}
+
+func (p *Processor) storeThumbnail(ctx context.Context, attachmentId int64, img image.Image, orientation int, size ThumbnailSize) error {
+	thumbnail, dimensions, err := makeThumbnail(img, orientation, size.MaxEdge)
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("thumbnails/%d/%s.jpg", attachmentId, size.Name)
+	if err := p.blobs.Put(ctx, key, bytes.NewReader(thumbnail), int64(len(thumbnail)), "image/jpeg"); err != nil {
+		return err
+	}
+	return p.store.UpsertAttachmentThumbnail(ctx, db.UpsertAttachmentThumbnailParams{
+		AttachmentID: attachmentId,
+		Size:         size.Name,
+		StorageKey:   key,
+		Width:        int32(dimensions.X),
+		Height:       int32(dimensions.Y),
+	})
+}
+
+// finish records the final content of the attachment and its dimensions, when known.
+func (p *Processor) finish(ctx context.Context, attachment db.Attachment, data []byte, size *image.Point) error {
+	checksum := sha256.Sum256(data)
+	params := db.MarkAttachmentProcessedParams{
+		ID:        attachment.ID,
+		SizeBytes: int64(len(data)),
+		Checksum:  hex.EncodeToString(checksum[:]),
+	}
+	if size != nil {
+		params.Width = pgtype.Int4{Int32: int32(size.X), Valid: true}
+		params.Height = pgtype.Int4{Int32: int32(size.Y), Valid: true}
+	}
+	processed, err := p.store.MarkAttachmentProcessed(ctx, params)
+	if err != nil {
+		return err
+	}
+	p.notifier.AttachmentProcessed(processed)
+	return nil
+}
+
+// reject stops treating an upload that does not decode as an image.
+func (p *Processor) reject(ctx context.Context, attachment db.Attachment) error {
+	log.Printf("Attachment %d is not a valid %s\n", attachment.ID, attachment.MimeType)
+	processed, err := p.store.MarkAttachmentNotImage(ctx, attachment.ID)
+	if err != nil {
+		return err
+	}
+	p.notifier.AttachmentProcessed(processed)
+	return nil
+}
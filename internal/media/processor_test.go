@@ -0,0 +1,108 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"io"
+	"tarun-kavipurapu/test-go-chat/db/dbtest"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type memoryBlobs map[string][]byte
+
+func (m memoryBlobs) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	content, err := io.ReadAll(body)
+	m[key] = content
+	return err
+}
+
+func (m memoryBlobs) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	content, ok := m[key]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+func (m memoryBlobs) Delete(ctx context.Context, key string) error {
+	delete(m, key)
+	return nil
+}
+
+func (m memoryBlobs) SignedURL(ctx context.Context, key string, expiry time.Duration, download storage.Download) (string, error) {
+	return "", storage.ErrSignedURLUnsupported
+}
+
+type processedAttachments []db.Attachment
+
+func (p *processedAttachments) AttachmentProcessed(attachment db.Attachment) {
+	*p = append(*p, attachment)
+}
+
+// uploadConn is a database holding the unprocessed upload 1 of the type, stored under "upload".
+func uploadConn(mimeType string) *dbtest.Conn {
+	conn := dbtest.NewConn()
+	conn.OnQuery("GetAttachmentById", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.Attachment{ID: args[0].(int64), StorageKey: "upload", MimeType: mimeType}), nil
+	})
+	// the arguments are width, height, size_bytes, checksum and id
+	conn.OnQuery("MarkAttachmentProcessed", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.Attachment{ID: args[4].(int64), Width: args[0].(pgtype.Int4), Height: args[1].(pgtype.Int4), ProcessedAt: pgtype.Timestamptz{Time: time.Now(), Valid: true}}), nil
+	})
+	conn.OnQuery("MarkAttachmentNotImage", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.Attachment{ID: args[0].(int64), MimeType: "application/octet-stream"}), nil
+	})
+	return conn
+}
+
+func TestProcessorStripsAndMakesThumbnails(t *testing.T) {
+	conn := uploadConn("image/jpeg")
+	blobs := memoryBlobs{"upload": testJPEG(t, 400, 200, exifTIFF(binary.LittleEndian, 6))}
+	var processed processedAttachments
+	processor := NewProcessor(dbtest.NewStore(conn), blobs, &processed, 1, 1<<20)
+
+	if err := processor.process(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if containsLatitude(blobs["upload"]) {
+		t.Fatal("the stored upload kept its location")
+	}
+	// only the small thumbnail is smaller than the upload, it is upright
+	thumbnails := conn.Calls("UpsertAttachmentThumbnail")
+	if len(thumbnails) != 1 || thumbnails[0][1] != "small" || thumbnails[0][3] != int32(160) || thumbnails[0][4] != int32(320) {
+		t.Fatalf("thumbnails %v, want a small one of 160 by 320", thumbnails)
+	}
+	if _, ok := blobs[thumbnails[0][2].(string)]; !ok {
+		t.Fatalf("thumbnail %v not stored", thumbnails[0][2])
+	}
+	if len(processed) != 1 || processed[0].Width.Int32 != 200 || processed[0].Height.Int32 != 400 {
+		t.Fatalf("processed %+v, want an upright 200 by 400 image", processed)
+	}
+}
+
+func TestProcessorReadsUploadsUpToTheLimit(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, image.NewGray(image.Rect(0, 0, 64, 64))); err != nil {
+		t.Fatal(err)
+	}
+	for limit, rejected := range map[int64]bool{int64(encoded.Len()): false, int64(encoded.Len() - 1): true} {
+		conn := uploadConn("image/png")
+		var processed processedAttachments
+		processor := NewProcessor(dbtest.NewStore(conn), memoryBlobs{"upload": encoded.Bytes()}, &processed, 1, limit)
+
+		if err := processor.process(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		}
+		if got := len(conn.Calls("MarkAttachmentNotImage")) == 1; got != rejected || len(processed) != 1 {
+			t.Fatalf("limit %d: rejected %t, want %t", limit, got, rejected)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+)
+
+// Longest edge of a profile photo.
+const profilePhotoEdge = 512
+
+// ErrNotImage is returned for content that does not decode as a supported image or is too large to decode.
+var ErrNotImage = errors.New("not a supported image")
+
+// ProfilePhoto turns an uploaded image into the JPEG used as profile photo, upright, at most 512 pixels
+// on its longest edge and without any of the metadata of the upload.
+func ProfilePhoto(data []byte) ([]byte, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width*config.Height > maxThumbnailPixels {
+		return nil, ErrNotImage
+	}
+	_, orientation := StripLocation(format, data)
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrNotImage
+	}
+	edge := min(profilePhotoEdge, max(config.Width, config.Height))
+	photo, _, err := makeThumbnail(img, orientation, edge)
+	return photo, err
+}
@@ -0,0 +1,26 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/jpeg"
+	"testing"
+)
+
+func TestProfilePhotoIsUprightWithoutMetadata(t *testing.T) {
+	photo, err := ProfilePhoto(testJPEG(t, 4, 2, exifTIFF(binary.BigEndian, 6)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := jpeg.DecodeConfig(bytes.NewReader(photo))
+	if err != nil || config.Width != 2 || config.Height != 4 {
+		t.Fatalf("photo decodes as %+v (%v), want 2 by 4", config, err)
+	}
+	if containsLatitude(photo) || bytes.Contains(photo, exifHeader) {
+		t.Fatal("the photo kept the metadata of the upload")
+	}
+
+	if _, err := ProfilePhoto([]byte("not an image")); err != ErrNotImage {
+		t.Fatalf("err = %v, want ErrNotImage", err)
+	}
+}
@@ -0,0 +1,88 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// ThumbnailSize names a thumbnail and bounds its longest edge.
+type ThumbnailSize struct {
+	Name    string
+	MaxEdge int
+}
+
+// ThumbnailSizes are made for every image larger than them.
+var ThumbnailSizes = []ThumbnailSize{
+	{Name: "small", MaxEdge: 320},
+	{Name: "large", MaxEdge: 1280},
+}
+
+const thumbnailQuality = 80
+
+// makeThumbnail scales img so its longest edge is maxEdge, turns it upright and encodes it as a JPEG.
+// Transparent parts are flattened onto white.
+func makeThumbnail(img image.Image, orientation int, maxEdge int) ([]byte, image.Point, error) {
+	bounds := img.Bounds()
+	width, height := fit(bounds.Dx(), bounds.Dy(), maxEdge)
+
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(scaled, scaled.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	xdraw.CatmullRom.Scale(scaled, scaled.Bounds(), img, bounds, draw.Over, nil)
+	upright := orient(scaled, orientation)
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, upright, &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return nil, image.Point{}, err
+	}
+	return out.Bytes(), upright.Bounds().Size(), nil
+}
+
+// fit scales width and height down so the longer one is maxEdge.
+func fit(width int, height int, maxEdge int) (int, int) {
+	if width >= height {
+		return maxEdge, max(1, height*maxEdge/width)
+	}
+	return max(1, width*maxEdge/height), maxEdge
+}
+
+// orient applies an EXIF orientation, the transformation that turns the stored pixels upright.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dstWidth, dstHeight := w, h
+	// 5 to 8 turn the image by a quarter
+	if orientation >= 5 {
+		dstWidth, dstHeight = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored
+				sx, sy = w-1-x, y
+			case 3: // upside down
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirrored upside down
+				sx, sy = x, h-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // turned a quarter clockwise to be upright
+				sx, sy = y, h-1-x
+			case 7: // transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // turned a quarter counterclockwise to be upright
+				sx, sy = w-1-y, x
+			}
+			dst.SetRGBA(x, y, src.RGBAAt(sx, sy))
+		}
+	}
+	return dst
+}
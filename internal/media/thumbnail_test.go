@@ -0,0 +1,47 @@
+package media
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// corners is a 3 by 2 image with a different color in three of its corners.
+func corners() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.SetRGBA(0, 0, color.RGBA{R: 255, A: 255})
+	img.SetRGBA(2, 0, color.RGBA{G: 255, A: 255})
+	img.SetRGBA(0, 1, color.RGBA{B: 255, A: 255})
+	return img
+}
+
+func TestOrientTurnsImagesUpright(t *testing.T) {
+	red, green, blue := color.RGBA{R: 255, A: 255}, color.RGBA{G: 255, A: 255}, color.RGBA{B: 255, A: 255}
+	tests := []struct {
+		orientation int
+		size        image.Point
+		// where the red, green and blue corners end up
+		red, green, blue image.Point
+	}{
+		{1, image.Pt(3, 2), image.Pt(0, 0), image.Pt(2, 0), image.Pt(0, 1)},
+		{2, image.Pt(3, 2), image.Pt(2, 0), image.Pt(0, 0), image.Pt(2, 1)},
+		{3, image.Pt(3, 2), image.Pt(2, 1), image.Pt(0, 1), image.Pt(2, 0)},
+		{4, image.Pt(3, 2), image.Pt(0, 1), image.Pt(2, 1), image.Pt(0, 0)},
+		{5, image.Pt(2, 3), image.Pt(0, 0), image.Pt(0, 2), image.Pt(1, 0)},
+		{6, image.Pt(2, 3), image.Pt(1, 0), image.Pt(1, 2), image.Pt(0, 0)},
+		{7, image.Pt(2, 3), image.Pt(1, 2), image.Pt(1, 0), image.Pt(0, 2)},
+		{8, image.Pt(2, 3), image.Pt(0, 2), image.Pt(0, 0), image.Pt(1, 2)},
+		{9, image.Pt(3, 2), image.Pt(0, 0), image.Pt(2, 0), image.Pt(0, 1)},
+	}
+	for _, test := range tests {
+		upright := orient(corners(), test.orientation)
+		if upright.Bounds().Size() != test.size {
+			t.Fatalf("orientation %d: size %v, want %v", test.orientation, upright.Bounds().Size(), test.size)
+		}
+		for at, want := range map[image.Point]color.RGBA{test.red: red, test.green: green, test.blue: blue} {
+			if got := upright.RGBAAt(at.X, at.Y); got != want {
+				t.Fatalf("orientation %d: %v is %v, want %v", test.orientation, at, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package middlewares
+
+import (
+	"net/http"
+	"tarun-kavipurapu/test-go-chat/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const authUserIdKey = "authUserId"
+
+// AuthMiddleware rejects requests without a valid bearer token and stores the user id in the context
+func AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.ExtractUserIdFromRequest(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized Please Login"})
+			return
+		}
+
+		SetAuthUserId(c, userId)
+		c.Next()
+	}
+}
+
+// GetAuthUserId returns the id of the user authenticated by AuthMiddleware
+func GetAuthUserId(c *gin.Context) int64 {
+	return c.GetInt64(authUserIdKey)
+}
+
+// SetAuthUserId stores the id of the authenticated user in the context
+func SetAuthUserId(c *gin.Context, userId int64) {
+	c.Set(authUserIdKey, userId)
+}
@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"tarun-kavipurapu/test-go-chat/internal/handlers"
+	"time"
+)
+
+const (
+	// Workers used when the configuration does not set PIPELINE_WORKERS.
+	defaultPipelineWorkers = 16
+
+	// Jobs a worker can have waiting before Submit blocks the caller.
+	pipelineQueueSize = 256
+
+	// addressLookupTimeout bounds the query a readPump makes to key a conversation it has not sent to yet.
+	addressLookupTimeout = 5 * time.Second
+
+	// Conversations whose key a connection remembers.
+	maxAddressKeys = 256
+)
+
+// Pipeline runs the database work of the hub on a bounded pool of workers, so a slow query
+// only delays the jobs sharing its worker instead of every connected user.
+// Jobs submitted with the same key run on the same worker in submission order, which keeps
+// the messages of a conversation, and the connects and disconnects of a user, in order.
+type Pipeline struct {
+	queues []chan func(ctx context.Context)
+}
+
+func NewPipeline(workers int) *Pipeline {
+	if workers <= 0 {
+		workers = defaultPipelineWorkers
+	}
+	p := &Pipeline{queues: make([]chan func(ctx context.Context), workers)}
+	for i := range p.queues {
+		p.queues[i] = make(chan func(ctx context.Context), pipelineQueueSize)
+	}
+	return p
+}
+
+// Run starts the workers, they stop when ctx is done.
+func (p *Pipeline) Run(ctx context.Context) {
+	for _, queue := range p.queues {
+		go func(queue chan func(ctx context.Context)) {
+			for {
+				select {
+				case job := <-queue:
+					job(ctx)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(queue)
+	}
+}
+
+// Submit queues the job on the worker owning key. It blocks while that worker's queue is full,
+// which slows down the connection submitting instead of dropping its events.
+// It must never be called from a shard goroutine, the workers wait on the shards.
+func (p *Pipeline) Submit(key string, job func(ctx context.Context)) {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	p.queues[hash.Sum32()%uint32(len(p.queues))] <- job
+}
+
+func userKey(userId int64) string {
+	return fmt.Sprintf("user:%d", userId)
+}
+
+func conversationKey(conversationId int64) string {
+	return fmt.Sprintf("conversation:%d", conversationId)
+}
+
+func messageKey(messageId int64) string {
+	return fmt.Sprintf("message:%d", messageId)
+}
+
+// addressKey orders the events of a connection addressed like a message. A direct conversation is keyed by
+// its two users whether the event names the recipient or the conversation, so a message sent either way keeps
+// its order. It runs on the connection's readPump, which looks every conversation up once.
+func (h *Hub) addressKey(c *Client, to int64, conversationId int64) string {
+	if conversationId == 0 {
+		return directAddressKey(handlers.DirectKey(c.userId, to))
+	}
+	if key, ok := c.addressKeys[conversationId]; ok {
+		return key
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), addressLookupTimeout)
+	defer cancel()
+	conversation, err := h.store.GetConversationById(ctx, conversationId)
+	if err != nil {
+		// the handler refuses the unknown conversation, or retries the lookup, on its worker
+		return conversationKey(conversationId)
+	}
+	key := conversationKey(conversationId)
+	if !conversation.IsGroup && conversation.DirectKey.Valid {
+		key = directAddressKey(conversation.DirectKey.String)
+	}
+	// a conversation never changes kind, the cache is only bounded
+	if len(c.addressKeys) >= maxAddressKeys {
+		clear(c.addressKeys)
+	}
+	c.addressKeys[conversationId] = key
+	return key
+}
+
+func directAddressKey(directKey string) string {
+	return "direct:" + directKey
+}
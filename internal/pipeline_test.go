@@ -0,0 +1,181 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"tarun-kavipurapu/test-go-chat/db/dbtest"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/internal/handlers"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestPipelineKeepsOrderPerKey(t *testing.T) {
+	pipeline := NewPipeline(4)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pipeline.Run(ctx)
+
+	var mu sync.Mutex
+	ran := make(map[string][]int)
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		for _, key := range []string{userKey(1), conversationKey(1), directAddressKey("1:2")} {
+			i, key := i, key
+			wg.Add(1)
+			pipeline.Submit(key, func(ctx context.Context) {
+				defer wg.Done()
+				mu.Lock()
+				ran[key] = append(ran[key], i)
+				mu.Unlock()
+			})
+		}
+	}
+	wg.Wait()
+
+	for key, order := range ran {
+		if !slices.IsSorted(order) || len(order) != 100 {
+			t.Fatalf("jobs of %s ran in order %v", key, order)
+		}
+	}
+}
+
+func TestAddressKeyOfDirectConversations(t *testing.T) {
+	conn := dbtest.NewConn()
+	conn.OnQuery("GetConversationById", func(args []interface{}) ([][]interface{}, error) {
+		switch args[0].(int64) {
+		case 9:
+			return dbtest.Rows(db.Conversation{ID: 9, DirectKey: pgtype.Text{String: "1:2", Valid: true}}), nil
+		case 5:
+			return dbtest.Rows(db.Conversation{ID: 5, IsGroup: true}), nil
+		}
+		return nil, nil
+	})
+	hub := newTestHub(conn)
+	client := newTestClient(hub, 1)
+
+	// a direct message keys the same whether it names the recipient or the conversation
+	for i := 0; i < 2; i++ {
+		if byRecipient, byConversation := hub.addressKey(client, 2, 0), hub.addressKey(client, 0, 9); byRecipient != byConversation {
+			t.Fatalf("direct message keyed %q by recipient and %q by conversation", byRecipient, byConversation)
+		}
+	}
+	if key := hub.addressKey(newTestClient(hub, 2), 1, 0); key != hub.addressKey(client, 2, 0) {
+		t.Fatalf("the two users of a direct conversation key it differently")
+	}
+	if key := hub.addressKey(client, 0, 5); key != conversationKey(5) {
+		t.Fatalf("group keyed %q", key)
+	}
+	if key := hub.addressKey(client, 0, 7); key != conversationKey(7) {
+		t.Fatalf("unknown conversation keyed %q", key)
+	}
+	hub.addressKey(client, 0, 7)
+
+	// known conversations are looked up once, unknown ones every time
+	looked := make(map[int64]int)
+	for _, call := range conn.Calls("GetConversationById") {
+		looked[call[0].(int64)]++
+	}
+	if looked[9] != 1 || looked[5] != 1 || looked[7] != 2 {
+		t.Fatalf("conversations looked up %v", looked)
+	}
+}
+
+// benchConn is a database of groups 1 to n holding users 1 to 3, whose queries all take latency.
+func benchConn(latency time.Duration) *dbtest.Conn {
+	conn := dbtest.NewConn()
+	conn.Latency = latency
+	var lastId atomic.Int64
+	conn.OnQuery("GetUserById", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.User{ID: args[0].(int64)}), nil
+	})
+	conn.OnQuery("GetConversationById", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.Conversation{ID: args[0].(int64), IsGroup: true}), nil
+	})
+	conn.OnQuery("GetConversationMember", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.ConversationMember{ConversationID: args[0].(int64), UserID: args[1].(int64)}), nil
+	})
+	conn.OnQuery("ListConversationMemberIds", func(args []interface{}) ([][]interface{}, error) {
+		return [][]interface{}{{int64(1)}, {int64(2)}, {int64(3)}}, nil
+	})
+	conn.OnQuery("NextConversationSeq", func(args []interface{}) ([][]interface{}, error) {
+		return [][]interface{}{{lastId.Load() + 1}}, nil
+	})
+	conn.OnQuery("InsertMessage", func(args []interface{}) ([][]interface{}, error) {
+		return dbtest.Rows(db.Message{
+			ID:             lastId.Add(1),
+			FromUserID:     args[0].(int64),
+			ConversationID: args[2].(int64),
+			Seq:            args[6].(int64),
+			CreatedAt:      pgtype.Timestamptz{Time: time.Now(), Valid: true},
+		}), nil
+	})
+	return conn
+}
+
+// discardLogs silences the hub's logs until the benchmark ends.
+func discardLogs(b *testing.B) {
+	output := log.Writer()
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(output) })
+}
+
+// drainTestClient reads the events queued for the connection until the benchmark ends, counting the messages.
+func drainTestClient(b *testing.B, client *Client, received *atomic.Int64) {
+	done := make(chan struct{})
+	b.Cleanup(func() { close(done) })
+	go func() {
+		for {
+			select {
+			case event, ok := <-client.sendTo:
+				if !ok {
+					b.Errorf("connection of user %d overflowed", client.userId)
+					return
+				}
+				client.dequeued()
+				if event.EventName == EventMessageNew {
+					received.Add(1)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// BenchmarkMessageBroadcastDatabaseLatency measures how many group messages the hub stores and delivers
+// when every query takes a millisecond, with the messages spread over 64 conversations.
+func BenchmarkMessageBroadcastDatabaseLatency(b *testing.B) {
+	for _, workers := range []int{1, 16, 64} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			discardLogs(b)
+			store := dbtest.NewStore(benchConn(time.Millisecond))
+			hub := runTestHub(b, NewHub(handlers.NewChatHandler(store), store, NewPresence(), NewMemoryBroker(), NewMemoryRegistry(), HubOptions{
+				NodeId:        "node",
+				Workers:       workers,
+				SendQueueSize: 1 << 14,
+			}))
+			var received atomic.Int64
+			drainTestClient(b, connectTestClient(hub, 2), &received)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				message := &Message{From: 1, ConversationId: int64(i%64 + 1), Content: "hi"}
+				hub.pipeline.Submit(conversationKey(message.ConversationId), func(ctx context.Context) {
+					hub.HandleMessageBroadcast(message, ctx)
+				})
+			}
+			for received.Load() < int64(b.N) && !b.Failed() {
+				time.Sleep(time.Millisecond)
+			}
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "msgs/s")
+		})
+	}
+}
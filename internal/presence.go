@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"context"
+	"log"
+	"slices"
+	"sync"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const EventPresence = "presence"
+
+// PresenceUpdate is the payload of the presence event sent to the peers of a user.
+type PresenceUpdate struct {
+	UserId     int64      `json:"user_id"`
+	Online     bool       `json:"online"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+}
+
+// Presence counts the live connections of every user.
+// The hub updates it while the REST handlers read it, so it is safe for concurrent use.
+type Presence struct {
+	mu          sync.RWMutex
+	connections map[int64]int
+}
+
+func NewPresence() *Presence {
+	return &Presence{connections: make(map[int64]int)}
+}
+
+// Connect adds a connection and reports whether it is the user's first one.
+func (p *Presence) Connect(userId int64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.connections[userId]++
+	return p.connections[userId] == 1
+}
+
+// Disconnect removes a connection and reports whether it was the user's last one.
+func (p *Presence) Disconnect(userId int64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.connections[userId] == 0 {
+		return false
+	}
+	p.connections[userId]--
+	if p.connections[userId] > 0 {
+		return false
+	}
+	delete(p.connections, userId)
+	return true
+}
+
+// IsOnline reports whether the user has at least one live connection.
+func (p *Presence) IsOnline(userId int64) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.connections[userId] > 0
+}
+
+// ConnectedUsers returns every user with at least one live connection.
+func (p *Presence) ConnectedUsers() []int64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	userIds := make([]int64, 0, len(p.connections))
+	for userId := range p.connections {
+		userIds = append(userIds, userId)
+	}
+	return userIds
+}
+
+// OnlineUsers reports which of the users have at least one live connection.
+func (p *Presence) OnlineUsers(userIds []int64) map[int64]bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	online := make(map[int64]bool, len(userIds))
+	for _, userId := range userIds {
+		if p.connections[userId] > 0 {
+			online[userId] = true
+		}
+	}
+	return online
+}
+
+// presenceLookupTimeout bounds how long a presence query waits on the registry.
+const presenceLookupTimeout = time.Second
+
+// ClusterPresence answers presence queries for users connected to any node.
+type ClusterPresence struct {
+	local    *Presence
+	registry Registry
+}
+
+func NewClusterPresence(local *Presence, registry Registry) *ClusterPresence {
+	return &ClusterPresence{local: local, registry: registry}
+}
+
+// OnlineUsers reports which of the users have a live connection on this node or on another one.
+// The users not connected here are looked up in the registry at once, when it cannot be read
+// only this node's connections count.
+func (p *ClusterPresence) OnlineUsers(userIds []int64) map[int64]bool {
+	online := p.local.OnlineUsers(userIds)
+	var elsewhere []int64
+	for _, userId := range userIds {
+		if !online[userId] {
+			elsewhere = append(elsewhere, userId)
+		}
+	}
+	if len(elsewhere) == 0 {
+		return online
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), presenceLookupTimeout)
+	defer cancel()
+	routes, err := p.registry.Lookup(ctx, elsewhere)
+	if err != nil {
+		log.Printf("Unable to look up the nodes of %d users: %v\n", len(elsewhere), err)
+		return online
+	}
+	for _, userId := range elsewhere {
+		if len(routes[userId]) > 0 {
+			online[userId] = true
+		}
+	}
+	return online
+}
+
+// publishPresence tells everyone sharing a conversation with the user that they came online or went offline,
+// except the users on either side of a block with them. Going offline also stores the last seen time.
+func (h *Hub) publishPresence(userId int64, online bool, ctx context.Context) {
+	update := &PresenceUpdate{UserId: userId, Online: online}
+	if !online {
+		now := time.Now()
+		update.LastSeenAt = &now
+		err := h.store.UpdateUserLastSeen(ctx, db.UpdateUserLastSeenParams{
+			ID:         userId,
+			LastSeenAt: pgtype.Timestamptz{Time: now, Valid: true},
+		})
+		if err != nil {
+			log.Printf("Unable to store last seen of %d: %v\n", userId, err)
+		}
+	}
+
+	peerIds, err := h.store.ListPeerIds(ctx, userId)
+	if err != nil {
+		log.Printf("Unable to fetch peers of %d: %v\n", userId, err)
+		return
+	}
+	blockedIds, err := h.store.ListBlockRelatedIds(ctx, userId)
+	if err != nil {
+		log.Printf("Unable to fetch blocks of %d: %v\n", userId, err)
+		return
+	}
+	peerIds = slices.DeleteFunc(peerIds, func(peerId int64) bool {
+		return slices.Contains(blockedIds, peerId)
+	})
+	h.publishToUsers(peerIds, newSocketEvent(EventPresence, update), nil)
+}
@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"context"
+	"tarun-kavipurapu/test-go-chat/db/dbtest"
+	"testing"
+)
+
+func TestPresenceCountsConnections(t *testing.T) {
+	presence := NewPresence()
+
+	if !presence.Connect(1) || presence.Connect(1) {
+		t.Fatal("only the first connection is the first")
+	}
+	if presence.Disconnect(1) || !presence.IsOnline(1) {
+		t.Fatal("user went offline with a connection left")
+	}
+	if !presence.Disconnect(1) || presence.IsOnline(1) {
+		t.Fatal("user stayed online without connections")
+	}
+	if presence.Disconnect(1) {
+		t.Fatal("disconnecting an offline user reported a last connection")
+	}
+}
+
+func TestPresenceOnlineUsers(t *testing.T) {
+	presence := NewPresence()
+	presence.Connect(1)
+	presence.Connect(3)
+
+	online := presence.OnlineUsers([]int64{1, 2, 3})
+	if !online[1] || online[2] || !online[3] {
+		t.Fatalf("online = %v, want users 1 and 3", online)
+	}
+}
+
+func TestPresenceSkipsBlockedPeers(t *testing.T) {
+	conn := dbtest.NewConn()
+	conn.OnQuery("ListPeerIds", func(args []interface{}) ([][]interface{}, error) {
+		return [][]interface{}{{int64(2)}, {int64(3)}}, nil
+	})
+	// user 3 blocked user 1
+	conn.OnQuery("ListBlockRelatedIds", func(args []interface{}) ([][]interface{}, error) {
+		return [][]interface{}{{int64(3)}}, nil
+	})
+	hub := startTestHub(t, conn)
+	peer, blocked := connectTestClient(hub, 2), connectTestClient(hub, 3)
+
+	hub.publishPresence(1, true, context.Background())
+
+	if update, ok := nextEvent(t, peer).EventPayload.(*PresenceUpdate); !ok || update.UserId != 1 || !update.Online {
+		t.Fatalf("peer got %+v, want user 1 online", update)
+	}
+	expectNoEvent(t, blocked)
+}
@@ -0,0 +1,24 @@
+package internal
+
+import (
+	"context"
+	"log"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/internal/handlers"
+)
+
+// EventUserUpdated carries a changed profile, as types.PublicProfile, to the users sharing a conversation
+// with its owner and to the owner's other connections.
+const EventUserUpdated = "user.updated"
+
+// ProfileUpdated pushes a changed profile, see handlers.ProfileNotifier.
+func (h *Hub) ProfileUpdated(user db.User) {
+	h.pipeline.Submit(userKey(user.ID), func(ctx context.Context) {
+		peerIds, err := h.store.ListPeerIds(ctx, user.ID)
+		if err != nil {
+			log.Printf("Unable to fetch peers of %d: %v\n", user.ID, err)
+			return
+		}
+		h.publishToUsers(append(peerIds, user.ID), newSocketEvent(EventUserUpdated, handlers.NewPublicProfile(user)), nil)
+	})
+}
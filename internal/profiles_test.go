@@ -0,0 +1,30 @@
+package internal
+
+import (
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/types"
+	"testing"
+)
+
+func TestProfileUpdatesReachPeersAndOwner(t *testing.T) {
+	conn := typingConn()
+	hub := startTestHub(t, conn)
+	clients := make(map[int64]*Client)
+	for userId := int64(1); userId <= 4; userId++ {
+		clients[userId] = connectTestClient(hub, userId)
+	}
+
+	hub.ProfileUpdated(db.User{ID: 1, Username: "alice", Email: "alice@example.com"})
+	// user 1 shares conversations with 2 and 3
+	for _, userId := range []int64{1, 2, 3} {
+		event := nextEvent(t, clients[userId])
+		profile, ok := event.EventPayload.(types.PublicProfile)
+		if event.EventName != EventUserUpdated || !ok || profile.Id != 1 || profile.Username != "alice" {
+			t.Fatalf("user %d got %s %+v, want the profile of 1", userId, event.EventName, event.EventPayload)
+		}
+	}
+	expectNoEvent(t, clients[4])
+	if len(conn.Calls("ListPeerIds")) != 1 {
+		t.Fatal("peers not looked up")
+	}
+}
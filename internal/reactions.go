@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/internal/handlers"
+	"tarun-kavipurapu/test-go-chat/types"
+	"unicode/utf8"
+)
+
+const (
+	// EventReactionAdd and EventReactionRemove are sent by a member to react to a message or take it back.
+	EventReactionAdd    = "reaction.add"
+	EventReactionRemove = "reaction.remove"
+	// EventReactionAdded and EventReactionRemoved carry the change to the members of the conversation.
+	EventReactionAdded   = "reaction.added"
+	EventReactionRemoved = "reaction.removed"
+
+	ErrorCodeTooManyReactions = "too_many_reactions"
+
+	// maxEmojiLength matches the emoji column of the message_reaction table.
+	maxEmojiLength = 32
+)
+
+// Reaction is the payload of the reaction events, clients only send MessageId and Emoji.
+type Reaction struct {
+	MessageId      int64  `json:"message_id"`
+	ConversationId int64  `json:"conversation_id"`
+	UserId         int64  `json:"user_id"`
+	Emoji          string `json:"emoji"`
+}
+
+func (h *Hub) onReactionAdd(c *Client, event *types.SocketEventRequest) error {
+	return h.submitReaction(c, event, false)
+}
+
+func (h *Hub) onReactionRemove(c *Client, event *types.SocketEventRequest) error {
+	return h.submitReaction(c, event, true)
+}
+
+func (h *Hub) submitReaction(c *Client, event *types.SocketEventRequest, remove bool) error {
+	var reaction Reaction
+	if err := json.Unmarshal(event.EventPayload, &reaction); err != nil {
+		return errInvalidPayload
+	}
+	if reaction.MessageId == 0 || reaction.Emoji == "" || utf8.RuneCountInString(reaction.Emoji) > maxEmojiLength {
+		return &SocketError{Code: ErrorCodeInvalidPayload, Message: "Reactions need the message id and an emoji of at most 32 characters"}
+	}
+
+	// reactions always belong to the authenticated user
+	reaction.UserId = c.userId
+	h.pipeline.Submit(messageKey(reaction.MessageId), func(ctx context.Context) {
+		h.HandleReaction(c, &reaction, remove, event.EventId, ctx)
+	})
+	return nil
+}
+
+// HandleReaction stores or removes a reaction and pushes the change to the members of the message's conversation.
+// Adding a reaction twice, or removing one that does not exist, changes nothing and pushes nothing.
+func (h *Hub) HandleReaction(client *Client, reaction *Reaction, remove bool, eventId string, ctx context.Context) {
+	var message db.Message
+	var changed bool
+	var err error
+	eventName := EventReactionAdded
+	if remove {
+		eventName = EventReactionRemoved
+		message, changed, err = h.chatHandler.RemoveReaction(ctx, reaction.UserId, reaction.MessageId, reaction.Emoji)
+	} else {
+		message, changed, err = h.chatHandler.AddReaction(ctx, reaction.UserId, reaction.MessageId, reaction.Emoji)
+	}
+	if err != nil {
+		log.Printf("Unable to change reaction of %d to message %d: %v\n", reaction.UserId, reaction.MessageId, err)
+		h.replyError(client, reactionError(err), eventId)
+		return
+	}
+	if !changed {
+		return
+	}
+	reaction.ConversationId = message.ConversationID
+
+	memberIds, err := h.store.ListConversationMemberIds(ctx, reaction.ConversationId)
+	if err != nil {
+		log.Printf("Unable to fetch members of conversation %d: %v\n", reaction.ConversationId, err)
+		return
+	}
+	h.publishToConversation(reaction.ConversationId, memberIds, newSocketEvent(eventName, reaction), nil)
+}
+
+// reactionError converts an error of a reaction into the error event the member gets.
+func reactionError(err error) *SocketError {
+	switch {
+	case errors.Is(err, handlers.ErrTooManyReactions):
+		return &SocketError{Code: ErrorCodeTooManyReactions, Message: "The message has too many different reactions"}
+	case errors.Is(err, handlers.ErrNotConversationMember):
+		return &SocketError{Code: ErrorCodeConversationNotFound, Message: "Conversation not found or you are not a member"}
+	case errors.Is(err, handlers.ErrMessageNotFound):
+		return &SocketError{Code: ErrorCodeMessageNotFound, Message: "Message not found"}
+	default:
+		return &SocketError{Code: ErrorCodePersistFailed, Message: "Unable to store the reaction, please retry"}
+	}
+}
@@ -0,0 +1,173 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"tarun-kavipurapu/test-go-chat/db/dbtest"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/internal/handlers"
+	"tarun-kavipurapu/test-go-chat/types"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type reactionKey struct {
+	userId int64
+	emoji  string
+}
+
+// reactionConn is a database where users 1 and 2 are the members of conversation 5, holding message 7 and
+// the deleted message 8. It stores the reactions to message 7 like Postgres would, starting with the given ones.
+func reactionConn(reactions ...reactionKey) *dbtest.Conn {
+	var mu sync.Mutex
+	stored := make(map[reactionKey]bool)
+	for _, reaction := range reactions {
+		stored[reaction] = true
+	}
+
+	conn := dbtest.NewConn()
+	conn.OnQuery("GetMessageForUpdate", func(args []interface{}) ([][]interface{}, error) {
+		message := db.Message{ID: args[0].(int64), ConversationID: 5, FromUserID: 2}
+		switch message.ID {
+		case 7:
+		case 8:
+			message.DeletedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+		default:
+			return nil, nil
+		}
+		return dbtest.Rows(message), nil
+	})
+	conn.OnQuery("GetConversationMember", func(args []interface{}) ([][]interface{}, error) {
+		if args[1].(int64) > 2 {
+			return nil, nil
+		}
+		return dbtest.Rows(db.ConversationMember{ConversationID: args[0].(int64), UserID: args[1].(int64)}), nil
+	})
+	conn.OnQuery("ListConversationMemberIds", func(args []interface{}) ([][]interface{}, error) {
+		return [][]interface{}{{int64(1)}, {int64(2)}}, nil
+	})
+	// the reaction queries take message_id, user_id and emoji, the emoji ones skip the user
+	conn.OnQuery("HasMessageReactionEmoji", func(args []interface{}) ([][]interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		for reaction := range stored {
+			if reaction.emoji == args[1].(string) {
+				return [][]interface{}{{true}}, nil
+			}
+		}
+		return [][]interface{}{{false}}, nil
+	})
+	conn.OnQuery("CountMessageReactionEmojis", func(args []interface{}) ([][]interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		emojis := make(map[string]bool)
+		for reaction := range stored {
+			emojis[reaction.emoji] = true
+		}
+		return [][]interface{}{{int64(len(emojis))}}, nil
+	})
+	conn.OnExec("AddMessageReaction", func(args []interface{}) (int64, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		reaction := reactionKey{userId: args[1].(int64), emoji: args[2].(string)}
+		if stored[reaction] {
+			return 0, nil
+		}
+		stored[reaction] = true
+		return 1, nil
+	})
+	conn.OnExec("RemoveMessageReaction", func(args []interface{}) (int64, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		reaction := reactionKey{userId: args[1].(int64), emoji: args[2].(string)}
+		if !stored[reaction] {
+			return 0, nil
+		}
+		delete(stored, reaction)
+		return 1, nil
+	})
+	return conn
+}
+
+// expectNoEvent checks that nothing more is queued for the connection.
+func expectNoEvent(t testing.TB, client *Client) {
+	t.Helper()
+	select {
+	case event := <-client.sendTo:
+		t.Fatalf("user %d got %s", client.userId, event.EventName)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func expectErrorEvent(t testing.TB, client *Client, code string) {
+	t.Helper()
+	event := nextEvent(t, client)
+	payload, ok := event.EventPayload.(*types.SocketErrorPayload)
+	if event.EventName != EventError || !ok || payload.Code != code {
+		t.Fatalf("got %s %+v, want a %s error", event.EventName, event.EventPayload, code)
+	}
+}
+
+func TestReactionChangesReachMembersOnce(t *testing.T) {
+	hub := startTestHub(t, reactionConn())
+	reactor, member := connectTestClient(hub, 1), connectTestClient(hub, 2)
+	ctx := context.Background()
+
+	for _, remove := range []bool{false, true} {
+		want := EventReactionAdded
+		if remove {
+			want = EventReactionRemoved
+		}
+		// the second time changes nothing
+		for attempt := 0; attempt < 2; attempt++ {
+			hub.HandleReaction(reactor, &Reaction{MessageId: 7, UserId: 1, Emoji: "👍"}, remove, "event", ctx)
+		}
+		for _, client := range []*Client{reactor, member} {
+			event := nextEvent(t, client)
+			reaction, ok := event.EventPayload.(*Reaction)
+			if event.EventName != want || !ok || reaction.ConversationId != 5 || reaction.UserId != 1 || reaction.Emoji != "👍" {
+				t.Fatalf("user %d got %s %+v, want %s", client.userId, event.EventName, event.EventPayload, want)
+			}
+			expectNoEvent(t, client)
+		}
+	}
+}
+
+func TestReactionsAreCappedPerMessage(t *testing.T) {
+	reactions := make([]reactionKey, handlers.MaxReactionEmojis)
+	for i := range reactions {
+		reactions[i] = reactionKey{userId: 2, emoji: fmt.Sprint(i)}
+	}
+	hub := startTestHub(t, reactionConn(reactions...))
+	reactor := connectTestClient(hub, 1)
+	ctx := context.Background()
+
+	hub.HandleReaction(reactor, &Reaction{MessageId: 7, UserId: 1, Emoji: "👍"}, false, "event", ctx)
+	expectErrorEvent(t, reactor, ErrorCodeTooManyReactions)
+
+	// joining an emoji already used adds no new one
+	hub.HandleReaction(reactor, &Reaction{MessageId: 7, UserId: 1, Emoji: "0"}, false, "event", ctx)
+	if event := nextEvent(t, reactor); event.EventName != EventReactionAdded {
+		t.Fatalf("got %s, want %s", event.EventName, EventReactionAdded)
+	}
+}
+
+func TestReactionRefusals(t *testing.T) {
+	hub := startTestHub(t, reactionConn())
+	stranger, member := connectTestClient(hub, 3), connectTestClient(hub, 1)
+	ctx := context.Background()
+
+	hub.HandleReaction(stranger, &Reaction{MessageId: 7, UserId: 3, Emoji: "👍"}, false, "event", ctx)
+	expectErrorEvent(t, stranger, ErrorCodeConversationNotFound)
+	for _, messageId := range []int64{8, 9} {
+		hub.HandleReaction(member, &Reaction{MessageId: messageId, UserId: 1, Emoji: "👍"}, false, "event", ctx)
+		expectErrorEvent(t, member, ErrorCodeMessageNotFound)
+	}
+
+	for _, reaction := range []Reaction{{Emoji: "👍"}, {MessageId: 7}, {MessageId: 7, Emoji: fmt.Sprintf("%33s", "")}} {
+		expectSocketError(t, dispatch(member, EventReactionAdd, reaction), ErrorCodeInvalidPayload)
+	}
+}
@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisBroadcastChannel is the pub/sub channel every node listens on.
+const redisBroadcastChannel = "chat:broadcast"
+
+// redisNodeChannel is the pub/sub channel only the node listens on.
+func redisNodeChannel(nodeId string) string {
+	return "chat:node:" + nodeId
+}
+
+// RedisBroker distributes envelopes between nodes with redis pub/sub.
+type RedisBroker struct {
+	client *redis.Client
+}
+
+func NewRedisBroker(client *redis.Client) *RedisBroker {
+	return &RedisBroker{client: client}
+}
+
+func (b *RedisBroker) PublishToUser(ctx context.Context, envelope *BrokerEnvelope) error {
+	return b.publish(ctx, redisBroadcastChannel, envelope)
+}
+
+func (b *RedisBroker) PublishToConversation(ctx context.Context, envelope *BrokerEnvelope) error {
+	return b.publish(ctx, redisBroadcastChannel, envelope)
+}
+
+func (b *RedisBroker) PublishToNode(ctx context.Context, nodeId string, envelope *BrokerEnvelope) error {
+	return b.publish(ctx, redisNodeChannel(nodeId), envelope)
+}
+
+func (b *RedisBroker) publish(ctx context.Context, channel string, envelope *BrokerEnvelope) error {
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	return b.client.Publish(ctx, channel, payload).Err()
+}
+
+func (b *RedisBroker) Subscribe(ctx context.Context, nodeId string, handler func(*BrokerEnvelope)) error {
+	pubsub := b.client.Subscribe(ctx, redisBroadcastChannel, redisNodeChannel(nodeId))
+	// wait for the subscription to be confirmed so nothing published afterwards is missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return err
+	}
+
+	go func() {
+		defer pubsub.Close()
+		messages := pubsub.Channel()
+		for {
+			select {
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				envelope, err := decodeEnvelope([]byte(msg.Payload))
+				if err != nil {
+					log.Printf("Dropping malformed broker envelope: %v\n", err)
+					continue
+				}
+				// our own publications come back through redis, they were delivered locally already
+				if envelope.NodeId == nodeId {
+					continue
+				}
+				handler(envelope)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (b *RedisBroker) Close() error {
+	return b.client.Close()
+}
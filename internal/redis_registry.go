@@ -0,0 +1,166 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis keys of the registry:
+//
+//	chat:nodes              set of the nodes that joined the cluster
+//	chat:node:<id>:lease    expires when the node stops sending heartbeats
+//	chat:node:<id>:users    set of the users connected to the node
+//	chat:user:<id>:nodes    set of the nodes the user is connected to
+const redisNodesKey = "chat:nodes"
+
+func redisLeaseKey(nodeId string) string {
+	return fmt.Sprintf("chat:node:%s:lease", nodeId)
+}
+
+func redisNodeUsersKey(nodeId string) string {
+	return fmt.Sprintf("chat:node:%s:users", nodeId)
+}
+
+func redisUserNodesKey(userId int64) string {
+	return fmt.Sprintf("chat:user:%d:nodes", userId)
+}
+
+// RedisRegistry shares the user to node routes of every node through redis.
+type RedisRegistry struct {
+	client *redis.Client
+}
+
+func NewRedisRegistry(client *redis.Client) *RedisRegistry {
+	return &RedisRegistry{client: client}
+}
+
+func (r *RedisRegistry) Register(ctx context.Context, userId int64, nodeId string) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, redisUserNodesKey(userId), nodeId)
+		pipe.SAdd(ctx, redisNodeUsersKey(nodeId), userId)
+		return nil
+	})
+	return err
+}
+
+func (r *RedisRegistry) Unregister(ctx context.Context, userId int64, nodeId string) error {
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SRem(ctx, redisUserNodesKey(userId), nodeId)
+		pipe.SRem(ctx, redisNodeUsersKey(nodeId), userId)
+		return nil
+	})
+	return err
+}
+
+func (r *RedisRegistry) Lookup(ctx context.Context, userIds []int64) (map[int64][]string, error) {
+	pipe := r.client.Pipeline()
+	members := make([]*redis.StringSliceCmd, len(userIds))
+	for i, userId := range userIds {
+		members[i] = pipe.SMembers(ctx, redisUserNodesKey(userId))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	// check every node's lease once, the routes of crashed nodes are ignored until they are removed
+	alive := make(map[string]*redis.IntCmd)
+	pipe = r.client.Pipeline()
+	for _, cmd := range members {
+		for _, nodeId := range cmd.Val() {
+			if _, ok := alive[nodeId]; !ok {
+				alive[nodeId] = pipe.Exists(ctx, redisLeaseKey(nodeId))
+			}
+		}
+	}
+	if len(alive) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	routes := make(map[int64][]string)
+	for i, cmd := range members {
+		for _, nodeId := range cmd.Val() {
+			if alive[nodeId].Val() == 1 {
+				routes[userIds[i]] = append(routes[userIds[i]], nodeId)
+			}
+		}
+	}
+	return routes, nil
+}
+
+func (r *RedisRegistry) Heartbeat(ctx context.Context, nodeId string) (bool, error) {
+	var lease *redis.IntCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		lease = pipe.Exists(ctx, redisLeaseKey(nodeId))
+		pipe.Set(ctx, redisLeaseKey(nodeId), 1, nodeLeaseTTL)
+		pipe.SAdd(ctx, redisNodesKey, nodeId)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return lease.Val() == 0, nil
+}
+
+func (r *RedisRegistry) ExpiredNodes(ctx context.Context) ([]string, error) {
+	nodeIds, err := r.client.SMembers(ctx, redisNodesKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := r.client.Pipeline()
+	leases := make([]*redis.IntCmd, len(nodeIds))
+	for i, nodeId := range nodeIds {
+		leases[i] = pipe.Exists(ctx, redisLeaseKey(nodeId))
+	}
+	if len(nodeIds) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var expired []string
+	for i, nodeId := range nodeIds {
+		if leases[i].Val() == 0 {
+			expired = append(expired, nodeId)
+		}
+	}
+	return expired, nil
+}
+
+func (r *RedisRegistry) RemoveNode(ctx context.Context, nodeId string) ([]int64, error) {
+	// whoever takes the node out of the cluster set owns its cleanup
+	removed, err := r.client.SRem(ctx, redisNodesKey, nodeId).Result()
+	if err != nil {
+		return nil, err
+	}
+	members, err := r.client.SMembers(ctx, redisNodeUsersKey(nodeId)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	userIds := make([]int64, 0, len(members))
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, member := range members {
+			userId, err := strconv.ParseInt(member, 10, 64)
+			if err != nil {
+				continue
+			}
+			userIds = append(userIds, userId)
+			pipe.SRem(ctx, redisUserNodesKey(userId), nodeId)
+		}
+		pipe.Del(ctx, redisNodeUsersKey(nodeId), redisLeaseKey(nodeId))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if removed == 0 {
+		return nil, nil
+	}
+	return userIds, nil
+}
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// A node that does not renew its lease within this period is considered crashed.
+	nodeLeaseTTL = 15 * time.Second
+
+	// Nodes renew their lease with this period. Must be less than nodeLeaseTTL.
+	nodeHeartbeatPeriod = nodeLeaseTTL / 3
+)
+
+// Registry records which nodes hold the sockets of every user.
+// A node appears for a user from its first connection of that user until its last one closes,
+// and only as long as the node keeps its lease alive with Heartbeat.
+type Registry interface {
+	Register(ctx context.Context, userId int64, nodeId string) error
+	Unregister(ctx context.Context, userId int64, nodeId string) error
+	// Lookup returns the live nodes of every user that is connected somewhere.
+	Lookup(ctx context.Context, userIds []int64) (map[int64][]string, error)
+	// Heartbeat creates or renews the lease of the node. It reports whether the node had no live lease,
+	// in which case another node may have removed it and its users have to be registered again.
+	Heartbeat(ctx context.Context, nodeId string) (lapsed bool, err error)
+	// ExpiredNodes returns the nodes whose lease ran out without them leaving the registry.
+	ExpiredNodes(ctx context.Context) ([]string, error)
+	// RemoveNode drops every entry of the node and returns the users it held.
+	// When several nodes remove the same node only one of them gets the users.
+	RemoveNode(ctx context.Context, nodeId string) ([]int64, error)
+}
+
+// MemoryRegistry is the in-process registry used on a single node and to run several hubs in one process.
+type MemoryRegistry struct {
+	mu     sync.Mutex
+	users  map[int64]map[string]bool
+	nodes  map[string]map[int64]bool
+	leases map[string]time.Time
+}
+
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{
+		users:  make(map[int64]map[string]bool),
+		nodes:  make(map[string]map[int64]bool),
+		leases: make(map[string]time.Time),
+	}
+}
+
+func (r *MemoryRegistry) Register(ctx context.Context, userId int64, nodeId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.users[userId] == nil {
+		r.users[userId] = make(map[string]bool)
+	}
+	r.users[userId][nodeId] = true
+	if r.nodes[nodeId] == nil {
+		r.nodes[nodeId] = make(map[int64]bool)
+	}
+	r.nodes[nodeId][userId] = true
+	return nil
+}
+
+func (r *MemoryRegistry) Unregister(ctx context.Context, userId int64, nodeId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.unregister(userId, nodeId)
+	return nil
+}
+
+func (r *MemoryRegistry) unregister(userId int64, nodeId string) {
+	delete(r.users[userId], nodeId)
+	if len(r.users[userId]) == 0 {
+		delete(r.users, userId)
+	}
+	delete(r.nodes[nodeId], userId)
+}
+
+func (r *MemoryRegistry) Lookup(ctx context.Context, userIds []int64) (map[int64][]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	routes := make(map[int64][]string)
+	for _, userId := range userIds {
+		for nodeId := range r.users[userId] {
+			if r.leases[nodeId].After(now) {
+				routes[userId] = append(routes[userId], nodeId)
+			}
+		}
+	}
+	return routes, nil
+}
+
+func (r *MemoryRegistry) Heartbeat(ctx context.Context, nodeId string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	lapsed := !r.leases[nodeId].After(now)
+	r.leases[nodeId] = now.Add(nodeLeaseTTL)
+	return lapsed, nil
+}
+
+func (r *MemoryRegistry) ExpiredNodes(ctx context.Context) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	var expired []string
+	for nodeId, lease := range r.leases {
+		if !lease.After(now) {
+			expired = append(expired, nodeId)
+		}
+	}
+	return expired, nil
+}
+
+func (r *MemoryRegistry) RemoveNode(ctx context.Context, nodeId string) ([]int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	userIds := make([]int64, 0, len(r.nodes[nodeId]))
+	for userId := range r.nodes[nodeId] {
+		userIds = append(userIds, userId)
+		r.unregister(userId, nodeId)
+	}
+	delete(r.nodes, nodeId)
+	delete(r.leases, nodeId)
+	return userIds, nil
+}
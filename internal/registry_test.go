@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// testRegistry runs the registry through the life of two nodes a and b, where a crashes and is removed.
+// expireLeases makes every lease run out.
+func testRegistry(t *testing.T, registry Registry, expireLeases func()) {
+	ctx := context.Background()
+	expectRoutes := func(want map[int64][]string) {
+		t.Helper()
+		routes, err := registry.Lookup(ctx, []int64{1, 2, 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, nodeIds := range routes {
+			slices.Sort(nodeIds)
+		}
+		if len(routes) != len(want) {
+			t.Fatalf("routes %v, want %v", routes, want)
+		}
+		for userId, nodeIds := range want {
+			if !slices.Equal(routes[userId], nodeIds) {
+				t.Fatalf("routes %v, want %v", routes, want)
+			}
+		}
+	}
+
+	for _, nodeId := range []string{"a", "b"} {
+		if lapsed, err := registry.Heartbeat(ctx, nodeId); err != nil || !lapsed {
+			t.Fatalf("first heartbeat of %s reported lapsed %v (%v), want true", nodeId, lapsed, err)
+		}
+	}
+	if lapsed, _ := registry.Heartbeat(ctx, "a"); lapsed {
+		t.Fatal("renewing a live lease reported it lapsed")
+	}
+	registry.Register(ctx, 1, "a")
+	registry.Register(ctx, 1, "b")
+	registry.Register(ctx, 2, "a")
+	expectRoutes(map[int64][]string{1: {"a", "b"}, 2: {"a"}})
+
+	registry.Unregister(ctx, 1, "b")
+	expectRoutes(map[int64][]string{1: {"a"}, 2: {"a"}})
+	registry.Register(ctx, 1, "b")
+
+	// node a stops sending heartbeats
+	expireLeases()
+	registry.Heartbeat(ctx, "b")
+	expectRoutes(map[int64][]string{1: {"b"}})
+	expired, err := registry.ExpiredNodes(ctx)
+	if err != nil || !slices.Equal(expired, []string{"a"}) {
+		t.Fatalf("expired nodes %v (%v), want [a]", expired, err)
+	}
+
+	// every surviving node tries to remove a, only one of them takes over its users
+	var mu sync.Mutex
+	var owners [][]int64
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			userIds, err := registry.RemoveNode(ctx, "a")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if len(userIds) > 0 {
+				mu.Lock()
+				owners = append(owners, userIds)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(owners) != 1 {
+		t.Fatalf("%d nodes got the users of a, want 1", len(owners))
+	}
+	slices.Sort(owners[0])
+	if !slices.Equal(owners[0], []int64{1, 2}) {
+		t.Fatalf("removing a returned users %v, want [1 2]", owners[0])
+	}
+
+	if expired, err := registry.ExpiredNodes(ctx); err != nil || len(expired) != 0 {
+		t.Fatalf("expired nodes %v (%v) after the removal", expired, err)
+	}
+	// a node coming back under the same id starts empty and learns that its lease lapsed
+	if lapsed, _ := registry.Heartbeat(ctx, "a"); !lapsed {
+		t.Fatal("heartbeat of a removed node did not report its lease lapsed")
+	}
+	expectRoutes(map[int64][]string{1: {"b"}})
+}
+
+func TestMemoryRegistry(t *testing.T) {
+	registry := NewMemoryRegistry()
+	testRegistry(t, registry, func() {
+		registry.mu.Lock()
+		defer registry.mu.Unlock()
+		for nodeId, lease := range registry.leases {
+			registry.leases[nodeId] = lease.Add(-nodeLeaseTTL)
+		}
+	})
+}
+
+func TestRedisRegistry(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	testRegistry(t, NewRedisRegistry(client), func() { server.FastForward(nodeLeaseTTL) })
+}
+
+func TestRedisRegistryLeaseExpires(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	registry := NewRedisRegistry(client)
+	ctx := context.Background()
+
+	registry.Heartbeat(ctx, "a")
+	server.FastForward(nodeLeaseTTL - time.Second)
+	if expired, _ := registry.ExpiredNodes(ctx); len(expired) != 0 {
+		t.Fatalf("lease expired early: %v", expired)
+	}
+	// a heartbeat renews the lease
+	registry.Heartbeat(ctx, "a")
+	server.FastForward(nodeLeaseTTL - time.Second)
+	if expired, _ := registry.ExpiredNodes(ctx); len(expired) != 0 {
+		t.Fatalf("renewed lease expired: %v", expired)
+	}
+	server.FastForward(time.Second)
+	if expired, _ := registry.ExpiredNodes(ctx); !slices.Equal(expired, []string{"a"}) {
+		t.Fatalf("expired nodes %v, want [a]", expired)
+	}
+}
@@ -0,0 +1,298 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/types"
+)
+
+const (
+	// EventSessionResumed follows the replay of the conversations a client resumed on connect,
+	// every message after it is live.
+	EventSessionResumed = "session.resumed"
+
+	// eventReplayDone marks the end of a replay in a connection's queue, it is never written to the socket.
+	eventReplayDone = "replay.done"
+
+	// Messages loaded per query while replaying a conversation.
+	replayPageSize = 200
+
+	// Conversations a client can resume on a single connection.
+	maxResumeConversations = 1000
+)
+
+var ErrInvalidResume = errors.New("resume must list conversation_id:last_seq pairs separated by commas")
+
+// SessionResumed is the payload of the session.resumed event.
+// Conversations holds the sequence number every resumed conversation was replayed up to,
+// the ones the user is not a member of are left out. Replayed counts the messages sent.
+type SessionResumed struct {
+	Conversations map[int64]int64 `json:"conversations"`
+	Replayed      int             `json:"replayed"`
+}
+
+// replayDone is the payload of eventReplayDone, failed is set when the replay stopped early.
+type replayDone struct {
+	conversationId int64
+	failed         bool
+}
+
+// ParseResume reads the resume parameter of the socket handshake, the last sequence number
+// the client has of each conversation, for example "12:40,15:3".
+func ParseResume(value string) (map[int64]int64, error) {
+	resume := make(map[int64]int64)
+	if value == "" {
+		return resume, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		rawId, rawSeq, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, ErrInvalidResume
+		}
+		conversationId, err := strconv.ParseInt(rawId, 10, 64)
+		if err != nil || conversationId <= 0 {
+			return nil, ErrInvalidResume
+		}
+		lastSeq, err := strconv.ParseInt(rawSeq, 10, 64)
+		if err != nil || lastSeq < 0 {
+			return nil, ErrInvalidResume
+		}
+		resume[conversationId] = lastSeq
+	}
+	if len(resume) > maxResumeConversations {
+		return nil, ErrInvalidResume
+	}
+	return resume, nil
+}
+
+// resumeSession runs on the pipeline when a client connects with resume. It replays every message
+// the client is missing in the resumed conversations, one after the other, then tells it the session is live
+// and flushes its pending messages.
+func (h *Hub) resumeSession(client *Client, ctx context.Context) {
+	conversationIds := make([]int64, 0, len(client.resume))
+	for conversationId := range client.resume {
+		conversationIds = append(conversationIds, conversationId)
+	}
+	slices.Sort(conversationIds)
+
+	resumed := &SessionResumed{Conversations: make(map[int64]int64, len(conversationIds))}
+	var resumeNext func(ctx context.Context)
+	resumeNext = func(ctx context.Context) {
+		if len(conversationIds) == 0 {
+			client.stored.push([]*types.SocketEventStruct{newSocketEvent(EventSessionResumed, resumed)}, func(ctx context.Context) {
+				h.flushPendingMessages(client, 0, ctx)
+			})
+			return
+		}
+		conversationId := conversationIds[0]
+		conversationIds = conversationIds[1:]
+		h.replayConversation(&conversationReplay{
+			client:         client,
+			conversationId: conversationId,
+			afterSeq:       client.resume[conversationId],
+			resumed:        resumed,
+			then:           resumeNext,
+		}, ctx)
+	}
+	resumeNext(ctx)
+}
+
+// conversationReplay is the replay of the messages of a conversation numbered after afterSeq to a connection,
+// loaded a page at a time into its backlog.
+type conversationReplay struct {
+	client         *Client
+	conversationId int64
+	afterSeq       int64
+	// resumed collects the outcome when the replay is part of resuming the session
+	resumed *SessionResumed
+	// then runs on the pipeline once the last page was written, it may be nil
+	then func(ctx context.Context)
+}
+
+// replayConversation checks the connection's user is a member of the conversation and starts the replay.
+func (h *Hub) replayConversation(replay *conversationReplay, ctx context.Context) {
+	_, err := h.store.GetConversationMember(ctx, db.GetConversationMemberParams{
+		ConversationID: replay.conversationId,
+		UserID:         replay.client.userId,
+	})
+	if err != nil {
+		log.Printf("Not replaying conversation %d to %d, not a member: %v\n", replay.conversationId, replay.client.userId, err)
+		done := &replayDone{conversationId: replay.conversationId, failed: true}
+		replay.client.stored.push([]*types.SocketEventStruct{newSocketEvent(eventReplayDone, done)}, replay.then)
+		return
+	}
+	h.replayPage(replay, ctx)
+}
+
+// replayPage hands the connection the next page of the replay, the last one is followed by the replay.done
+// marker its writePump waits for.
+func (h *Hub) replayPage(replay *conversationReplay, ctx context.Context) {
+	client := replay.client
+	done := &replayDone{conversationId: replay.conversationId}
+
+	rows, err := h.chatHandler.MessagesAfterSeq(ctx, replay.conversationId, replay.afterSeq, replayPageSize)
+	if err != nil {
+		log.Printf("Unable to replay conversation %d to %d after %d: %v\n", replay.conversationId, client.userId, replay.afterSeq, err)
+		done.failed = true
+		rows = nil
+	}
+
+	events := make([]*types.SocketEventStruct, 0, len(rows)+1)
+	for _, message := range h.messagesFromRows(rows, ctx) {
+		events = append(events, newSocketEvent(EventMessageNew, message))
+		replay.afterSeq = message.Seq
+	}
+	if replay.resumed != nil {
+		replay.resumed.Replayed += len(rows)
+	}
+	if err == nil && len(rows) == replayPageSize {
+		client.stored.push(events, func(ctx context.Context) {
+			h.replayPage(replay, ctx)
+		})
+		return
+	}
+
+	if replay.resumed != nil {
+		replay.resumed.Conversations[replay.conversationId] = replay.afterSeq
+	}
+	client.stored.push(append(events, newSocketEvent(eventReplayDone, done)), replay.then)
+}
+
+// seqTracker keeps the messages of the conversations a connection resumed in sequence order.
+// Messages it already wrote are dropped, and a message arriving before an earlier one is held back
+// until the missing ones are replayed from the database. Other conversations pass through untouched.
+// It is only used by the connection's writePump, a nil tracker passes everything through.
+type seqTracker struct {
+	conversations map[int64]*conversationSeq
+}
+
+type conversationSeq struct {
+	// delivered is the highest sequence number written to the connection, or acknowledged to it as the sender
+	delivered int64
+	// held are the events waiting for an earlier sequence number, nil stands for a message the connection sent
+	held map[int64]*types.SocketEventStruct
+	// filling is set while a replay of the gap is on its way
+	filling bool
+}
+
+// seqGap asks for the messages of a conversation numbered after afterSeq.
+type seqGap struct {
+	conversationId int64
+	afterSeq       int64
+}
+
+func newSeqTracker(resume map[int64]int64) *seqTracker {
+	if len(resume) == 0 {
+		return nil
+	}
+	t := &seqTracker{conversations: make(map[int64]*conversationSeq, len(resume))}
+	for conversationId, lastSeq := range resume {
+		t.conversations[conversationId] = &conversationSeq{
+			delivered: lastSeq,
+			held:      make(map[int64]*types.SocketEventStruct),
+			// the replay of the resume is already on its way
+			filling: true,
+		}
+	}
+	return t
+}
+
+// filter returns the events to write, in order, and the gaps to replay.
+func (t *seqTracker) filter(events []*types.SocketEventStruct) ([]*types.SocketEventStruct, []seqGap) {
+	if t == nil {
+		return events, nil
+	}
+	var ready []*types.SocketEventStruct
+	var gaps []seqGap
+	for _, event := range events {
+		switch payload := event.EventPayload.(type) {
+		case *replayDone:
+			state := t.conversations[payload.conversationId]
+			if state == nil {
+				continue
+			}
+			state.filling = false
+			// after a failure the next message of the conversation asks again
+			if !payload.failed && len(state.held) > 0 {
+				state.filling = true
+				gaps = append(gaps, seqGap{conversationId: payload.conversationId, afterSeq: state.delivered})
+			}
+
+		case *Message:
+			state := t.conversations[payload.ConversationId]
+			if event.EventName != EventMessageNew || state == nil || payload.Seq == 0 {
+				ready = append(ready, event)
+				continue
+			}
+			released, gap := state.add(payload.Seq, event)
+			ready = append(ready, released...)
+			if gap {
+				gaps = append(gaps, seqGap{conversationId: payload.ConversationId, afterSeq: state.delivered})
+			}
+
+		case *MessageAck:
+			// the sender's connection never gets its own message.new, the ack stands for it
+			ready = append(ready, event)
+			state := t.conversations[payload.ConversationId]
+			if state == nil || payload.Seq == 0 {
+				continue
+			}
+			released, gap := state.add(payload.Seq, nil)
+			ready = append(ready, released...)
+			if gap {
+				gaps = append(gaps, seqGap{conversationId: payload.ConversationId, afterSeq: state.delivered})
+			}
+
+		default:
+			ready = append(ready, event)
+		}
+	}
+	return ready, gaps
+}
+
+// add records the event numbered seq and returns the events now in order.
+// It reports a gap when events are held back and no replay is on its way yet.
+func (s *conversationSeq) add(seq int64, event *types.SocketEventStruct) ([]*types.SocketEventStruct, bool) {
+	if seq <= s.delivered {
+		return nil, false
+	}
+	if _, ok := s.held[seq]; ok {
+		// already waiting, or sent by this connection
+		return nil, false
+	}
+	s.held[seq] = event
+
+	var released []*types.SocketEventStruct
+	for {
+		next, ok := s.held[s.delivered+1]
+		if !ok {
+			break
+		}
+		delete(s.held, s.delivered+1)
+		s.delivered++
+		if next != nil {
+			released = append(released, next)
+		}
+	}
+	if len(s.held) == 0 || s.filling {
+		return released, false
+	}
+	s.filling = true
+	return released, true
+}
+
+// replayGaps asks the pipeline for the messages missing before the held ones.
+func (c *Client) replayGaps(gaps []seqGap) {
+	for _, gap := range gaps {
+		gap := gap
+		// the pipeline may be waiting on the shard, which may be waiting on this writePump
+		go c.hub.pipeline.Submit(userKey(c.userId), func(ctx context.Context) {
+			c.hub.replayConversation(&conversationReplay{client: c, conversationId: gap.conversationId, afterSeq: gap.afterSeq}, ctx)
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"tarun-kavipurapu/test-go-chat/db/dbtest"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"tarun-kavipurapu/test-go-chat/types"
+	"testing"
+	"time"
+)
+
+func TestParseResume(t *testing.T) {
+	resume, err := ParseResume("12:40,15:0")
+	if err != nil || len(resume) != 2 || resume[12] != 40 || resume[15] != 0 {
+		t.Fatalf("parsed %v (%v)", resume, err)
+	}
+	if resume, err := ParseResume(""); err != nil || len(resume) != 0 {
+		t.Fatalf("empty resume parsed as %v (%v)", resume, err)
+	}
+	for _, value := range []string{"12", "12:", "a:1", "0:1", "1:-1", "1:2,", "1:2;3:4"} {
+		if _, err := ParseResume(value); err == nil {
+			t.Fatalf("parsed %q", value)
+		}
+	}
+
+	pairs := make([]string, maxResumeConversations+1)
+	for i := range pairs {
+		pairs[i] = fmt.Sprintf("%d:1", i+1)
+	}
+	if _, err := ParseResume(strings.Join(pairs, ",")); err == nil {
+		t.Fatalf("resumed %d conversations", len(pairs))
+	}
+}
+
+// sequence returns the sequence numbers of the messages and acks, in order.
+func sequence(events []*types.SocketEventStruct) []int64 {
+	var seqs []int64
+	for _, event := range events {
+		switch payload := event.EventPayload.(type) {
+		case *Message:
+			seqs = append(seqs, payload.Seq)
+		case *MessageAck:
+			seqs = append(seqs, payload.Seq)
+		}
+	}
+	return seqs
+}
+
+func TestSeqTrackerHoldsMessagesBackUntilTheGapIsReplayed(t *testing.T) {
+	tracker := newSeqTracker(map[int64]int64{5: 10})
+	expect := func(events []*types.SocketEventStruct, wantSeqs []int64, wantGaps []seqGap) {
+		t.Helper()
+		ready, gaps := tracker.filter(events)
+		if !slices.Equal(sequence(ready), wantSeqs) || !slices.Equal(gaps, wantGaps) {
+			t.Fatalf("wrote %v and asked for %v, want %v and %v", sequence(ready), gaps, wantSeqs, wantGaps)
+		}
+	}
+
+	// the replay of the resume is on its way, so a message ahead of it waits without asking again
+	expect([]*types.SocketEventStruct{newMessageEvent(13, 5, 13)}, nil, nil)
+	expect([]*types.SocketEventStruct{newMessageEvent(11, 5, 11), newMessageEvent(12, 5, 12)}, []int64{11, 12, 13}, nil)
+	expect([]*types.SocketEventStruct{newSocketEvent(eventReplayDone, &replayDone{conversationId: 5})}, nil, nil)
+
+	// written already
+	expect([]*types.SocketEventStruct{newMessageEvent(12, 5, 12)}, nil, nil)
+
+	// a live message skipping one asks for the missing one
+	expect([]*types.SocketEventStruct{newMessageEvent(15, 5, 15)}, nil, []seqGap{{conversationId: 5, afterSeq: 13}})
+	expect([]*types.SocketEventStruct{newMessageEvent(16, 5, 16)}, nil, nil)
+	expect([]*types.SocketEventStruct{newMessageEvent(14, 5, 14), newSocketEvent(eventReplayDone, &replayDone{conversationId: 5})}, []int64{14, 15, 16}, nil)
+
+	// the connection's own message is acked instead of delivered, the ack fills its place
+	expect([]*types.SocketEventStruct{newMessageEvent(18, 5, 18)}, nil, []seqGap{{conversationId: 5, afterSeq: 16}})
+	expect([]*types.SocketEventStruct{newSocketEvent(EventMessageAck, &MessageAck{ConversationId: 5, Seq: 17})}, []int64{17, 18}, nil)
+
+	// a failed replay does not ask again by itself, the next message does
+	expect([]*types.SocketEventStruct{newSocketEvent(eventReplayDone, &replayDone{conversationId: 5, failed: true})}, nil, nil)
+	expect([]*types.SocketEventStruct{newMessageEvent(20, 5, 20)}, nil, []seqGap{{conversationId: 5, afterSeq: 18}})
+
+	// other conversations pass through
+	expect([]*types.SocketEventStruct{newMessageEvent(3, 6, 3), newMessageEvent(1, 6, 1)}, []int64{3, 1}, nil)
+}
+
+// replayConn is a database where user 1 is a member of conversation 5, holding messages numbered 1 to the
+// count from user 2, but not of conversation 6. Nothing is pending.
+func replayConn(count *atomic.Int64) *dbtest.Conn {
+	conn := dbtest.NewConn()
+	conn.OnQuery("GetConversationMember", func(args []interface{}) ([][]interface{}, error) {
+		if args[0].(int64) != 5 {
+			return nil, nil
+		}
+		return dbtest.Rows(db.ConversationMember{ConversationID: 5, UserID: args[1].(int64)}), nil
+	})
+	// the ListConversationMessagesAfterSeq arguments are conversation_id, limit and after_seq
+	conn.OnQuery("ListConversationMessagesAfterSeq", func(args []interface{}) ([][]interface{}, error) {
+		return storedMessages(count.Load(), 5, 2, 2, 1)(args)
+	})
+	return conn
+}
+
+func (r *socketReader) expectMessages(t *testing.T, from int64, to int64) {
+	t.Helper()
+	for seq := from; seq <= to; seq++ {
+		event := r.next(t)
+		var message Message
+		json.Unmarshal(event.EventPayload, &message)
+		if event.EventName != EventMessageNew || message.ConversationId != 5 || message.Seq != seq {
+			t.Fatalf("got %s %s, want message %d", event.EventName, event.EventPayload, seq)
+		}
+	}
+}
+
+func TestResumeReplaysMissedMessagesBeforeGoingLive(t *testing.T) {
+	var count atomic.Int64
+	count.Store(450)
+	conn := replayConn(&count)
+	hub := startTestHub(t, conn)
+	reader := &socketReader{socket: dialTestSocket(t, hub, 1, map[int64]int64{5: 10, 6: 0})}
+
+	reader.expectMessages(t, 11, 450)
+	event := reader.next(t)
+	var resumed SessionResumed
+	json.Unmarshal(event.EventPayload, &resumed)
+	if event.EventName != EventSessionResumed || resumed.Replayed != 440 || len(resumed.Conversations) != 1 || resumed.Conversations[5] != 450 {
+		t.Fatalf("got %s %s, want session.resumed of conversation 5 up to 450", event.EventName, event.EventPayload)
+	}
+	if calls := conn.Calls("ListConversationMessagesAfterSeq"); len(calls) != 3 {
+		t.Fatalf("replayed in %d pages, want 3", len(calls))
+	}
+	// the pending messages are flushed once the session is resumed
+	for deadline := time.Now().Add(time.Second); len(conn.Calls("ListPendingMessages")) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("pending messages not loaded after resuming")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// message 451 was stored but its delivery got lost, 452 comes live
+	count.Store(452)
+	hub.publishToConversation(5, []int64{1}, newMessageEvent(452, 5, 452), nil)
+	reader.expectMessages(t, 451, 452)
+
+	hub.publishToConversation(5, []int64{1}, newMessageEvent(453, 5, 453), nil)
+	reader.expectMessages(t, 453, 453)
+}
@@ -5,9 +5,13 @@ import (
 	"log"
 	"net/http"
 	"tarun-kavipurapu/test-go-chat/internal/handlers"
+	"tarun-kavipurapu/test-go-chat/internal/media"
+	"tarun-kavipurapu/test-go-chat/internal/middlewares"
+	"tarun-kavipurapu/test-go-chat/internal/storage"
 	"tarun-kavipurapu/test-go-chat/utils"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
@@ -16,16 +20,86 @@ func SetupRouter(server *Server) *gin.Engine {
 
 	userHandler := handlers.NewUserHandler(server.store)
 	chatHandler := handlers.NewChatHandler(server.store)
-	hub := NewHub(chatHandler, server.store)
+	conversationHandler := handlers.NewConversationHandler(server.store)
+	presence := NewPresence()
+	broker, registry, err := NewClusterFromConfig(server.config)
+	if err != nil {
+		log.Fatal("Failed to connect to the cluster:", err)
+	}
+	policy, err := ParseOverflowPolicy(server.config.SendQueuePolicy)
+	if err != nil {
+		log.Fatal("Invalid send queue configuration:", err)
+	}
+	nodeId := server.config.NodeId
+	if nodeId == "" {
+		nodeId = uuid.NewString()
+	}
+	hub := NewHub(chatHandler, server.store, presence, broker, registry, HubOptions{
+		NodeId:         nodeId,
+		Workers:        server.config.PipelineWorkers,
+		Shards:         server.config.HubShards,
+		SendQueueSize:  server.config.SendQueueSize,
+		OverflowPolicy: policy,
+	})
+	messageHandler := handlers.NewMessageHandler(server.store, chatHandler, hub)
+	blobs, err := storage.NewBlobStoreFromConfig(server.config)
+	if err != nil {
+		log.Fatal("Failed to open the blob store:", err)
+	}
+	processor := media.NewProcessor(server.store, blobs, hub, server.config.MediaWorkers, handlers.MaxAttachmentSize)
+	attachmentHandler := handlers.NewAttachmentHandler(server.store, blobs, processor)
+	directoryHandler := handlers.NewDirectoryHandler(server.store)
+	searchHandler := handlers.NewSearchHandler(server.store)
+	profileHandler := handlers.NewProfileHandler(server.store, blobs, hub)
+	presenceHandler := handlers.NewPresenceHandler(server.store, NewClusterPresence(presence, registry))
 	ctx := context.Background()
 	go hub.Run(ctx)
+	processor.Run(ctx)
 	users := r.Group("/users")
 	{
 
 		users.POST("/login", userHandler.Login)
 		users.POST("/signup", userHandler.Signup)
+		users.GET("/me", middlewares.AuthMiddleware(), profileHandler.GetProfile)
+		users.PATCH("/me", middlewares.AuthMiddleware(), profileHandler.UpdateProfile)
+		users.PUT("/me/photo", middlewares.AuthMiddleware(), profileHandler.UploadPhoto)
+		users.GET("/search", middlewares.AuthMiddleware(), directoryHandler.SearchUsers)
+		users.GET("/blocked", middlewares.AuthMiddleware(), directoryHandler.ListBlockedUsers)
+		users.POST("/:id/block", middlewares.AuthMiddleware(), directoryHandler.BlockUser)
+		users.DELETE("/:id/block", middlewares.AuthMiddleware(), directoryHandler.UnblockUser)
+		users.GET("/presence", middlewares.AuthMiddleware(), presenceHandler.GetBulkPresence)
+		users.GET("/:id/presence", middlewares.AuthMiddleware(), presenceHandler.GetPresence)
+		users.GET("/:id/photo/:name", profileHandler.GetPhoto)
 
 	}
+	conversations := r.Group("/conversations", middlewares.AuthMiddleware())
+	{
+		conversations.GET("", conversationHandler.ListConversations)
+		conversations.POST("", conversationHandler.CreateGroup)
+		conversations.PATCH("/:id", conversationHandler.RenameGroup)
+		conversations.POST("/:id/leave", conversationHandler.LeaveGroup)
+		conversations.POST("/:id/members", conversationHandler.AddMembers)
+		conversations.DELETE("/:id/members/:userId", conversationHandler.RemoveMember)
+		conversations.GET("/:id/messages", chatHandler.GetConversationMessages)
+	}
+	messages := r.Group("/messages", middlewares.AuthMiddleware())
+	{
+		messages.GET("/direct/:userId", chatHandler.GetDirectMessages)
+		messages.PATCH("/:id", messageHandler.EditMessage)
+		messages.DELETE("/:id", messageHandler.DeleteMessage)
+		messages.GET("/:id/edits", messageHandler.GetMessageEdits)
+		messages.GET("/:id/thread", chatHandler.GetThread)
+	}
+	search := r.Group("/search", middlewares.AuthMiddleware())
+	{
+		search.GET("/messages", searchHandler.SearchMessages)
+	}
+	attachments := r.Group("/attachments", middlewares.AuthMiddleware())
+	{
+		attachments.POST("", attachmentHandler.UploadAttachment)
+		attachments.GET("/:id", attachmentHandler.GetAttachment)
+		attachments.GET("/:id/thumbnails/:size", attachmentHandler.GetThumbnail)
+	}
 	r.GET("/ws", func(c *gin.Context) {
 		var upgrader = websocket.Upgrader{
 			ReadBufferSize:  1024,
@@ -53,6 +127,13 @@ func SetupRouter(server *Server) *gin.Engine {
 
 			return
 		}
+		// conversations the client resumes, with the last sequence number it has of each
+		resume, err := ParseResume(c.Query("resume"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		connection, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 		if err != nil {
 			log.Println(err)
@@ -61,7 +142,7 @@ func SetupRouter(server *Server) *gin.Engine {
 
 		// Upgrading the HTTP connection to a WebSocket connection
 		// Call the handler to create a new WebSocket user
-		CreateNewSocketUser(hub, connection, user.ID)
+		CreateNewSocketUser(hub, connection, user.ID, resume)
 	})
 
 	return r
@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"expvar"
+	"fmt"
+	"log"
+	"tarun-kavipurapu/test-go-chat/types"
+)
+
+// Events a connection can have waiting for its writePump when the configuration does not set SEND_QUEUE_SIZE.
+const defaultSendQueueSize = 256
+
+// OverflowPolicy decides what happens to an event for a connection whose send queue is full.
+type OverflowPolicy string
+
+const (
+	// OverflowDisconnect closes the slow connection, the client reconnects and gets its pending messages.
+	OverflowDisconnect OverflowPolicy = "disconnect"
+	// OverflowDropOldest makes room by discarding the oldest queued event.
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+	// OverflowSpill leaves stored messages pending in the database and delivers them from there
+	// once the queue drained, other events are discarded. Clients must ignore message ids they already have.
+	// A message another device of the user already received is no longer pending and is only found in the history.
+	OverflowSpill OverflowPolicy = "spill"
+)
+
+// ParseOverflowPolicy reads SEND_QUEUE_POLICY, an empty value selects OverflowDisconnect.
+func ParseOverflowPolicy(value string) (OverflowPolicy, error) {
+	switch policy := OverflowPolicy(value); policy {
+	case "":
+		return OverflowDisconnect, nil
+	case OverflowDisconnect, OverflowDropOldest, OverflowSpill:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown send queue policy %q", value)
+	}
+}
+
+// Send queue metrics, published with every other expvar at /debug/vars of the metrics listener, see Server.Start.
+var (
+	// events waiting in the send queues of all connections
+	sendQueueDepth = expvar.NewInt("send_queue_depth")
+	// deepest queue a connection reached
+	sendQueuePeak = expvar.NewInt("send_queue_peak")
+	// events discarded or left pending because a queue was full, by policy
+	sendQueueDrops = expvar.NewMap("send_queue_drops")
+	// connections closed because their queue was full
+	sendQueueDisconnects = expvar.NewInt("send_queue_disconnects")
+)
+
+// enqueue puts the event on the connection's send queue and reports false when the queue is full.
+func (c *Client) enqueue(event *types.SocketEventStruct) bool {
+	select {
+	case c.sendTo <- event:
+		sendQueueDepth.Add(1)
+		if depth := int64(len(c.sendTo)); depth > sendQueuePeak.Value() {
+			sendQueuePeak.Set(depth)
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// dequeued records that the writePump took an event off the queue.
+func (c *Client) dequeued() {
+	sendQueueDepth.Add(-1)
+}
+
+// overflow applies the shard's policy to an event that did not fit in the connection's send queue.
+func (s *hubShard) overflow(client *Client, event *types.SocketEventStruct) {
+	switch s.policy {
+	case OverflowDropOldest:
+		sendQueueDrops.Add(string(OverflowDropOldest), 1)
+		select {
+		case <-client.sendTo:
+			client.dequeued()
+		default:
+			// the writePump emptied the queue meanwhile
+		}
+		// only this shard sends to the queue, so the room made above is still there
+		client.enqueue(event)
+		log.Printf("Dropped the oldest queued event of client %d\n", client.userId)
+
+	case OverflowSpill:
+		sendQueueDrops.Add(string(OverflowSpill), 1)
+		if message, ok := event.EventPayload.(*Message); ok && event.EventName == EventMessageNew && message.Id != 0 {
+			// the message stays pending for this user, the writePump reloads it once the queue drained
+			client.spilled.Store(true)
+		}
+		log.Printf("Spilled %s for client %d\n", event.EventName, client.userId)
+
+	default:
+		sendQueueDisconnects.Add(1)
+		s.removeClient(client)
+		log.Printf("Closed channel and removed client due to full send queue: %d\n", client.userId)
+	}
+}
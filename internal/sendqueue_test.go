@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"tarun-kavipurapu/test-go-chat/db/dbtest"
+	"testing"
+)
+
+func TestParseOverflowPolicy(t *testing.T) {
+	for value, want := range map[string]OverflowPolicy{"": OverflowDisconnect, "drop_oldest": OverflowDropOldest, "spill": OverflowSpill} {
+		if policy, err := ParseOverflowPolicy(value); err != nil || policy != want {
+			t.Fatalf("%q parsed as %q (%v), want %q", value, policy, err, want)
+		}
+	}
+	if _, err := ParseOverflowPolicy("block"); err == nil {
+		t.Fatal("parsed an unknown policy")
+	}
+}
+
+// fullShard returns a shard applying the policy with a registered connection whose queue of two events is full.
+func fullShard(policy OverflowPolicy) (*hubShard, *Client) {
+	hub := newTestHub(dbtest.NewConn())
+	hub.sendQueueSize = 2
+	shard := newHubShard(0, policy)
+	client := newTestClient(hub, 1)
+	shard.HandleUserRegisterEvent(client)
+	for id := int64(1); id <= 2; id++ {
+		shard.HandleDelivery(&BrokerEnvelope{UserIds: []int64{1}, Event: newMessageEvent(id, 1, id)})
+	}
+	return shard, client
+}
+
+func TestOverflowDisconnect(t *testing.T) {
+	shard, client := fullShard(OverflowDisconnect)
+	disconnects := sendQueueDisconnects.Value()
+
+	shard.HandleDelivery(&BrokerEnvelope{UserIds: []int64{1}, Event: newMessageEvent(3, 1, 3)})
+
+	if ids := messageIds(queued(client)); len(ids) != 2 {
+		t.Fatalf("queue held %v, want the two events before the overflow", ids)
+	}
+	if _, ok := <-client.sendTo; ok {
+		t.Fatal("the queue of the slow connection is still open")
+	}
+	if len(shard.clients) != 0 || sendQueueDisconnects.Value() != disconnects+1 {
+		t.Fatal("the slow connection was not removed")
+	}
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	shard, client := fullShard(OverflowDropOldest)
+
+	shard.HandleDelivery(&BrokerEnvelope{UserIds: []int64{1}, Event: newMessageEvent(3, 1, 3)})
+	shard.HandleDelivery(&BrokerEnvelope{UserIds: []int64{1}, Event: newMessageEvent(4, 1, 4)})
+
+	if ids := messageIds(queued(client)); len(ids) != 2 || ids[0] != 3 || ids[1] != 4 {
+		t.Fatalf("queue held %v, want [3 4]", ids)
+	}
+	if len(shard.clients) != 1 {
+		t.Fatal("the connection was removed")
+	}
+}
+
+func TestOverflowSpill(t *testing.T) {
+	shard, client := fullShard(OverflowSpill)
+
+	// other events are discarded without a reload
+	shard.HandleDelivery(&BrokerEnvelope{UserIds: []int64{1}, Event: newSocketEvent(EventPong, nil)})
+	if client.spilled.Load() {
+		t.Fatal("a pong marked the connection spilled")
+	}
+	shard.HandleDelivery(&BrokerEnvelope{UserIds: []int64{1}, Event: newMessageEvent(3, 1, 3)})
+	if !client.spilled.Load() {
+		t.Fatal("a stored message was dropped without marking the connection spilled")
+	}
+	if ids := messageIds(queued(client)); len(ids) != 2 {
+		t.Fatalf("queue held %v, want the two events before the overflow", ids)
+	}
+}
+
+func TestSpilledMessagesAreReloaded(t *testing.T) {
+	conn := dbtest.NewConn()
+	// message 3 stayed pending, the ListPendingMessages arguments are user_id, limit and after_id
+	conn.OnQuery("ListPendingMessages", storedMessages(3, 1, 2, 2, 1))
+	hub := startTestHub(t, conn)
+	client := newTestClient(hub, 1)
+	client.enqueue(newMessageEvent(1, 1, 1))
+	client.spilled.Store(true)
+
+	// nothing is reloaded while the queue still holds events
+	client.reloadSpilled()
+	if !client.spilled.Load() {
+		t.Fatal("reloaded before the queue drained")
+	}
+	queued(client)
+	client.reloadSpilled()
+	if client.spilled.Load() {
+		t.Fatal("not reloaded once the queue drained")
+	}
+
+	if ids := messageIds(writeBacklog(t, client)); len(ids) != 3 {
+		t.Fatalf("reloaded %v, want the 3 pending messages", ids)
+	}
+	if calls := conn.Calls("ListPendingMessages"); len(calls) != 1 || calls[0][2].(int64) != 0 {
+		t.Fatalf("pending messages loaded with %v", calls)
+	}
+}
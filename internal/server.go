@@ -1,7 +1,9 @@
 package internal
 
 import (
+	"expvar"
 	"log"
+	"net/http"
 	"os"
 	"path/filepath"
 	"tarun-kavipurapu/test-go-chat/config"
@@ -13,16 +15,30 @@ import (
 )
 
 type Server struct {
-	store db.Store
+	config config.Config
+	store  db.Store
 	// store  *db.SQLStore
 	router *gin.Engine
 }
 
 // runs on a specific address
 func (s *Server) Start(address string) error {
+	if s.config.MetricsAddr != "" {
+		go s.serveMetrics(s.config.MetricsAddr)
+	}
 	return s.router.Run(address)
 }
 
+// serveMetrics exposes the expvar metrics on their own listener, apart from the public router,
+// as they reveal the process command line and memory along with the hub's counters.
+func (s *Server) serveMetrics(address string) {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	if err := http.ListenAndServe(address, mux); err != nil {
+		log.Println("Metrics listener stopped:", err)
+	}
+}
+
 func NewHTTPServer() *Server {
 	router := gin.Default()
 
@@ -53,7 +69,7 @@ func NewHTTPServer() *Server {
 	// ctx := context.Background()
 
 	server := &Server{
-
+		config: cfg,
 		router: router,
 		store:  store,
 	}
@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"log"
+	"tarun-kavipurapu/test-go-chat/types"
+)
+
+// hubShard owns the connections of the users that hash to it and runs their event loop.
+// Shards never send to each other, so an event for users on several shards is split by Hub.deliverLocal
+// before it reaches them.
+type hubShard struct {
+	id         int
+	policy     OverflowPolicy
+	clients    map[int64]map[*Client]bool
+	register   chan *Client
+	unregister chan *Client
+	deliveries chan *BrokerEnvelope
+	replies    chan *clientEvent
+}
+
+func newHubShard(id int, policy OverflowPolicy) *hubShard {
+	return &hubShard{
+		id:         id,
+		policy:     policy,
+		clients:    make(map[int64]map[*Client]bool),
+		register:   make(chan *Client),
+		unregister: make(chan *Client),
+		deliveries: make(chan *BrokerEnvelope),
+		replies:    make(chan *clientEvent),
+	}
+}
+
+// run handles the registration, unregistration and delivery of events for the shard's connections.
+func (s *hubShard) run() {
+	for {
+		select {
+		case client := <-s.register:
+			s.HandleUserRegisterEvent(client)
+
+		case client := <-s.unregister:
+			s.HandleUserDisconnectEvent(client)
+
+		case envelope := <-s.deliveries:
+			s.HandleDelivery(envelope)
+
+		case reply := <-s.replies:
+			s.sendToClient(reply.client, reply.event)
+		}
+	}
+}
+
+// HandleUserRegisterEvent handles the user registration event.
+func (s *hubShard) HandleUserRegisterEvent(client *Client) {
+
+	connections, ok := s.clients[client.userId]
+	if !ok {
+		connections = make(map[*Client]bool)
+		s.clients[client.userId] = connections
+	}
+	connections[client] = true
+	// Log client registration
+	log.Printf("Registered client: %d (%d connections) on shard %d\n", client.userId, len(connections), s.id)
+}
+
+// HandleUserDisconnectEvent handles the user disconnection event.
+func (s *hubShard) HandleUserDisconnectEvent(client *Client) {
+	if s.removeClient(client) {
+		// Log client unregistration
+		log.Printf("Unregistered client: %d\n", client.userId)
+	}
+}
+
+// HandleDelivery delivers an envelope to the connections of its users, which all belong to this shard.
+func (s *hubShard) HandleDelivery(envelope *BrokerEnvelope) {
+	for _, userId := range envelope.UserIds {
+		s.sendToUser(userId, envelope.Event, envelope.ExcludeClient)
+	}
+}
+
+// removeClient drops a single connection of a user and closes its send channel.
+// It reports false when the connection was already removed.
+func (s *hubShard) removeClient(client *Client) bool {
+	connections, ok := s.clients[client.userId]
+	if !ok || !connections[client] {
+		return false
+	}
+	delete(connections, client)
+	if len(connections) == 0 {
+		delete(s.clients, client.userId)
+	}
+	close(client.sendTo)
+	return true
+}
+
+// sendToUser delivers an event to every connection of the user except the excluded one.
+func (s *hubShard) sendToUser(userId int64, event *types.SocketEventStruct, excludeId string) {
+	for client := range s.clients[userId] {
+		if excludeId != "" && client.id == excludeId {
+			continue
+		}
+		s.sendToClient(client, event)
+	}
+}
+
+// sendToClient queues an event for a single connection, the overflow policy handles a full queue.
+func (s *hubShard) sendToClient(client *Client, event *types.SocketEventStruct) {
+	connections, ok := s.clients[client.userId]
+	if !ok || !connections[client] {
+		return
+	}
+	if client.enqueue(event) {
+		log.Printf("Sent %s to client: %d\n", event.EventName, client.userId)
+		return
+	}
+	s.overflow(client, event)
+}
@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"fmt"
+	"sync/atomic"
+	"tarun-kavipurapu/test-go-chat/db/dbtest"
+	"tarun-kavipurapu/test-go-chat/internal/handlers"
+	"tarun-kavipurapu/test-go-chat/types"
+	"testing"
+	"time"
+)
+
+// queued takes the events waiting in the connection's send queue.
+func queued(client *Client) []*types.SocketEventStruct {
+	var events []*types.SocketEventStruct
+	for {
+		select {
+		case event, ok := <-client.sendTo:
+			if !ok {
+				return events
+			}
+			client.dequeued()
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestShardDeliversToEveryDevice(t *testing.T) {
+	hub := newTestHub(dbtest.NewConn())
+	shard := newHubShard(0, OverflowDisconnect)
+	phone, laptop, other := newTestClient(hub, 1), newTestClient(hub, 1), newTestClient(hub, 2)
+	for _, client := range []*Client{phone, laptop, other} {
+		shard.HandleUserRegisterEvent(client)
+	}
+
+	shard.HandleDelivery(&BrokerEnvelope{UserIds: []int64{1}, Event: newMessageEvent(1, 1, 1)})
+	if len(queued(phone)) != 1 || len(queued(laptop)) != 1 || len(queued(other)) != 0 {
+		t.Fatal("the message must reach both devices of user 1 and nobody else")
+	}
+
+	// the device a message was sent from gets an ack instead of the message
+	shard.HandleDelivery(&BrokerEnvelope{UserIds: []int64{1}, ExcludeClient: phone.id, Event: newMessageEvent(2, 1, 2)})
+	if len(queued(phone)) != 0 || len(queued(laptop)) != 1 {
+		t.Fatal("the excluded connection got the event")
+	}
+}
+
+func TestShardKeepsOtherDevicesOnDisconnect(t *testing.T) {
+	hub := newTestHub(dbtest.NewConn())
+	shard := newHubShard(0, OverflowDisconnect)
+	phone, laptop := newTestClient(hub, 1), newTestClient(hub, 1)
+	shard.HandleUserRegisterEvent(phone)
+	shard.HandleUserRegisterEvent(laptop)
+
+	shard.HandleUserDisconnectEvent(phone)
+	if _, ok := <-phone.sendTo; ok {
+		t.Fatal("the send channel of the disconnected device is still open")
+	}
+	// a second unregistration of the same connection is harmless
+	shard.HandleUserDisconnectEvent(phone)
+
+	shard.HandleDelivery(&BrokerEnvelope{UserIds: []int64{1}, Event: newMessageEvent(1, 1, 1)})
+	if len(queued(laptop)) != 1 {
+		t.Fatal("the remaining device lost its delivery")
+	}
+	if len(shard.clients[1]) != 1 {
+		t.Fatalf("%d connections left for user 1, want 1", len(shard.clients[1]))
+	}
+}
+
+// BenchmarkShardFanOut measures how fast the shards hand group messages to the connections of 256 members,
+// with the deliveries coming from several goroutines like the pipeline workers. Nothing touches the database.
+func BenchmarkShardFanOut(b *testing.B) {
+	const members = 256
+	memberIds := make([]int64, members)
+	for i := range memberIds {
+		memberIds[i] = int64(i + 1)
+	}
+	for _, shards := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			discardLogs(b)
+			store := dbtest.NewStore(dbtest.NewConn())
+			hub := runTestHub(b, NewHub(handlers.NewChatHandler(store), store, NewPresence(), NewMemoryBroker(), NewMemoryRegistry(), HubOptions{
+				NodeId:        "node",
+				Shards:        shards,
+				SendQueueSize: 1 << 14,
+			}))
+			var received atomic.Int64
+			for _, memberId := range memberIds {
+				drainTestClient(b, connectTestClient(hub, memberId), &received)
+			}
+			event := newMessageEvent(1, 5, 1)
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					hub.deliverLocal(&BrokerEnvelope{UserIds: memberIds, ConversationId: 5, Event: event})
+				}
+			})
+			for received.Load() < int64(b.N*members) && !b.Failed() {
+				time.Sleep(time.Millisecond)
+			}
+			b.ReportMetric(float64(b.N*members)/b.Elapsed().Seconds(), "deliveries/s")
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"tarun-kavipurapu/test-go-chat/config"
+	"time"
+)
+
+// ErrNotFound is returned when no blob is stored under a key.
+var ErrNotFound = errors.New("blob not found")
+
+// ErrSignedURLUnsupported is returned by stores that cannot hand out download URLs,
+// their blobs are streamed through Open instead.
+var ErrSignedURLUnsupported = errors.New("blob store does not sign urls")
+
+// BlobStore keeps the content of uploaded files under keys chosen by the caller.
+type BlobStore interface {
+	// Put stores size bytes read from body under key, replacing what was there.
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Open returns the content stored under key, the caller closes it.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a temporary URL to download the blob directly from the store,
+	// which answers with the headers of download instead of the ones stored with the blob.
+	SignedURL(ctx context.Context, key string, expiry time.Duration, download Download) (string, error)
+}
+
+// Download holds the headers a blob is served with.
+type Download struct {
+	ContentType        string
+	ContentDisposition string
+}
+
+// NewBlobStoreFromConfig returns the store named by BLOB_STORE, the local filesystem when it is empty.
+func NewBlobStoreFromConfig(cfg config.Config) (BlobStore, error) {
+	switch cfg.BlobStore {
+	case "", "local":
+		return NewLocalStore(cfg.BlobDir)
+	case "s3":
+		return NewS3Store(context.Background(), S3Options{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.AWS_REGION,
+			Bucket:    cfg.AWS_BUCKET_NAME,
+			AccessKey: cfg.AWS_ACCESS_TOKEN,
+			SecretKey: cfg.AWS_SECRET_TOKEN_KEY,
+			Insecure:  cfg.S3Insecure,
+		})
+	default:
+		return nil, fmt.Errorf("unknown blob store %q", cfg.BlobStore)
+	}
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+func TestSignedURLOverridesResponseHeaders(t *testing.T) {
+	// with the region known presigning happens offline
+	client, err := minio.New("s3.example", &minio.Options{
+		Creds:  credentials.NewStaticV4("access", "secret", ""),
+		Secure: true,
+		Region: "us-east-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &S3Store{client: client, bucket: "chat"}
+
+	signed, err := store.SignedURL(context.Background(), "attachments/page", time.Minute, Download{
+		ContentType:        "text/html",
+		ContentDisposition: "attachment; filename=page.html",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("response-content-type") != "text/html" {
+		t.Fatalf("signed url %s does not force the content type", signed)
+	}
+	if query.Get("response-content-disposition") != "attachment; filename=page.html" {
+		t.Fatalf("signed url %s does not force the disposition", signed)
+	}
+	if query.Get("X-Amz-Signature") == "" {
+		t.Fatalf("url %s is not signed", signed)
+	}
+}
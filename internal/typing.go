@@ -0,0 +1,270 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"slices"
+	"tarun-kavipurapu/test-go-chat/internal/handlers"
+	"tarun-kavipurapu/test-go-chat/types"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	EventTypingStart = "typing.start"
+	EventTypingStop  = "typing.stop"
+
+	// A typing indicator expires when the client does not refresh it within this period.
+	typingTimeout = 5 * time.Second
+
+	// Minimum time between two forwarded typing.start events of a connection for the same conversation.
+	typingThrottle = time.Second
+
+	// Maximum typing events a connection may send per second, across all conversations.
+	typingBurst = 5
+)
+
+var (
+	errTypingUserNotFound = &SocketError{Code: ErrorCodeUserNotFound, Message: "Recipient is not registered"}
+	errTypingNotMember    = &SocketError{Code: ErrorCodeConversationNotFound, Message: "Conversation not found or you are not a member"}
+)
+
+// Typing is the payload of the typing.start and typing.stop events, it is never persisted.
+// Clients address it like a message, with To for a direct conversation or with ConversationId.
+type Typing struct {
+	ConversationId int64 `json:"conversation_id,omitempty"`
+	To             int64 `json:"to,omitempty"`
+	UserId         int64 `json:"user_id"`
+
+	// stop is set for typing.stop, sender is the connection it came from and
+	// recipients are resolved on the pipeline before a typing.start reaches the typing goroutine
+	stop       bool
+	sender     *Client
+	recipients []int64
+}
+
+// typingKey identifies one user typing in one conversation.
+type typingKey struct {
+	conversationId int64
+	to             int64
+	userId         int64
+}
+
+// typingState is the indicator the typing goroutine keeps alive until it is stopped or expires.
+type typingState struct {
+	key        typingKey
+	recipients []int64
+	timer      *time.Timer
+}
+
+// typingLimiter throttles the typing events of a single connection.
+// It is only used from the connection's readPump goroutine.
+type typingLimiter struct {
+	lastStart   map[typingKey]time.Time
+	windowStart time.Time
+	count       int
+}
+
+// allow reports whether the typing event should reach the hub.
+func (l *typingLimiter) allow(key typingKey, stop bool, now time.Time) bool {
+	if now.Sub(l.windowStart) >= time.Second {
+		l.windowStart = now
+		l.count = 0
+	}
+	if l.count >= typingBurst {
+		return false
+	}
+
+	if stop {
+		// a stop is only useful after a start went through
+		if _, ok := l.lastStart[key]; !ok {
+			return false
+		}
+		delete(l.lastStart, key)
+	} else {
+		if last, ok := l.lastStart[key]; ok && now.Sub(last) < typingThrottle {
+			return false
+		}
+		if l.lastStart == nil {
+			l.lastStart = make(map[typingKey]time.Time)
+		}
+		l.lastStart[key] = now
+	}
+
+	l.count++
+	return true
+}
+
+func (h *Hub) onTypingStart(c *Client, event *types.SocketEventRequest) error {
+	return h.handleTypingEvent(c, event, false)
+}
+
+func (h *Hub) onTypingStop(c *Client, event *types.SocketEventRequest) error {
+	return h.handleTypingEvent(c, event, true)
+}
+
+func (h *Hub) handleTypingEvent(c *Client, event *types.SocketEventRequest, stop bool) error {
+	var typing Typing
+	if err := json.Unmarshal(event.EventPayload, &typing); err != nil {
+		return errInvalidPayload
+	}
+	if (typing.ConversationId == 0) == (typing.To == 0) {
+		return &SocketError{Code: ErrorCodeInvalidPayload, Message: "Typing needs either a conversation_id or a to"}
+	}
+	if typing.ConversationId != 0 {
+		typing.To = 0
+	}
+	typing.UserId = c.userId
+	typing.stop = stop
+	typing.sender = c
+
+	// dropped events are not errors, the indicator is refreshed by the next one anyway
+	if !c.typing.allow(typing.key(), stop, time.Now()) {
+		return nil
+	}
+	// stops share the worker of their starts so they can never overtake them
+	h.pipeline.Submit(h.addressKey(c, typing.To, typing.ConversationId), func(ctx context.Context) {
+		h.resolveTyping(&typing, ctx)
+	})
+	return nil
+}
+
+// resolveTyping looks up who should see a typing.start and hands the event to the typing goroutine.
+func (h *Hub) resolveTyping(typing *Typing, ctx context.Context) {
+	if !typing.stop {
+		recipients, err := h.typingRecipients(typing, ctx)
+		var socketErr *SocketError
+		if errors.As(err, &socketErr) {
+			h.replyError(typing.sender, socketErr, "")
+			return
+		}
+		if err != nil {
+			log.Printf("Unable to relay typing of %d: %v\n", typing.UserId, err)
+			h.replyError(typing.sender, &SocketError{Code: ErrorCodeServerError, Message: "Unable to relay typing"}, "")
+			return
+		}
+		typing.recipients = recipients
+	}
+	h.typing <- typing
+}
+
+// runTyping owns the typing indicators and their expiry timers until ctx is done.
+func (h *Hub) runTyping(ctx context.Context) {
+	for {
+		select {
+		case typing := <-h.typing:
+			h.HandleTypingEvent(typing, ctx)
+		case state := <-h.typingExpired:
+			h.HandleTypingExpired(state)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (t *Typing) key() typingKey {
+	return typingKey{conversationId: t.ConversationId, to: t.To, userId: t.UserId}
+}
+
+// HandleTypingEvent relays a typing indicator to the other participants and keeps its expiry timer.
+func (h *Hub) HandleTypingEvent(typing *Typing, ctx context.Context) {
+	key := typing.key()
+	state, active := h.typingStates[key]
+
+	if typing.stop {
+		if active {
+			h.stopTyping(state)
+		}
+		return
+	}
+
+	if active {
+		state.timer.Reset(typingTimeout)
+		state.recipients = typing.recipients
+	} else {
+		state = &typingState{key: key, recipients: typing.recipients}
+		state.timer = time.AfterFunc(typingTimeout, func() { h.expireTyping(state, ctx) })
+		h.typingStates[key] = state
+	}
+
+	h.publishToUsers(state.recipients, newSocketEvent(EventTypingStart, typing), nil)
+}
+
+// expireTyping hands an indicator whose timer fired back to the typing goroutine, unless the hub has stopped.
+func (h *Hub) expireTyping(state *typingState, ctx context.Context) {
+	select {
+	case h.typingExpired <- state:
+	case <-ctx.Done():
+	}
+}
+
+// HandleTypingExpired stops an indicator the client did not refresh in time.
+func (h *Hub) HandleTypingExpired(state *typingState) {
+	// the indicator may have been stopped or replaced after the timer fired
+	if h.typingStates[state.key] != state {
+		return
+	}
+	h.stopTyping(state)
+}
+
+func (h *Hub) stopTyping(state *typingState) {
+	state.timer.Stop()
+	delete(h.typingStates, state.key)
+
+	h.publishToUsers(state.recipients, newSocketEvent(EventTypingStop, &Typing{
+		ConversationId: state.key.conversationId,
+		To:             state.key.to,
+		UserId:         state.key.userId,
+	}), nil)
+}
+
+// typingRecipients returns who should see the indicator, checking that the typist shares the conversation with them.
+// A direct conversation is found like the message path finds it, but never created by typing.
+func (h *Hub) typingRecipients(typing *Typing, ctx context.Context) ([]int64, error) {
+	if typing.To != 0 {
+		key := pgtype.Text{String: handlers.DirectKey(typing.UserId, typing.To), Valid: true}
+		_, err := h.store.GetDirectConversation(ctx, key)
+		if err == nil {
+			return []int64{typing.To}, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		// nothing was sent between them yet, typing is still fine between members of a group
+		if _, err := h.store.GetUserById(ctx, typing.To); errors.Is(err, pgx.ErrNoRows) {
+			return nil, errTypingUserNotFound
+		} else if err != nil {
+			return nil, err
+		}
+		peerIds, err := h.store.ListPeerIds(ctx, typing.UserId)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(peerIds, typing.To) {
+			return nil, errTypingNotMember
+		}
+		return []int64{typing.To}, nil
+	}
+
+	memberIds, err := h.store.ListConversationMemberIds(ctx, typing.ConversationId)
+	if err != nil {
+		return nil, err
+	}
+	recipients := make([]int64, 0, len(memberIds))
+	isMember := false
+	for _, memberId := range memberIds {
+		if memberId == typing.UserId {
+			isMember = true
+			continue
+		}
+		recipients = append(recipients, memberId)
+	}
+	if !isMember {
+		return nil, errTypingNotMember
+	}
+	return recipients, nil
+}
@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"context"
+	"slices"
+	"tarun-kavipurapu/test-go-chat/db/dbtest"
+	db "tarun-kavipurapu/test-go-chat/db/sqlc"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestTypingLimiterThrottlesStarts(t *testing.T) {
+	var limiter typingLimiter
+	key := typingKey{conversationId: 5, userId: 1}
+	now := time.Now()
+
+	if limiter.allow(key, true, now) {
+		t.Fatal("a stop without a start went through")
+	}
+	if !limiter.allow(key, false, now) {
+		t.Fatal("the first start was dropped")
+	}
+	if limiter.allow(key, false, now.Add(typingThrottle/2)) {
+		t.Fatal("a start within the throttle went through")
+	}
+	if !limiter.allow(key, false, now.Add(typingThrottle)) {
+		t.Fatal("a start after the throttle was dropped")
+	}
+	if !limiter.allow(key, true, now.Add(typingThrottle)) {
+		t.Fatal("the stop after a start was dropped")
+	}
+}
+
+func TestTypingLimiterCapsBurst(t *testing.T) {
+	var limiter typingLimiter
+	now := time.Now()
+	for i := 0; i < typingBurst; i++ {
+		if !limiter.allow(typingKey{conversationId: int64(i + 1)}, false, now) {
+			t.Fatalf("start %d dropped within the burst", i)
+		}
+	}
+	if limiter.allow(typingKey{conversationId: 100}, false, now) {
+		t.Fatal("start past the burst went through")
+	}
+	if !limiter.allow(typingKey{conversationId: 100}, false, now.Add(time.Second)) {
+		t.Fatal("the burst did not reset after a second")
+	}
+}
+
+// typingConn is a database where users 1 and 2 have a direct conversation, 1 and 3 only share group 5
+// and user 4 shares nothing with anyone. Users above 4 do not exist.
+func typingConn() *dbtest.Conn {
+	conn := dbtest.NewConn()
+	conn.OnQuery("GetDirectConversation", func(args []interface{}) ([][]interface{}, error) {
+		if args[0].(pgtype.Text).String == "1:2" {
+			return dbtest.Rows(db.Conversation{ID: 9, DirectKey: args[0].(pgtype.Text)}), nil
+		}
+		return nil, nil
+	})
+	conn.OnQuery("GetUserById", func(args []interface{}) ([][]interface{}, error) {
+		if args[0].(int64) > 4 {
+			return nil, nil
+		}
+		return dbtest.Rows(db.User{ID: args[0].(int64)}), nil
+	})
+	conn.OnQuery("ListPeerIds", func(args []interface{}) ([][]interface{}, error) {
+		if args[0].(int64) == 1 {
+			return [][]interface{}{{int64(2)}, {int64(3)}}, nil
+		}
+		return nil, nil
+	})
+	conn.OnQuery("ListConversationMemberIds", func(args []interface{}) ([][]interface{}, error) {
+		return [][]interface{}{{int64(1)}, {int64(3)}}, nil
+	})
+	return conn
+}
+
+func TestTypingRecipients(t *testing.T) {
+	hub := newTestHub(typingConn())
+	ctx := context.Background()
+
+	for _, typing := range []*Typing{{UserId: 1, To: 2}, {UserId: 2, To: 1}, {UserId: 1, To: 3}} {
+		recipients, err := hub.typingRecipients(typing, ctx)
+		if err != nil || !slices.Equal(recipients, []int64{typing.To}) {
+			t.Fatalf("%d typing to %d reaches %v (%v)", typing.UserId, typing.To, recipients, err)
+		}
+	}
+	recipients, err := hub.typingRecipients(&Typing{UserId: 3, ConversationId: 5}, ctx)
+	if err != nil || !slices.Equal(recipients, []int64{1}) {
+		t.Fatalf("typing in group 5 reaches %v (%v), want [1]", recipients, err)
+	}
+
+	_, err = hub.typingRecipients(&Typing{UserId: 1, To: 7}, ctx)
+	expectSocketError(t, err, ErrorCodeUserNotFound)
+	_, err = hub.typingRecipients(&Typing{UserId: 1, To: 4}, ctx)
+	expectSocketError(t, err, ErrorCodeConversationNotFound)
+	_, err = hub.typingRecipients(&Typing{UserId: 4, ConversationId: 5}, ctx)
+	expectSocketError(t, err, ErrorCodeConversationNotFound)
+}
+
+func TestTypingToStrangerIsRefused(t *testing.T) {
+	hub := startTestHub(t, typingConn())
+	typist, stranger := connectTestClient(hub, 1), connectTestClient(hub, 4)
+
+	hub.resolveTyping(&Typing{UserId: 1, To: 4, sender: typist}, context.Background())
+	if event := nextEvent(t, typist); event.EventName != EventError {
+		t.Fatalf("typist got %s, want an error", event.EventName)
+	}
+	select {
+	case event := <-stranger.sendTo:
+		t.Fatalf("stranger got %s", event.EventName)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestTypingExpiryStopsWithTheHub(t *testing.T) {
+	hub := newTestHub(dbtest.NewConn())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// nothing receives the expiry once the hub has stopped, the timer goroutine must still end
+	done := make(chan struct{})
+	go func() {
+		hub.expireTyping(&typingState{key: typingKey{conversationId: 5, userId: 1}}, ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the expiry of a stopped hub blocks forever")
+	}
+}
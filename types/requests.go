@@ -1,5 +1,7 @@
 package types
 
+import "time"
+
 type LoginUserRequest struct {
 	UserEmail    string `json:"user_email" binding:"required,email"`
 	UserPassword string `json:"user_password" binding:"required"`
@@ -10,3 +12,66 @@ type SignupUserRequest struct {
 	UserPassword string `json:"user_password" binding:"required"`
 	UserName     string `json:"user_name" binding:"required"`
 }
+
+type CreateGroupRequest struct {
+	Name      string  `json:"name" binding:"required"`
+	MemberIds []int64 `json:"member_ids" binding:"max=100"`
+}
+
+type RenameGroupRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type AddMembersRequest struct {
+	UserIds []int64 `json:"user_ids" binding:"required,min=1,max=100"`
+}
+
+// UpdateProfileRequest changes the fields it sets and leaves the others as they are, an empty string clears a field
+type UpdateProfileRequest struct {
+	Username    *string `json:"user_name"`
+	DisplayName *string `json:"display_name"`
+	StatusText  *string `json:"status_text"`
+	Bio         *string `json:"bio"`
+}
+
+type EditMessageRequest struct {
+	Content string `json:"content" binding:"required"`
+}
+
+// MessageHistoryQuery pages through a conversation, Before and After are cursors returned by a previous page
+type MessageHistoryQuery struct {
+	Before string `form:"before"`
+	After  string `form:"after"`
+	Limit  int32  `form:"limit"`
+}
+
+// ThreadQuery pages through the replies to a message, After is the cursor returned by the previous page
+type ThreadQuery struct {
+	After string `form:"after"`
+	Limit int32  `form:"limit"`
+}
+
+// InboxQuery pages through the caller's conversations, Before is the cursor returned by the previous page
+type InboxQuery struct {
+	Before string `form:"before"`
+	Limit  int32  `form:"limit"`
+}
+
+// UserSearchQuery looks up users by username or display name, After is the cursor returned by the previous page
+type UserSearchQuery struct {
+	Q     string `form:"q"`
+	After string `form:"after"`
+	Limit int32  `form:"limit"`
+}
+
+// MessageSearchQuery searches the caller's conversations, the filters are optional.
+// Since and Until are RFC 3339 times, Before is the cursor returned by the previous page.
+type MessageSearchQuery struct {
+	Q              string    `form:"q"`
+	From           int64     `form:"from"`
+	ConversationId int64     `form:"conversation_id"`
+	Since          time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until          time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+	Before         string    `form:"before"`
+	Limit          int32     `form:"limit"`
+}
@@ -1,5 +1,7 @@
 package types
 
+import "time"
+
 type BaseHttpResponse struct {
 	Status  string      `json:"status"`
 	Data    interface{} `json:"data"`
@@ -20,7 +22,196 @@ type UserDetails struct {
 	Username string `json:"user_name"`
 }
 
+// ProfileDetails is the profile of the authenticated user
+type ProfileDetails struct {
+	Id          int64     `json:"user_id"`
+	Email       string    `json:"user_email"`
+	Username    string    `json:"user_name"`
+	DisplayName string    `json:"display_name"`
+	StatusText  string    `json:"status_text"`
+	Bio         string    `json:"bio"`
+	PhotoLink   string    `json:"photo_link,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// PublicProfile is the part of a profile other users see
+type PublicProfile struct {
+	Id          int64  `json:"user_id"`
+	Username    string `json:"user_name"`
+	DisplayName string `json:"display_name"`
+	StatusText  string `json:"status_text"`
+	Bio         string `json:"bio"`
+	PhotoLink   string `json:"photo_link,omitempty"`
+}
+
 type LoginResponse struct {
 	AccessToken string      `json:"access_token"`
 	UserDetails UserDetails `json:"user_details"`
 }
+
+type ConversationMemberDetails struct {
+	UserId int64  `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+type ConversationDetails struct {
+	Id      int64                       `json:"conversation_id"`
+	Name    string                      `json:"name"`
+	IsGroup bool                        `json:"is_group"`
+	Members []ConversationMemberDetails `json:"members"`
+}
+
+type MessageDetails struct {
+	Id             int64               `json:"id"`
+	From           int64               `json:"from"`
+	To             int64               `json:"to,omitempty"`
+	ConversationId int64               `json:"conversation_id"`
+	Seq            int64               `json:"seq"`
+	Content        string              `json:"content"`
+	ClientId       string              `json:"client_id,omitempty"`
+	CreatedAt      time.Time           `json:"created_at"`
+	EditedAt       *time.Time          `json:"edited_at,omitempty"`
+	Deleted        bool                `json:"deleted"`
+	ReplyTo        *QuotedMessage      `json:"reply_to,omitempty"`
+	ReplyCount     int32               `json:"reply_count"`
+	LastReplyAt    *time.Time          `json:"last_reply_at,omitempty"`
+	Receipts       []ReceiptDetails    `json:"receipts"`
+	Reactions      []ReactionDetails   `json:"reactions"`
+	Attachments    []AttachmentDetails `json:"attachments"`
+}
+
+// AttachmentDetails describes an uploaded file, its content is served by GET /attachments/:id.
+// Images are Processing until their dimensions and thumbnails are known, an attachment.ready event follows.
+type AttachmentDetails struct {
+	Id         int64              `json:"id"`
+	Filename   string             `json:"filename"`
+	MimeType   string             `json:"mime_type"`
+	Size       int64              `json:"size"`
+	Checksum   string             `json:"checksum"`
+	Width      *int32             `json:"width,omitempty"`
+	Height     *int32             `json:"height,omitempty"`
+	Processing bool               `json:"processing,omitempty"`
+	Thumbnails []ThumbnailDetails `json:"thumbnails,omitempty"`
+}
+
+// ThumbnailDetails describes a scaled down JPEG of an image, served by GET /attachments/:id/thumbnails/:size.
+// Only sizes smaller than the image are made.
+type ThumbnailDetails struct {
+	Size   string `json:"size"`
+	Width  int32  `json:"width"`
+	Height int32  `json:"height"`
+}
+
+// QuotedMessage previews the message a reply quotes, Content is shortened
+type QuotedMessage struct {
+	Id      int64  `json:"id"`
+	From    int64  `json:"from"`
+	Content string `json:"content"`
+	Deleted bool   `json:"deleted"`
+}
+
+// ReactionDetails counts the reactions with one emoji, Reacted tells whether the caller is among them
+type ReactionDetails struct {
+	Emoji   string `json:"emoji"`
+	Count   int64  `json:"count"`
+	Reacted bool   `json:"reacted"`
+}
+
+// MessageEditDetails is an earlier version of an edited message, ReplacedAt is when the edit replaced it
+type MessageEditDetails struct {
+	Content    string    `json:"content"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+// ReceiptDetails is the delivery state of a message for one recipient
+type ReceiptDetails struct {
+	UserId      int64      `json:"user_id"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+	ReadAt      *time.Time `json:"read_at,omitempty"`
+}
+
+// MessagePage lists messages newest first, the cursors point at the oldest and newest message of the page
+type MessagePage struct {
+	Messages []MessageDetails `json:"messages"`
+	Before   string           `json:"before,omitempty"`
+	After    string           `json:"after,omitempty"`
+	HasMore  bool             `json:"has_more"`
+}
+
+// ThreadPage lists the replies to a message oldest first, After points at the newest reply of the page
+type ThreadPage struct {
+	Parent  MessageDetails   `json:"parent"`
+	Replies []MessageDetails `json:"replies"`
+	After   string           `json:"after,omitempty"`
+	HasMore bool             `json:"has_more"`
+}
+
+// InboxEntry is one conversation of the caller's conversation list.
+// Peer is set for direct conversations, Name and MemberCount describe groups.
+type InboxEntry struct {
+	ConversationId int64               `json:"conversation_id"`
+	Name           string              `json:"name,omitempty"`
+	IsGroup        bool                `json:"is_group"`
+	MemberCount    int64               `json:"member_count"`
+	Peer           *PeerDetails        `json:"peer,omitempty"`
+	LastSeq        int64               `json:"last_seq"`
+	UnreadCount    int32               `json:"unread_count"`
+	LastActivityAt time.Time           `json:"last_activity_at"`
+	LastMessage    *LastMessageDetails `json:"last_message,omitempty"`
+}
+
+// PeerDetails is the other user of a direct conversation
+type PeerDetails struct {
+	UserId      int64      `json:"user_id"`
+	Username    string     `json:"user_name"`
+	DisplayName string     `json:"display_name"`
+	PhotoLink   string     `json:"photo_link,omitempty"`
+	LastSeenAt  *time.Time `json:"last_seen_at,omitempty"`
+}
+
+// LastMessageDetails previews the newest message of a conversation, Content is shortened
+type LastMessageDetails struct {
+	Id        int64     `json:"id"`
+	From      int64     `json:"from"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+	Deleted   bool      `json:"deleted"`
+}
+
+// InboxPage lists conversations by recent activity, Before points at the last conversation of the page
+type InboxPage struct {
+	Conversations []InboxEntry `json:"conversations"`
+	Before        string       `json:"before,omitempty"`
+	HasMore       bool         `json:"has_more"`
+}
+
+// MessageSearchResult is a message matching a search, Snippet is HTML escaped with the matches in <mark> tags
+type MessageSearchResult struct {
+	Id             int64     `json:"id"`
+	From           int64     `json:"from"`
+	ConversationId int64     `json:"conversation_id"`
+	Seq            int64     `json:"seq"`
+	Snippet        string    `json:"snippet"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// MessageSearchPage lists the messages matching a search newest first, Before points at the oldest of the page
+type MessageSearchPage struct {
+	Messages []MessageSearchResult `json:"messages"`
+	Before   string                `json:"before,omitempty"`
+	HasMore  bool                  `json:"has_more"`
+}
+
+// UserSearchPage lists the users matching a search, best matches first
+type UserSearchPage struct {
+	Users   []PublicProfile `json:"users"`
+	After   string          `json:"after,omitempty"`
+	HasMore bool            `json:"has_more"`
+}
+
+type PresenceDetails struct {
+	UserId     int64      `json:"user_id"`
+	Online     bool       `json:"online"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+}
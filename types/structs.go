@@ -1,7 +1,26 @@
 package types
 
+import "encoding/json"
+
 // SocketEventStruct struct of socket events
 type SocketEventStruct struct {
 	EventName    string      `json:"eventName"`
+	EventId      string      `json:"eventId,omitempty"`
 	EventPayload interface{} `json:"eventPayload"`
 }
+
+// SocketEventRequest is a socket event read from a client, its payload is decoded by the handler of the event
+type SocketEventRequest struct {
+	EventName    string          `json:"eventName"`
+	EventId      string          `json:"eventId,omitempty"`
+	EventPayload json.RawMessage `json:"eventPayload"`
+}
+
+// SocketErrorPayload payload of the error socket event.
+// EventId is the id of the client event that failed, Close tells that the server is closing the connection.
+type SocketErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	EventId string `json:"event_id,omitempty"`
+	Close   bool   `json:"close"`
+}
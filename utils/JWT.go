@@ -102,6 +102,23 @@ func ExtractUserIdFromToken(tokenString string) (int64, error) {
 	return userId, err
 }
 
+// ExtractUserIdFromRequest returns the user id carried by the bearer token of the request
+func ExtractUserIdFromRequest(context *gin.Context) (int64, error) {
+	token, err := ExtractJWT(context)
+	if err != nil {
+		return 0, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return 0, errors.New("invalid token provided")
+	}
+	userId, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, errors.New("invalid token provided")
+	}
+	return int64(userId), nil
+}
+
 func ExtractJWT(context *gin.Context) (*jwt.Token, error) {
 	tokenString := ExtractFromRequest(context)
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
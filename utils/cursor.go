@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// EncodeCursor builds an opaque pagination cursor from a row's (created_at, id) position
+func EncodeCursor(createdAt time.Time, id int64) string {
+	raw := fmt.Sprintf("%d:%d", createdAt.UnixMicro(), id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor reverses EncodeCursor
+func DecodeCursor(cursor string) (time.Time, int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+
+	var micros, id int64
+	if _, err := fmt.Sscanf(string(raw), "%d:%d", &micros, &id); err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	return time.UnixMicro(micros), id, nil
+}
+
+// EncodeOffsetCursor builds an opaque pagination cursor for results ranked by relevance, where only the position is stable
+func EncodeOffsetCursor(offset int32) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("offset:%d", offset)))
+}
+
+// DecodeOffsetCursor reverses EncodeOffsetCursor
+func DecodeOffsetCursor(cursor string) (int32, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+
+	var offset int32
+	if _, err := fmt.Sscanf(string(raw), "offset:%d", &offset); err != nil || offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return offset, nil
+}
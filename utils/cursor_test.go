@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2024, time.March, 3, 10, 4, 5, 123456000, time.UTC)
+
+	decodedAt, id, err := DecodeCursor(EncodeCursor(createdAt, 42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decodedAt.Equal(createdAt) || id != 42 {
+		t.Fatalf("decoded (%v, %d), want (%v, 42)", decodedAt, id, createdAt)
+	}
+}
+
+func TestDecodeCursorRejectsGarbage(t *testing.T) {
+	for _, cursor := range []string{"", "not base64!", "MTIz", EncodeOffsetCursor(3)} {
+		if _, _, err := DecodeCursor(cursor); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("DecodeCursor(%q) = %v, want ErrInvalidCursor", cursor, err)
+		}
+	}
+}
+
+func TestOffsetCursorRoundTrip(t *testing.T) {
+	offset, err := DecodeOffsetCursor(EncodeOffsetCursor(60))
+	if err != nil || offset != 60 {
+		t.Fatalf("decoded (%d, %v), want 60", offset, err)
+	}
+	for _, cursor := range []string{"%%", EncodeCursor(time.Now(), 1), "b2Zmc2V0Oi0x"} {
+		if _, err := DecodeOffsetCursor(cursor); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("DecodeOffsetCursor(%q) = %v, want ErrInvalidCursor", cursor, err)
+		}
+	}
+}